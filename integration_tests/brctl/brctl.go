@@ -8,6 +8,7 @@ import (
 	"os/exec"
 	"regexp"
 	"strings"
+	"sync"
 )
 
 type Bridge struct {
@@ -42,7 +43,16 @@ func Delete(name string) error {
 	return nil
 }
 
+// numbered serializes CreateNumbered, so that tests running in parallel do
+// not race for the same name.
+var numbered sync.Mutex
+
+// CreateNumbered creates a bridge named prefix followed by the lowest number
+// that is not in use. It is safe for concurrent use.
 func CreateNumbered(prefix string) (string, error) {
+	numbered.Lock()
+	defer numbered.Unlock()
+
 	var err error
 	var name string
 
@@ -0,0 +1,236 @@
+// Package console is an expect-style interface to the console of a domain.
+//
+// A test waits for output with Expect and answers with Send or SendLine:
+//
+//	c, err := console.Attach(ctx, hv, domain.ID, w)
+//	...
+//	if _, err := c.ExpectString("what's your name?", 5*time.Second); err != nil {
+//		return err
+//	}
+//	c.SendLine("Unigornel")
+//
+// or declares the conversation as steps:
+//
+//	err := c.Converse([]console.Step{
+//		{Expect: "what's your name\\?", Send: "Unigornel\n"},
+//		{Expect: "Hello, Unigornel"},
+//	})
+package console
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/unigornel/unigornel/integration_tests/xen"
+)
+
+// DefaultTimeout is the timeout of a step without a timeout.
+const DefaultTimeout = 10 * time.Second
+
+// ErrDetached is returned when the console detaches while output is
+// expected.
+var ErrDetached = errors.New("console detached")
+
+// TimeoutError is returned when the expected output does not appear in
+// time.
+type TimeoutError struct {
+	Pattern string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %v waiting for '%v'", e.Timeout, e.Pattern)
+}
+
+// Console is an attached domain console. It is safe for concurrent use.
+type Console struct {
+	conn xen.DomainConsole
+
+	mutex      sync.Mutex
+	transcript bytes.Buffer
+	pos        int
+	changed    chan struct{}
+	detached   chan struct{}
+}
+
+// Attach attaches to the console of a domain. The output is also written to
+// w, unless it is nil. The console detaches when the context is done.
+func Attach(ctx context.Context, hv xen.Hypervisor, id int, w io.Writer) (*Console, error) {
+	c := &Console{
+		changed:  make(chan struct{}),
+		detached: make(chan struct{}),
+	}
+
+	var out io.Writer = (*consoleWriter)(c)
+	if w != nil {
+		out = io.MultiWriter(out, w)
+	}
+
+	conn, err := hv.Console(ctx, id, out)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+
+	go func() {
+		conn.Wait()
+		c.mutex.Lock()
+		close(c.detached)
+		c.notify()
+		c.mutex.Unlock()
+	}()
+	return c, nil
+}
+
+// consoleWriter receives the output of the domain.
+type consoleWriter Console
+
+func (w *consoleWriter) Write(p []byte) (int, error) {
+	c := (*Console)(w)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.transcript.Write(p)
+	c.notify()
+	return len(p), nil
+}
+
+// notify wakes up the waiting Expect calls. The mutex must be held.
+func (c *Console) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// Expect waits until the output matches the regular expression. Only output
+// after the previous match is searched. It returns the match and its
+// submatches.
+func (c *Console) Expect(re *regexp.Regexp, timeout time.Duration) ([]string, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		c.mutex.Lock()
+		out := c.transcript.Bytes()[c.pos:]
+		if m := re.FindSubmatchIndex(out); m != nil {
+			match := make([]string, len(m)/2)
+			for i := range match {
+				if m[2*i] >= 0 {
+					match[i] = string(out[m[2*i]:m[2*i+1]])
+				}
+			}
+			c.pos += m[1]
+			c.mutex.Unlock()
+			return match, nil
+		}
+		changed := c.changed
+		c.mutex.Unlock()
+
+		select {
+		case <-changed:
+		case <-c.detached:
+			// Check the output once more: it may have arrived just before
+			// the console detached.
+			if m, err := c.expectNow(re); m != nil || err != nil {
+				return m, err
+			}
+			return nil, ErrDetached
+		case <-timer.C:
+			return nil, &TimeoutError{Pattern: re.String(), Timeout: timeout}
+		}
+	}
+}
+
+func (c *Console) expectNow(re *regexp.Regexp) ([]string, error) {
+	c.mutex.Lock()
+	out := c.transcript.Bytes()[c.pos:]
+	matches := re.Match(out)
+	c.mutex.Unlock()
+
+	if !matches {
+		return nil, nil
+	}
+	return c.Expect(re, 0)
+}
+
+// ExpectString waits until the output contains s.
+func (c *Console) ExpectString(s string, timeout time.Duration) (string, error) {
+	m, err := c.Expect(regexp.MustCompile(regexp.QuoteMeta(s)), timeout)
+	if err != nil {
+		return "", err
+	}
+	return m[0], nil
+}
+
+// Send writes s to the input of the domain.
+func (c *Console) Send(s string) error {
+	_, err := io.WriteString(c.conn, s)
+	return err
+}
+
+// SendLine writes s and a newline to the input of the domain.
+func (c *Console) SendLine(s string) error {
+	return c.Send(s + "\n")
+}
+
+// Transcript returns all the output of the domain so far.
+func (c *Console) Transcript() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.transcript.String()
+}
+
+// Close detaches the console and waits until it is detached.
+func (c *Console) Close() error {
+	err := c.conn.Close()
+	<-c.detached
+	return err
+}
+
+// Detached is closed when the console detaches.
+func (c *Console) Detached() <-chan struct{} {
+	return c.detached
+}
+
+// Step is a step in a conversation with a domain. It waits until the output
+// matches Expect, if it is set, and then sends Send, if it is set.
+type Step struct {
+	// Expect is a regular expression.
+	Expect string
+	Send   string
+
+	// Timeout defaults to DefaultTimeout.
+	Timeout time.Duration
+}
+
+// Converse takes the steps in order.
+func (c *Console) Converse(steps []Step) error {
+	for i, step := range steps {
+		if step.Expect != "" {
+			re, err := regexp.Compile(step.Expect)
+			if err != nil {
+				return fmt.Errorf("step %d: %v", i, err)
+			}
+
+			timeout := step.Timeout
+			if timeout == 0 {
+				timeout = DefaultTimeout
+			}
+			if _, err := c.Expect(re, timeout); err != nil {
+				return fmt.Errorf("step %d: %v", i, err)
+			}
+		}
+
+		if step.Send != "" {
+			if err := c.Send(step.Send); err != nil {
+				return fmt.Errorf("step %d: %v", i, err)
+			}
+		}
+	}
+	return nil
+}
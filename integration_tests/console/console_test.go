@@ -0,0 +1,165 @@
+package console
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unigornel/unigornel/integration_tests/xen"
+	"github.com/unigornel/unigornel/unigornel/xl"
+)
+
+// start creates and unpauses a domain of the fake hypervisor with the
+// steps, and attaches to its console.
+func start(t *testing.T, steps []xen.FakeStep) (*xen.FakeHypervisor, *xen.Domain, *Console) {
+	hv := xen.NewFakeHypervisor(func(xl.Kernel) []xen.FakeStep {
+		return steps
+	})
+	dom, err := hv.Create(context.Background(), xl.Kernel{Name: "test", Binary: "/nonexistent/unikernel", Memory: 32}, nil)
+	require.Nil(t, err)
+
+	c, err := Attach(context.Background(), hv, dom.ID, nil)
+	require.Nil(t, err)
+	require.Nil(t, hv.Unpause(context.Background(), dom.ID))
+	return hv, dom, c
+}
+
+func TestExpect(t *testing.T) {
+	_, _, c := start(t, []xen.FakeStep{
+		{Output: "booting\n"},
+		{After: 20 * time.Millisecond, Output: "ip 10.0.0.2 "},
+		{Output: "ready\n"},
+	})
+	defer c.Close()
+
+	m, err := c.Expect(regexp.MustCompile(`ip (\d+\.\d+\.\d+\.\d+)`), time.Second)
+	require.Nil(t, err)
+	assert.Equal(t, []string{"ip 10.0.0.2", "10.0.0.2"}, m)
+
+	// Output before the previous match is not searched again.
+	_, err = c.ExpectString("booting", 20*time.Millisecond)
+	assert.IsType(t, &TimeoutError{}, err)
+
+	s, err := c.ExpectString("ready", time.Second)
+	require.Nil(t, err)
+	assert.Equal(t, "ready", s)
+	assert.Equal(t, "booting\nip 10.0.0.2 ready\n", c.Transcript())
+}
+
+func TestExpectTimeout(t *testing.T) {
+	_, _, c := start(t, []xen.FakeStep{{Output: "hello\n"}})
+	defer c.Close()
+
+	start := time.Now()
+	_, err := c.ExpectString("goodbye", 50*time.Millisecond)
+	require.NotNil(t, err)
+	assert.Equal(t, "timed out after 50ms waiting for 'goodbye'", err.Error())
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+}
+
+func TestExpectDetached(t *testing.T) {
+	hv, dom, c := start(t, []xen.FakeStep{{Output: "bye\n"}})
+
+	_, err := c.ExpectString("bye", time.Second)
+	require.Nil(t, err)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		hv.Destroy(context.Background(), dom.ID)
+	}()
+	_, err = c.ExpectString("more", time.Second)
+	assert.Equal(t, ErrDetached, err)
+
+	select {
+	case <-c.Detached():
+	default:
+		t.Fatal("console is not detached")
+	}
+}
+
+func TestConverse(t *testing.T) {
+	type test struct {
+		Steps []xen.FakeStep
+		Talk  []Step
+		Error string
+	}
+
+	tests := []test{
+		{
+			Steps: []xen.FakeStep{
+				{Output: "Hello, what's your name? "},
+				{Input: "Unigornel\n", Output: "Hello, Unigornel\n"},
+			},
+			Talk: []Step{
+				{Expect: `what's your name\?`, Send: "Unigornel\n"},
+				{Expect: `Hello, Unigornel`},
+			},
+		},
+		{
+			Steps: []xen.FakeStep{
+				{Input: "1\n", Output: "one\n"},
+				{Input: "2\n", Output: "two\n"},
+			},
+			Talk: []Step{
+				{Send: "1\n"},
+				{Expect: "one", Send: "2\n"},
+				{Expect: "two"},
+			},
+		},
+		{
+			Steps: []xen.FakeStep{{Output: "prompt> "}},
+			Talk: []Step{
+				{Expect: "prompt> ", Send: "help\n"},
+				{Expect: "usage", Timeout: 20 * time.Millisecond},
+			},
+			Error: "step 1: timed out after 20ms waiting for 'usage'",
+		},
+		{
+			Talk:  []Step{{Expect: "("}},
+			Error: "step 0: error parsing regexp: missing closing ): `(`",
+		},
+	}
+
+	for i, test := range tests {
+		_, _, c := start(t, test.Steps)
+		err := c.Converse(test.Talk)
+		if test.Error == "" {
+			assert.Nil(t, err, "for test %d", i)
+		} else if assert.NotNil(t, err, "for test %d", i) {
+			assert.Equal(t, test.Error, err.Error(), "for test %d", i)
+		}
+		c.Close()
+	}
+}
+
+func TestConcurrentExpect(t *testing.T) {
+	var steps []xen.FakeStep
+	for i := 0; i < 10; i++ {
+		steps = append(steps, xen.FakeStep{After: time.Millisecond, Output: fmt.Sprintf("line %d\n", i)})
+	}
+	_, _, c := start(t, steps)
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.Expect(regexp.MustCompile(`line \d\n`), time.Second)
+			errs <- err
+			c.Transcript()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.Nil(t, err)
+	}
+}
@@ -11,6 +11,7 @@ type TestSuite struct {
 	XMLName    xml.Name   `xml:"testsuite"`
 	Tests      int        `xml:"tests,attr"`
 	Failures   int        `xml:"failures,attr"`
+	Skipped    int        `xml:"skipped,attr"`
 	Time       string     `xml:"time,attr"`
 	Name       string     `xml:"name,attr"`
 	Properties []Property `xml:"properties>property,omitempty"`
@@ -29,6 +30,7 @@ type TestCase struct {
 	Time      string   `xml:"time,attr"`
 	Output    string   `xml:"system-out,omitempty"`
 	Failure   *Failure `xml:"failure,omitempty"`
+	Skipped   *Skipped `xml:"skipped,omitempty"`
 }
 
 type Failure struct {
@@ -36,3 +38,7 @@ type Failure struct {
 	Type     string `xml:"type,attr"`
 	Contents string `xml:",chardata"`
 }
+
+type Skipped struct {
+	Message string `xml:"message,attr"`
+}
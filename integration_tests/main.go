@@ -3,14 +3,21 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/xml"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/unigornel/unigornel/integration_tests/junit"
 	"github.com/unigornel/unigornel/integration_tests/tests"
+	"github.com/unigornel/unigornel/integration_tests/xen"
 )
 
 type options struct {
@@ -18,37 +25,100 @@ type options struct {
 	ListTests bool
 	ShowInfo  bool
 	TestName  string
+	Selector  tests.Selector
 	JUnit     string
+	Timeout   time.Duration
+	Timeouts  tests.Timeouts
+	Parallel  int
+	Memory    int
+	Reap      bool
+	StateDir  string
 }
 
 func main() {
 	o := parseOptions()
 
-	if o.ShowInfo {
-		showInfo()
-		return
-	}
-
-	if o.ListTests {
-		listTests()
+	if o.Reap {
+		log.Printf("Reaping resources of earlier runs in %s\n", o.StateDir)
+		if err := tests.Reap(context.Background(), o.StateDir, xen.DefaultHypervisor, os.Stdout); err != nil {
+			log.Fatalf("error: %v\n", err)
+		}
 		return
 	}
 
-	var ts []tests.Test
+	ts := allTests
 	if o.TestName != "" {
 		t := testWithName(allTests, o.TestName)
 		if t == nil {
 			log.Fatalf("error: no test with name '%s'\n", o.TestName)
 		}
 		ts = []tests.Test{t}
-	} else {
-		ts = allTests
+	}
+	ts = o.Selector.Select(ts)
+
+	if o.ShowInfo {
+		showInfo(ts)
+		return
+	}
+
+	if o.ListTests {
+		listTests(ts)
+		return
+	}
+
+	if len(ts) == 0 {
+		log.Fatalln("error: no tests selected")
+	}
+
+	// On SIGINT or SIGTERM the tests are cancelled and cleaned up. A second
+	// signal kills the runner.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		s := <-signals
+		log.Printf("Received %v, cleaning up\n", s)
+		signal.Stop(signals)
+		cancel()
+	}()
+
+	if o.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.Timeout)
+		defer cancel()
+	}
+
+	runID := tests.NewRunID()
+	journal, err := tests.OpenJournal(o.StateDir, runID)
+	if err != nil {
+		log.Fatalf("error: could not open the journal: %v\n", err)
+	}
+
+	runOptions := tests.Options{Timeouts: o.Timeouts, Journal: journal}
+	if o.Parallel > 1 {
+		memory := o.Memory
+		if memory == 0 {
+			free, err := xen.DefaultHypervisor.FreeMemory(ctx)
+			if err != nil {
+				log.Fatalf("error: could not get the free memory of the host: %v\n", err)
+			}
+			memory = free
+		}
+		log.Printf("Scheduling tests with %d MiB of memory\n", memory)
+		runOptions.Memory = tests.NewMemoryScheduler(memory)
 	}
 
-	log.Printf("Running %d tests\n", len(ts))
-	results := runTests(ts)
-	report, failures := reportFromResults(results)
-	log.Printf("Ran %d tests with %d failures\n", len(ts), failures)
+	log.Printf("Running %d tests (run %s)\n", len(ts), runID)
+	results := tests.RunAll(ctx, ts, o.Parallel, runOptions)
+	if err := journal.Close(); err != nil {
+		log.Printf("error: %v; remove them with -reap\n", err)
+	}
+	report, failures, skipped := reportFromResults(results)
+	log.Printf("Ran %d tests with %d failures\n", len(ts)-skipped, failures)
+	if skipped > 0 {
+		log.Printf("Skipped %d tests\n", skipped)
+	}
 
 	if o.JUnit != "" {
 		log.Printf("Writing junit report to %s\n", o.JUnit)
@@ -65,15 +135,19 @@ func main() {
 	}
 }
 
-func listTests() {
-	for _, test := range allTests {
+func listTests(ts []tests.Test) {
+	for _, test := range ts {
 		fmt.Println(test.GetName())
 	}
 }
 
-func showInfo() {
-	for _, test := range allTests {
+func showInfo(ts []tests.Test) {
+	for _, test := range ts {
 		fmt.Println(test.GetName())
+		fmt.Printf("    category: %v\n", test.GetCategory())
+		if labels := tests.Labels(test); len(labels) > 0 {
+			fmt.Printf("    labels: %v\n", strings.Join(labels, ", "))
+		}
 		if info := test.GetInfo(); info != "" {
 			scanner := bufio.NewScanner(bytes.NewBuffer([]byte(info)))
 			for scanner.Scan() {
@@ -92,19 +166,12 @@ func testWithName(ts []tests.Test, name string) tests.Test {
 	return nil
 }
 
-func runTests(ts []tests.Test) []tests.Result {
-	results := make([]tests.Result, len(ts))
-	for i, test := range ts {
-		fmt.Printf("Running test %s (%d/%d)\n", test.GetName(), i, len(ts))
-		results[i] = tests.Run(test)
-	}
-	return results
-}
-
-func reportFromResults(rs []tests.Result) (junit.Report, int) {
-	failures := 0
+func reportFromResults(rs []tests.Result) (junit.Report, int, int) {
+	failures, skipped := 0, 0
 	for _, r := range rs {
-		if r.Error != nil {
+		if r.Skipped {
+			skipped++
+		} else if r.Error != nil {
 			failures++
 		}
 	}
@@ -112,6 +179,7 @@ func reportFromResults(rs []tests.Result) (junit.Report, int) {
 	ts := junit.TestSuite{
 		Tests:    len(rs),
 		Failures: failures,
+		Skipped:  skipped,
 		Name:     "integration tests",
 	}
 
@@ -121,17 +189,33 @@ func reportFromResults(rs []tests.Result) (junit.Report, int) {
 
 	return junit.Report{
 		Suites: []junit.TestSuite{ts},
-	}, failures
+	}, failures, skipped
 }
 
 func parseOptions() options {
 	var o options
 
 	flag.BoolVar(&o.ShowHelp, "help", false, "show this help")
-	flag.BoolVar(&o.ListTests, "list", false, "list all known tests and exit")
-	flag.BoolVar(&o.ShowInfo, "info", false, "show all known tests, with info, and exit")
+	flag.BoolVar(&o.ListTests, "list", false, "list the selected tests and exit")
+	flag.BoolVar(&o.ShowInfo, "info", false, "show the selected tests, with info, and exit")
 	flag.StringVar(&o.TestName, "test", "", "run a specific test")
+	flag.Var((*patternList)(&o.Selector.Run), "run", "run the tests whose name matches the regular expression (may be repeated)")
+	flag.Var((*patternList)(&o.Selector.Skip), "skip", "skip the tests whose name matches the regular expression (may be repeated)")
+	flag.Var((*stringList)(&o.Selector.Categories), "category", "run the tests in the comma-separated categories (may be repeated)")
+	flag.Var((*stringList)(&o.Selector.Labels), "label", "run the tests with one of the comma-separated labels; !label skips the tests with the label (may be repeated)")
 	flag.StringVar(&o.JUnit, "junit", "", "write a JUnit report to the specified file")
+	flag.IntVar(&o.Parallel, "parallel", 1, "run this many tests at the same time")
+	flag.IntVar(&o.Memory, "memory", 0, "the memory in MiB for the domains of parallel tests (default: the free memory of the host)")
+	flag.BoolVar(&o.Reap, "reap", false, "remove the domains, bridges and files that earlier runs left behind, and exit")
+	flag.StringVar(&o.StateDir, "state-dir", tests.DefaultStateDir, "the directory with the journals of the runs")
+	flag.DurationVar(&o.Timeout, "timeout", 0, "stop running tests after this duration (0 means no deadline)")
+
+	d := tests.DefaultTimeouts
+	flag.DurationVar(&o.Timeouts.Build, "build-timeout", d.Build, "timeout of the build phase of a test")
+	flag.DurationVar(&o.Timeouts.Setup, "setup-timeout", d.Setup, "timeout of the setup phase of a test")
+	flag.DurationVar(&o.Timeouts.Run, "run-timeout", d.Run, "timeout of the run phase of a test")
+	flag.DurationVar(&o.Timeouts.Check, "check-timeout", d.Check, "timeout of the check phase of a test")
+	flag.DurationVar(&o.Timeouts.Clean, "clean-timeout", d.Clean, "timeout of the clean phase of a test")
 
 	flag.Parse()
 
@@ -147,3 +231,40 @@ func parseOptions() options {
 
 	return o
 }
+
+// stringList is a flag that may be repeated. Every value is a
+// comma-separated list.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			*l = append(*l, s)
+		}
+	}
+	return nil
+}
+
+// patternList is a flag with a regular expression that may be repeated.
+type patternList []*regexp.Regexp
+
+func (l *patternList) String() string {
+	var s []string
+	for _, re := range *l {
+		s = append(s, re.String())
+	}
+	return strings.Join(s, " ")
+}
+
+func (l *patternList) Set(value string) error {
+	re, err := regexp.Compile(value)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, re)
+	return nil
+}
@@ -2,10 +2,13 @@ package ping
 
 import (
 	"bufio"
+	"context"
 	"io"
 	"os/exec"
 	"regexp"
 	"strconv"
+
+	"github.com/unigornel/unigornel/integration_tests/proc"
 )
 
 type Response struct {
@@ -15,9 +18,9 @@ type Response struct {
 	Time    string
 }
 
-func Ping(host string, args ...string) *exec.Cmd {
+func Ping(ctx context.Context, host string, args ...string) *exec.Cmd {
 	argv := append(args, host)
-	return exec.Command("ping", argv...)
+	return proc.Command(ctx, "ping", argv...)
 }
 
 func Parse(r io.Reader) ([]Response, error) {
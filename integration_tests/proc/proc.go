@@ -0,0 +1,36 @@
+// Package proc runs commands in their own process group, so that a command
+// and the processes it started are killed together.
+package proc
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// WaitDelay is how long Wait waits for the output of a killed command.
+const WaitDelay = 5 * time.Second
+
+// Command returns a command that is killed with its children when the
+// context is done.
+func Command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return Kill(cmd)
+	}
+	cmd.WaitDelay = WaitDelay
+	return cmd
+}
+
+// Kill kills the process group of a started command.
+func Kill(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+		return cmd.Process.Kill()
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package proc
+
+import (
+	"context"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandKillsChildren(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// The shell prints the PID of its child and waits for it.
+	cmd := Command(ctx, "sh", "-c", "sleep 30 & echo $!; wait")
+	stdout, err := cmd.StdoutPipe()
+	require.Nil(t, err)
+	require.Nil(t, cmd.Start())
+
+	buf := make([]byte, 32)
+	n, err := stdout.Read(buf)
+	require.Nil(t, err)
+	child, err := strconv.Atoi(strings.TrimSpace(string(buf[:n])))
+	require.Nil(t, err)
+
+	start := time.Now()
+	cancel()
+	assert.NotNil(t, cmd.Wait())
+	assert.True(t, time.Since(start) < WaitDelay)
+
+	// The child is gone, or a zombie until init reaps it.
+	gone := false
+	for i := 0; i < 50 && !gone; i++ {
+		err := syscall.Kill(child, 0)
+		gone = err != nil || isZombie(child)
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, gone, "child %d still runs", child)
+}
+
+func isZombie(pid int) bool {
+	stat, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return true
+	}
+	fields := strings.Fields(string(stat))
+	return len(fields) > 2 && fields[2] == "Z"
+}
+
+func TestCommandOutput(t *testing.T) {
+	out, err := Command(context.Background(), "echo", "hello").Output()
+	require.Nil(t, err)
+	assert.Equal(t, "hello\n", string(out))
+}
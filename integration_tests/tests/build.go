@@ -1,29 +1,56 @@
 package tests
 
 import (
+	"context"
 	"fmt"
+	"go/build"
 	"io"
 	"io/ioutil"
 	"os"
-	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/unigornel/unigornel/integration_tests/proc"
+	"github.com/unigornel/unigornel/unigornel/manifest"
 )
 
-func Build(w io.Writer, name, pack string, other ...string) (string, error) {
+// buildSlot serializes `unigornel build`. All builds compile in the one
+// Mini-OS tree of the toolchain, and -a rebuilds the packages in its
+// GOROOT, so builds that run at the same time clobber each other.
+var buildSlot = make(chan struct{}, 1)
+
+// Build builds the unikernel in pack. With a BuildCache on ctx, every
+// distinct image is built once and shared by the tests; otherwise the
+// unikernel is a resource of the test. The build waits for other builds
+// to finish.
+func Build(ctx context.Context, w io.Writer, name, pack string, other ...string) (string, error) {
+	if c := buildCacheFrom(ctx); c != nil {
+		return c.build(ctx, w, name, pack, other)
+	}
+	return buildUnikernel(ctx, w, RegistryFrom(ctx), name, pack, other)
+}
+
+func buildUnikernel(ctx context.Context, w io.Writer, registry *Registry, name, pack string, other []string) (string, error) {
+	select {
+	case buildSlot <- struct{}{}:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	defer func() { <-buildSlot }()
+
 	fh, err := ioutil.TempFile("", "unigornel-tests-")
 	if err != nil {
 		return "", err
 	}
 	fh.Close()
 	file := fh.Name()
+	registry.AddFile(file)
 
 	fmt.Fprintf(w, "[+] building %s to %s\n", name, file)
 	args := []string{"build", "-x", "-a", "-o", file}
 	args = append(args, other...)
 	args = append(args, pack)
-	cmd := exec.Command(
-		"unigornel",
-		args...,
-	)
+	cmd := proc.Command(ctx, "unigornel", args...)
 	cmd.Stdout = w
 	cmd.Stderr = w
 
@@ -34,18 +61,136 @@ func Build(w io.Writer, name, pack string, other ...string) (string, error) {
 	return file, nil
 }
 
-func GoGet(w io.Writer, pack string) error {
+// BuildCache keeps the unikernels that were built in a run, so that the
+// tests that use the same image build it once. It is safe for concurrent
+// use.
+type BuildCache struct {
+	registry *Registry
+
+	mutex  sync.Mutex
+	images map[string]*image
+}
+
+// image is a unikernel in the cache. Its lock is held while it is built.
+type image struct {
+	lock chan struct{}
+	file string
+}
+
+// NewBuildCache creates a cache. The unikernels are recorded in the
+// journal, unless it is nil.
+func NewBuildCache(journal *Journal) *BuildCache {
+	return &BuildCache{
+		registry: NewRegistry(journal),
+		images:   make(map[string]*image),
+	}
+}
+
+func (c *BuildCache) build(ctx context.Context, w io.Writer, name, pack string, other []string) (string, error) {
+	key := strings.Join(append([]string{pack}, other...), "\x00")
+	c.mutex.Lock()
+	img, ok := c.images[key]
+	if !ok {
+		img = &image{lock: make(chan struct{}, 1)}
+		c.images[key] = img
+	}
+	c.mutex.Unlock()
+
+	select {
+	case img.lock <- struct{}{}:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	defer func() { <-img.lock }()
+
+	if img.file != "" {
+		fmt.Fprintf(w, "[+] %s was built before: %s\n", name, img.file)
+		return img.file, nil
+	}
+
+	// A failed build is not kept: the next test tries again.
+	file, err := buildUnikernel(ctx, w, c.registry, name, pack, other)
+	if err == nil {
+		img.file = file
+	}
+	return file, err
+}
+
+// Remove removes the unikernels in the cache.
+func (c *BuildCache) Remove(ctx context.Context, w io.Writer) error {
+	return c.registry.Teardown(ctx, w)
+}
+
+type buildCacheKey struct{}
+
+// WithBuildCache returns a context that carries the build cache of a run.
+func WithBuildCache(ctx context.Context, c *BuildCache) context.Context {
+	return context.WithValue(ctx, buildCacheKey{}, c)
+}
+
+func buildCacheFrom(ctx context.Context) *BuildCache {
+	c, _ := ctx.Value(buildCacheKey{}).(*BuildCache)
+	return c
+}
+
+// CheckArgs checks the KEY=VALUE arguments of a unikernel against the
+// settings in the manifest of its package, as `unigornel run` does. Without
+// a package there is nothing to check.
+func CheckArgs(pack string, args []string) error {
+	if pack == "" {
+		return nil
+	}
+
+	p, err := build.Import(pack, "", build.FindOnly)
+	if err != nil {
+		return err
+	}
+	m, _, err := manifest.ReadDir(p.Dir)
+	if err != nil {
+		return err
+	}
+	if err := m.CheckArgs(args); err != nil {
+		return fmt.Errorf("arguments of %v: %v", pack, err)
+	}
+	return nil
+}
+
+// gopath serializes the commands that change GOPATH, so that tests that
+// are built in parallel do not fetch the same packages at the same time.
+var gopath struct {
+	sync.Mutex
+	libsUpdated bool
+}
+
+func GoGet(ctx context.Context, w io.Writer, pack string) error {
+	gopath.Lock()
+	defer gopath.Unlock()
+
 	fmt.Fprintf(w, "[+] go get -v -d %v\n", pack)
-	cmd := exec.Command("go", "get", "-v", "-d", pack)
+	cmd := proc.Command(ctx, "go", "get", "-v", "-d", pack)
 	cmd.Stdout = w
 	cmd.Stderr = w
 	return cmd.Run()
 }
 
-func UpdateLibs(w io.Writer) error {
+// UpdateLibs updates the unigornel libraries. They are updated once: later
+// calls do nothing.
+func UpdateLibs(ctx context.Context, w io.Writer) error {
+	gopath.Lock()
+	defer gopath.Unlock()
+
+	if gopath.libsUpdated {
+		fmt.Fprintf(w, "[+] unigornel libs are up to date\n")
+		return nil
+	}
+
 	fmt.Fprintf(w, "[+] unigornel libs update\n")
-	cmd := exec.Command("unigornel", "libs", "update", "--fetch")
+	cmd := proc.Command(ctx, "unigornel", "libs", "update", "--fetch")
 	cmd.Stdout = w
 	cmd.Stderr = w
-	return cmd.Run()
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+	gopath.libsUpdated = true
+	return nil
 }
@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeUnigornel is a `unigornel build` that fails when another build is
+// running, and logs the packages that it builds.
+const fakeUnigornel = `#!/bin/sh
+mkdir "$FAKE_DIR/building" || exit 1
+while [ $# -gt 1 ]; do
+	if [ "$1" = -o ]; then out=$2; fi
+	shift
+done
+sleep 0.05
+echo "$1" >> "$FAKE_DIR/log"
+echo "kernel $1" > "$out"
+rmdir "$FAKE_DIR/building"
+`
+
+func TestBuildCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unigornel-build")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "unigornel"), []byte(fakeUnigornel), 0755))
+
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	defer os.Unsetenv("FAKE_DIR")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	os.Setenv("FAKE_DIR", dir)
+
+	cache := NewBuildCache(nil)
+	ctx := WithBuildCache(context.Background(), cache)
+	packs := []string{"ping", "hello", "ping", "hello", "ping"}
+
+	files := make([]string, len(packs))
+	errs := make([]error, len(packs))
+	var wg sync.WaitGroup
+	for i, pack := range packs {
+		wg.Add(1)
+		go func(i int, pack string) {
+			defer wg.Done()
+			files[i], errs[i] = Build(ctx, ioutil.Discard, pack, pack)
+		}(i, pack)
+	}
+	wg.Wait()
+
+	for i := range packs {
+		assert.Nil(t, errs[i], "for build %d", i)
+	}
+	assert.Equal(t, files[0], files[2])
+	assert.Equal(t, files[0], files[4])
+	assert.Equal(t, files[1], files[3])
+	assert.NotEqual(t, files[0], files[1])
+
+	log, err := ioutil.ReadFile(filepath.Join(dir, "log"))
+	assert.Nil(t, err)
+	built := strings.Fields(string(log))
+	assert.ElementsMatch(t, []string{"ping", "hello"}, built)
+
+	assert.Nil(t, cache.Remove(context.Background(), ioutil.Discard))
+	for _, f := range files[:2] {
+		_, err := os.Stat(f)
+		assert.True(t, os.IsNotExist(err), "for file %v", f)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/unigornel/unigornel/integration_tests/console"
 	"github.com/unigornel/unigornel/integration_tests/tests"
 )
 
@@ -15,6 +16,7 @@ const category = "console"
 var SimpleTest = tests.SimpleTest{
 	Name:        "hello_world",
 	Category:    category,
+	Labels:      []string{tests.LabelNeedsRoot},
 	Package:     tests.SimpleTestPackage(category, "simple"),
 	Memory:      256,
 	Timeout:     10 * time.Second,
@@ -31,6 +33,7 @@ var SimpleTest = tests.SimpleTest{
 var SleepAndTimeTest = tests.SimpleTest{
 	Name:       "sleep_and_time",
 	Category:   category,
+	Labels:     []string{tests.LabelNeedsRoot},
 	Package:    tests.SimpleTestPackage(category, "sleep_and_time"),
 	Memory:     256,
 	Timeout:    2 * time.Second,
@@ -75,12 +78,16 @@ var SleepAndTimeTest = tests.SimpleTest{
 var ReadFromConsoleTest = tests.SimpleTest{
 	Name:        "read_from_console",
 	Category:    category,
+	Labels:      []string{tests.LabelNeedsRoot},
 	Package:     tests.SimpleTestPackage(category, "read_from_console"),
 	Memory:      256,
 	Timeout:     10 * time.Second,
 	CanCrash:    true,
 	CanShutdown: true,
-	Stdin:       []byte("Unigornel\n"),
+	Conversation: []console.Step{
+		{Expect: `what's your name\?`, Send: "Unigornel\n"},
+		{Expect: "Hello, Unigornel"},
+	},
 	CheckRun: func(out string) error {
 		if !strings.Contains(out, "Hello, what's your name? Hello, Unigornel") {
 			return fmt.Errorf("console output did not match")
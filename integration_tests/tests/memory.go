@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// MemoryTest is a test that knows how much memory its domains use.
+type MemoryTest interface {
+	// GetMemory returns the memory of the domains of the test in MiB.
+	GetMemory() int
+}
+
+// MemoryScheduler makes tests wait until the host has memory for their
+// domains. It is safe for concurrent use.
+type MemoryScheduler struct {
+	total int
+
+	mutex   sync.Mutex
+	free    int
+	changed chan struct{}
+}
+
+// NewMemoryScheduler creates a scheduler for a host with mib MiB of memory
+// that is free for domains.
+func NewMemoryScheduler(mib int) *MemoryScheduler {
+	return &MemoryScheduler{
+		total:   mib,
+		free:    mib,
+		changed: make(chan struct{}),
+	}
+}
+
+// Acquire waits until mib MiB are free and reserves them.
+func (s *MemoryScheduler) Acquire(ctx context.Context, mib int) error {
+	if mib > s.total {
+		return fmt.Errorf("test needs %d MiB, but the host has %d MiB", mib, s.total)
+	}
+
+	for {
+		s.mutex.Lock()
+		if mib <= s.free {
+			s.free -= mib
+			s.mutex.Unlock()
+			return nil
+		}
+		changed := s.changed
+		s.mutex.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Release frees memory that was reserved with Acquire.
+func (s *MemoryScheduler) Release(mib int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.free += mib
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// Free returns the memory that is not reserved, in MiB.
+func (s *MemoryScheduler) Free() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.free
+}
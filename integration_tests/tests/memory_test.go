@@ -0,0 +1,53 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryScheduler(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryScheduler(512)
+
+	require.Nil(t, s.Acquire(ctx, 256))
+	require.Nil(t, s.Acquire(ctx, 128))
+	assert.Equal(t, 128, s.Free())
+
+	acquired := make(chan error)
+	go func() {
+		acquired <- s.Acquire(ctx, 256)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("acquired memory that is in use")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	s.Release(256)
+	select {
+	case err := <-acquired:
+		assert.Nil(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("memory was not acquired after it was released")
+	}
+	assert.Equal(t, 128, s.Free())
+}
+
+func TestMemorySchedulerErrors(t *testing.T) {
+	s := NewMemoryScheduler(512)
+
+	err := s.Acquire(context.Background(), 1024)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "test needs 1024 MiB, but the host has 512 MiB", err.Error())
+	}
+
+	require.Nil(t, s.Acquire(context.Background(), 512))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, s.Acquire(ctx, 1))
+}
@@ -1,29 +1,39 @@
 package network
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
-	"os/exec"
 	"regexp"
+	"sync"
 	"time"
 
 	"github.com/unigornel/unigornel/integration_tests/brctl"
+	"github.com/unigornel/unigornel/integration_tests/console"
 	"github.com/unigornel/unigornel/integration_tests/ifconfig"
-	"github.com/unigornel/unigornel/integration_tests/ip"
 	"github.com/unigornel/unigornel/integration_tests/ping"
 	"github.com/unigornel/unigornel/integration_tests/tests"
 	"github.com/unigornel/unigornel/integration_tests/xen"
+	"github.com/unigornel/unigornel/unigornel/xl"
 )
 
 type PingTest struct {
+	// Hypervisor runs the domain. It defaults to xen.DefaultHypervisor.
+	Hypervisor xen.Hypervisor
+
+	// Timeout is the time the unikernel gets to answer the pings. It
+	// defaults to 10 seconds. NetworkTimeout is the time its network gets
+	// to come up, and defaults to Timeout.
+	Timeout        time.Duration
+	NetworkTimeout time.Duration
+
+	pack      string
 	unikernel string
 	domain    *xen.Domain
-	bridge    string
 	network   struct {
 		xenIP       net.IP
 		unikernelIP net.IP
@@ -32,6 +42,27 @@ type PingTest struct {
 	responses []ping.Response
 }
 
+func (t *PingTest) hypervisor() xen.Hypervisor {
+	if t.Hypervisor == nil {
+		return xen.DefaultHypervisor
+	}
+	return t.Hypervisor
+}
+
+func (t *PingTest) timeout() time.Duration {
+	if t.Timeout == 0 {
+		return 10 * time.Second
+	}
+	return t.Timeout
+}
+
+func (t *PingTest) networkTimeout() time.Duration {
+	if t.NetworkTimeout == 0 {
+		return t.timeout()
+	}
+	return t.NetworkTimeout
+}
+
 func (t *PingTest) GetName() string {
 	return "reply_to_ping"
 }
@@ -40,73 +71,132 @@ func (t *PingTest) GetCategory() string {
 	return "network"
 }
 
+func (t *PingTest) GetLabels() []string {
+	return []string{tests.LabelSlow, tests.LabelNeedsNetwork, tests.LabelNeedsRoot}
+}
+
 func (t *PingTest) GetInfo() string {
 	return `ENVIRONMENT:
     TEST_PING_NETWORK
-	    The network in CIDR style to use (default: 10.123.123.0/30).
-		The network must have room for at least 2 hosts (<=/30).
+	    The network in CIDR style to use (default: 10.123.123.0/24).
+		Every test gets a /30 subnet of it, so the network must have room
+		for at least 2 hosts (<=/30).
 `
 }
 
-func (t *PingTest) Build(w io.Writer) error {
-	if err := t.setupNetwork(w); err != nil {
-		return err
-	}
+// pingMemory is the memory of the domains of the ping tests, in MiB.
+const pingMemory = 256
+
+func (t *PingTest) GetMemory() int {
+	return pingMemory
+}
 
-	p := tests.SimpleTestPackage("network", "reply_to_ping")
+func (t *PingTest) Build(ctx context.Context, w io.Writer) error {
+	return t.build(ctx, w, tests.SimpleTestPackage("network", "reply_to_ping"))
+}
 
-	if err := tests.GoGet(w, p); err != nil {
+// build fetches and builds the unikernel of a ping test.
+func (t *PingTest) build(ctx context.Context, w io.Writer, pack string) error {
+	if err := tests.GoGet(ctx, w, pack); err != nil {
 		return err
 	}
 
-	if err := tests.UpdateLibs(w); err != nil {
+	if err := tests.UpdateLibs(ctx, w); err != nil {
 		return err
 	}
 
-	addr := t.network.unikernelIP.String()
-	netmask := net.IP(t.network.netmask).To4().String()
-	ldflags := fmt.Sprintf("-X main.ipAddress=%s -X main.ipNetmask=%s", addr, netmask)
-	file, err := tests.Build(w, "ping", p, "--ldflags", ldflags)
+	file, err := tests.Build(ctx, w, "ping", pack)
+	t.pack = pack
 	t.unikernel = file
 	return err
 }
 
-func (t *PingTest) setupNetwork(w io.Writer) error {
-	var ipnet *net.IPNet
-	var err error
-	if v := os.Getenv("TEST_PING_NETWORK"); v != "" {
+// args are the kernel arguments that configure the network of the
+// unikernel.
+func (t *PingTest) args() []string {
+	return []string{
+		"ip_address=" + t.network.unikernelIP.String(),
+		"ip_netmask=" + net.IP(t.network.netmask).To4().String(),
+	}
+}
+
+// subnets hands out the subnets of the ping tests, so that tests that run
+// in parallel do not share addresses.
+var subnets struct {
+	sync.Mutex
+	allocator *tests.SubnetAllocator
+}
+
+func subnetAllocator(w io.Writer) (*tests.SubnetAllocator, error) {
+	subnets.Lock()
+	defer subnets.Unlock()
+	if subnets.allocator != nil {
+		return subnets.allocator, nil
+	}
+
+	v := os.Getenv("TEST_PING_NETWORK")
+	if v != "" {
 		fmt.Fprintln(w, "[+] using network from TEST_PING_NETWORK:", v)
-		_, ipnet, err = net.ParseCIDR(v)
 	} else {
-		v = "10.123.123.0/30"
+		v = "10.123.123.0/24"
 		fmt.Fprintln(w, "[*] warning: using default network (collisions may fail the test):", v)
-		_, ipnet, err = net.ParseCIDR(v)
 	}
 
+	_, ipnet, err := net.ParseCIDR(v)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	ones, _ := ipnet.Mask.Size()
-	if ones > 30 {
-		return fmt.Errorf("invalid mask size: %v", ones)
+	a, err := tests.NewSubnetAllocator(ipnet, 30)
+	if err != nil {
+		return nil, err
 	}
+	subnets.allocator = a
+	return a, nil
+}
 
-	local := ipnet.IP.To4()
-	mask := net.IP(ipnet.Mask).To4()
-	if local == nil || mask == nil {
-		return fmt.Errorf("network is not an IPv4 network")
+func (t *PingTest) setupNetwork(ctx context.Context, w io.Writer) error {
+	a, err := subnetAllocator(w)
+	if err != nil {
+		return err
 	}
+
+	subnet, err := a.Allocate()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "[+] using subnet", subnet)
+	tests.RegistryFrom(ctx).Add("subnet", subnet.String(), func(context.Context) error {
+		a.Release(subnet)
+		return nil
+	})
+
+	// Copy the address: the subnet is released when the test ends.
+	local := append(net.IP(nil), subnet.IP.To4()...)
 	local[3] += 1
 	unikernel := net.IP([]byte{local[0], local[1], local[2], local[3] + 1})
 
 	t.network.xenIP = local
 	t.network.unikernelIP = unikernel
-	t.network.netmask = ipnet.Mask
+	t.network.netmask = subnet.Mask
 	return nil
 }
 
-func (t *PingTest) Setup(w io.Writer) error {
+func (t *PingTest) Setup(ctx context.Context, w io.Writer) error {
+	if err := t.setupNetwork(ctx, w); err != nil {
+		return err
+	}
+	return t.setup(ctx, w, t.GetName(), t.args())
+}
+
+// setup creates a bridge in the subnet of the test and a paused domain for
+// the unikernel with the arguments. The arguments depend on the subnet, so
+// setupNetwork comes first.
+func (t *PingTest) setup(ctx context.Context, w io.Writer, name string, args []string) error {
+	if err := tests.CheckArgs(t.pack, args); err != nil {
+		return err
+	}
+
 	// Setup the bridge.
 	fmt.Fprintln(w, "[+] creating a bridge")
 	bridge, err := brctl.CreateNumbered("unigornel")
@@ -114,7 +204,7 @@ func (t *PingTest) Setup(w io.Writer) error {
 		return err
 	}
 	fmt.Fprintln(w, "[+] using bridge", bridge)
-	t.bridge = bridge
+	tests.RegistryFrom(ctx).AddBridge(bridge)
 
 	fmt.Fprintln(w, "[+] using ip address", t.network.xenIP, "netmask", t.network.netmask)
 	if err := ifconfig.SetIP(bridge, t.network.xenIP, t.network.netmask); err != nil {
@@ -122,94 +212,64 @@ func (t *PingTest) Setup(w io.Writer) error {
 	}
 
 	// Create the unikernel
-	kernel := xen.Kernel{
+	extra, err := xl.JoinArgs(args)
+	if err != nil {
+		return err
+	}
+	kernel := xl.Kernel{
 		Binary:  t.unikernel,
-		Memory:  256,
-		Name:    t.GetName(),
-		OnCrash: xen.OnCrashPreserve,
-		VIF:     fmt.Sprintf("['bridge=%s']", bridge),
+		Memory:  pingMemory,
+		Name:    tests.RegistryFrom(ctx).Tag(name),
+		OnCrash: xl.ActionPreserve,
+		VIFs:    []xl.VIF{{Bridge: bridge}},
+		Extra:   extra,
 	}
 
 	fmt.Fprintln(w, "[+] creating paused kernel")
-	dom, err := kernel.CreatePausedUniqueName(func(cmd *exec.Cmd) {
-		cmd.Stdout = w
-		cmd.Stderr = w
-	})
+	dom, err := xen.CreatePausedUniqueName(ctx, t.hypervisor(), &kernel, w)
+	if err != nil {
+		return err
+	}
 	fmt.Fprintln(w, "[+] domain created:", dom)
+	tests.RegistryFrom(ctx).AddDomain(t.hypervisor(), dom)
 	t.domain = dom
-	return err
+	return nil
 }
 
-func (t *PingTest) Run(w io.Writer) error {
-	consoleBuffer := bytes.NewBuffer(nil)
-	pingBuffer := bytes.NewBuffer(nil)
+var networkReadyRegexp = regexp.MustCompile("network.*ready")
 
-	console := t.domain.Console()
-	console.Stdout = io.MultiWriter(w, consoleBuffer)
-	console.Stderr = io.MultiWriter(w, consoleBuffer)
-	_, err := console.StdinPipe()
-	if err != nil {
-		return err
-	}
+func (t *PingTest) Run(ctx context.Context, w io.Writer) error {
+	pingBuffer := bytes.NewBuffer(nil)
 
-	pingCmd := ping.Ping(t.network.unikernelIP.String(), "-c", "10", "-i", "0.5", "-W", "1")
+	pingCmd := ping.Ping(ctx, t.network.unikernelIP.String(), "-c", "10", "-i", "0.5", "-W", "1")
 	pingCmd.Stdout = io.MultiWriter(w, pingBuffer)
 	pingCmd.Stderr = w
 
-	fmt.Println(w, "[+] attaching to the console")
-	if err := console.Start(); err != nil {
+	hv := t.hypervisor()
+	fmt.Fprintln(w, "[+] attaching to the console")
+	con, err := console.Attach(ctx, hv, t.domain.ID, w)
+	if err != nil {
 		return err
 	}
 
-	done := make(chan struct{})
-	exited := make(chan error)
-	timeout := make(chan struct{})
-	networkReady := make(chan error)
-	pingReady := make(chan error)
+	done := con.Detached()
+	watch := xen.Watch(ctx, hv, t.domain.ID)
+	defer watch.Stop()
+	timer := time.NewTimer(t.timeout())
+	defer timer.Stop()
+	// The channels are buffered, so that the goroutines do not block
+	// forever when Run returns first.
+	networkReady := make(chan error, 1)
+	pingReady := make(chan error, 1)
 
-	waitForConsole := func() {
-		console.Wait()
-		close(done)
-	}
-	waitForTimeout := func() {
-		time.Sleep(10 * time.Second)
-		close(timeout)
-	}
-	checkDomainState := func() {
-		for {
-			select {
-			case <-done:
-				return
-			case <-timeout:
-				return
-			case <-time.After(1 * time.Second):
-				c, err := t.domain.Update()
-				if err != nil {
-					exited <- err
-					close(exited)
-					return
-				}
-				if c.State.Check(xen.DomainStateShutdown) || c.State.Check(xen.DomainStateCrashed) {
-					close(exited)
-					return
-				}
-			}
-		}
-	}
 	waitForReady := func() {
 		defer close(networkReady)
 		fmt.Fprintln(w, "[+] waiting for unikernel network setup")
-		scanner := bufio.NewScanner(consoleBuffer)
-		r := regexp.MustCompile("network.*ready")
-		for scanner.Scan() {
-			line := scanner.Text()
-			if r.MatchString(line) {
-				fmt.Fprintln(w, "[+] unikernel network is ready")
-				return
-			}
+		if _, err := con.Expect(networkReadyRegexp, t.networkTimeout()); err != nil {
+			networkReady <- err
+			return
 		}
-
-		networkReady <- scanner.Err()
+		fmt.Fprintln(w, "[+] unikernel network is ready")
 	}
 	waitForPing := func() {
 		defer close(pingReady)
@@ -239,44 +299,50 @@ func (t *PingTest) Run(w io.Writer) error {
 		t.responses = responses
 	}
 
-	go waitForConsole()
-	go waitForTimeout()
-	go checkDomainState()
 	go waitForReady()
 	go waitForPing()
 
 	fmt.Fprintln(w, "[+] unpausing unikernel domain")
-	if err := t.domain.Unpause().Run(); err != nil {
-		console.Process.Kill()
+	if err := hv.Unpause(ctx, t.domain.ID); err != nil {
+		con.Close()
 		return err
 	}
 
-	select {
-	case <-done:
-		return errors.New("console unexpectedly exited")
-	case err := <-exited:
-		// Make sure the console can catch up
-		time.Sleep(1 * time.Second)
-		console.Process.Kill()
-		if err != nil {
+	for {
+		select {
+		case <-ctx.Done():
+			con.Close()
+			return ctx.Err()
+		case <-done:
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return errors.New("console unexpectedly exited")
+		case e := <-watch.Events():
+			if e.Kind == xen.EventError {
+				con.Close()
+				return e.Err
+			}
+			if !e.Stopped() {
+				continue
+			}
+			fmt.Fprintln(w, "[+]", e)
+
+			// Make sure the console can catch up
+			err := tests.Sleep(ctx, 1*time.Second)
+			con.Close()
 			return err
-		}
-		<-done
-	case <-timeout:
-		console.Process.Kill()
-		<-done
-		return errors.New("test timeout")
-	case err := <-pingReady:
-		console.Process.Kill()
-		if err != nil {
+		case <-timer.C:
+			con.Close()
+			return errors.New("test timeout")
+		case err := <-pingReady:
+			con.Close()
 			return err
 		}
 	}
-
-	return nil
 }
 
-func (t *PingTest) Check(w io.Writer) error {
+func (t *PingTest) Check(ctx context.Context, w io.Writer) error {
 	if n := len(t.responses); n < 10 {
 		return fmt.Errorf("expected %d responses, got %d", 10, n)
 	}
@@ -290,26 +356,8 @@ func (t *PingTest) Check(w io.Writer) error {
 	return nil
 }
 
-func (t *PingTest) Clean(w io.Writer, success bool) (err error) {
-	if t.unikernel != "" {
-		fmt.Fprintf(w, "[+] removing %s\n", t.unikernel)
-		os.Remove(t.unikernel)
-	}
-
-	if t.domain != nil {
-		cmd := t.domain.Destroy()
-		cmd.Stderr = w
-		cmd.Stdout = w
-		err = cmd.Run()
-	}
-
-	if t.bridge != "" {
-		fmt.Fprintf(w, "[+] removing bridge %s\n", t.bridge)
-		err = ip.Down(t.bridge)
-		if err == nil {
-			err = brctl.Delete(t.bridge)
-		}
-	}
-
-	return
+// Clean does nothing: the unikernel, the domain, the bridge and the subnet
+// are removed by the registry of the test.
+func (t *PingTest) Clean(ctx context.Context, w io.Writer, success bool) error {
+	return nil
 }
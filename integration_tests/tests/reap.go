@@ -0,0 +1,274 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/unigornel/unigornel/integration_tests/brctl"
+	"github.com/unigornel/unigornel/integration_tests/xen"
+)
+
+// DefaultStateDir is where the journals of the runs are kept.
+var DefaultStateDir = filepath.Join(os.TempDir(), "unigornel-integration-tests")
+
+const journalExt = ".journal"
+
+// NewRunID returns a random ID for a run of the tests.
+func NewRunID() string {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// Journal records the resources of a run in a file while they exist, so
+// that they can be reaped when the run does not remove them. It is safe for
+// concurrent use.
+type Journal struct {
+	runID string
+	path  string
+
+	mutex       sync.Mutex
+	file        *os.File
+	outstanding map[string]int
+	err         error
+}
+
+// OpenJournal creates the journal of a run in dir.
+func OpenJournal(dir, runID string) (*Journal, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dir, runID+journalExt)
+	fh, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &Journal{
+		runID:       runID,
+		path:        path,
+		file:        fh,
+		outstanding: make(map[string]int),
+	}
+	j.write("pid %d\n", os.Getpid())
+	return j, j.err
+}
+
+// RunID returns the ID of the run.
+func (j *Journal) RunID() string {
+	return j.runID
+}
+
+func (j *Journal) add(kind, name string) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.outstanding[kind+" "+name]++
+	j.write("add %s %s\n", kind, name)
+}
+
+func (j *Journal) remove(kind, name string) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if j.outstanding[kind+" "+name]--; j.outstanding[kind+" "+name] <= 0 {
+		delete(j.outstanding, kind+" "+name)
+	}
+	j.write("remove %s %s\n", kind, name)
+}
+
+// write writes a line to the journal. The first error is kept.
+func (j *Journal) write(format string, args ...interface{}) {
+	if j.err != nil {
+		return
+	}
+	if _, err := fmt.Fprintf(j.file, format, args...); err != nil {
+		j.err = err
+		return
+	}
+	j.err = j.file.Sync()
+}
+
+// Close closes the journal. The file is removed, unless resources of the
+// run are left; then an error says so.
+func (j *Journal) Close() error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if err := j.file.Close(); err != nil && j.err == nil {
+		j.err = err
+	}
+	switch {
+	case j.err != nil:
+		return fmt.Errorf("journal %v: %v", j.path, j.err)
+	case len(j.outstanding) > 0:
+		return fmt.Errorf("%d resources of run %v are left", len(j.outstanding), j.runID)
+	}
+	return os.Remove(j.path)
+}
+
+// journalEntry is a journal that was read back.
+type journalEntry struct {
+	RunID     string
+	Path      string
+	PID       int
+	Resources []resource
+}
+
+func readJournal(path string) (*journalEntry, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	e := &journalEntry{
+		RunID: strings.TrimSuffix(filepath.Base(path), journalExt),
+		Path:  path,
+	}
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), " ", 3)
+		switch {
+		case len(parts) == 2 && parts[0] == "pid":
+			if e.PID, err = strconv.Atoi(parts[1]); err != nil {
+				return nil, fmt.Errorf("%v: invalid pid '%v'", path, parts[1])
+			}
+		case len(parts) == 3 && parts[0] == "add":
+			e.Resources = append(e.Resources, resource{Kind: parts[1], Name: parts[2]})
+		case len(parts) == 3 && parts[0] == "remove":
+			for i := len(e.Resources) - 1; i >= 0; i-- {
+				if e.Resources[i].Kind == parts[1] && e.Resources[i].Name == parts[2] {
+					e.Resources = append(e.Resources[:i], e.Resources[i+1:]...)
+					break
+				}
+			}
+		default:
+			return nil, fmt.Errorf("%v: invalid line: %v", path, scanner.Text())
+		}
+	}
+	return e, scanner.Err()
+}
+
+// running reports whether the process of a run is still running.
+func (e *journalEntry) running() bool {
+	if e.PID <= 0 {
+		return false
+	}
+	err := syscall.Kill(e.PID, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// taggedDomainRegexp matches the names of domains that were tagged with the
+// ID of a run. See Registry.Tag.
+var taggedDomainRegexp = regexp.MustCompile(`^kernel-.+-([0-9a-f]{8})-[0-9a-f]{8}$`)
+
+// Reap removes the resources that earlier runs left behind. It reads the
+// journals in dir of the runs that are no longer running, and destroys the
+// domains that are tagged with the ID of a run that is not running.
+func Reap(ctx context.Context, dir string, hv xen.Hypervisor, w io.Writer) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var first error
+	fail := func(err error) {
+		fmt.Fprintf(w, "[-] %v\n", err)
+		if first == nil {
+			first = err
+		}
+	}
+
+	running := make(map[string]bool)
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), journalExt) {
+			continue
+		}
+
+		e, err := readJournal(filepath.Join(dir, f.Name()))
+		if err != nil {
+			fail(err)
+			continue
+		}
+		if e.running() {
+			fmt.Fprintf(w, "[+] run %v is still running (pid %d)\n", e.RunID, e.PID)
+			running[e.RunID] = true
+			continue
+		}
+
+		fmt.Fprintf(w, "[+] reaping run %v\n", e.RunID)
+		ok := true
+		for i := len(e.Resources) - 1; i >= 0; i-- {
+			res := e.Resources[i]
+			fmt.Fprintf(w, "[+] removing %v %v\n", res.Kind, res.Name)
+			if err := reapResource(ctx, hv, res); err != nil {
+				fail(fmt.Errorf("could not remove %v %v: %v", res.Kind, res.Name, err))
+				ok = false
+			}
+		}
+		if ok {
+			if err := os.Remove(e.Path); err != nil {
+				fail(err)
+			}
+		}
+	}
+
+	domains, err := hv.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, d := range domains {
+		m := taggedDomainRegexp.FindStringSubmatch(d.Name)
+		if m == nil || running[m[1]] {
+			continue
+		}
+		fmt.Fprintf(w, "[+] destroying domain %v of run %v\n", d.Name, m[1])
+		if err := hv.Destroy(ctx, d.ID); err != nil {
+			fail(fmt.Errorf("could not destroy domain %v: %v", d.Name, err))
+		}
+	}
+	return first
+}
+
+// reapResource removes a resource of a journal. Resources that are gone
+// already are skipped.
+func reapResource(ctx context.Context, hv xen.Hypervisor, res resource) error {
+	switch res.Kind {
+	case ResourceDomain:
+		d, err := xen.DomainWithName(ctx, hv, res.Name)
+		if err != nil || d == nil {
+			return err
+		}
+		return hv.Destroy(ctx, d.ID)
+
+	case ResourceBridge:
+		bridges, err := brctl.Show()
+		if err != nil {
+			return err
+		}
+		for _, b := range bridges {
+			if b.Name == res.Name {
+				return removeBridge(res.Name)
+			}
+		}
+		return nil
+
+	case ResourceFile:
+		return removeFile(res.Name)
+	}
+	return fmt.Errorf("unknown kind of resource")
+}
@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unigornel/unigornel/integration_tests/xen"
+	"github.com/unigornel/unigornel/unigornel/xl"
+)
+
+// deadPID returns the process ID of a process that has ended.
+func deadPID(t *testing.T) int {
+	cmd := exec.Command("true")
+	require.Nil(t, cmd.Run())
+	return cmd.Process.Pid
+}
+
+func TestReap(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "unigornel-reap-")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	hv := xen.NewFakeHypervisor(nil)
+	create := func(name string) {
+		_, err := hv.Create(ctx, xl.Kernel{Name: name, Binary: fakeUnikernel, Memory: 32}, nil)
+		require.Nil(t, err)
+	}
+	create("kernel-dead-0000dead-00000001")
+	create("kernel-live-0000a11e-00000002")
+	create("kernel-lost-0000105e-00000003")
+	create("kernel-untagged-00000004")
+	create("other")
+
+	file, err := ioutil.TempFile(dir, "unikernel-")
+	require.Nil(t, err)
+	file.Close()
+
+	dead := fmt.Sprintf("pid %d\n", deadPID(t)) +
+		"add file " + file.Name() + "\n" +
+		"add domain kernel-dead-0000dead-00000001\n" +
+		"add file /nonexistent/removed\n" +
+		"remove file /nonexistent/removed\n"
+	live := fmt.Sprintf("pid %d\n", os.Getpid()) +
+		"add domain kernel-live-0000a11e-00000002\n"
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "0000dead.journal"), []byte(dead), 0644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "0000a11e.journal"), []byte(live), 0644))
+
+	var out bytes.Buffer
+	require.Nil(t, Reap(ctx, dir, hv, &out))
+
+	domains, err := hv.List(ctx)
+	require.Nil(t, err)
+	var names []string
+	for _, d := range domains {
+		names = append(names, d.Name)
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{"kernel-live-0000a11e-00000002", "kernel-untagged-00000004", "other"}, names)
+
+	_, err = os.Stat(file.Name())
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, "0000dead.journal"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, "0000a11e.journal"))
+	assert.Nil(t, err)
+
+	assert.Contains(t, out.String(), "[+] run 0000a11e is still running")
+	assert.Contains(t, out.String(), "[+] reaping run 0000dead")
+	assert.Contains(t, out.String(), "[+] destroying domain kernel-lost-0000105e-00000003 of run 0000105e")
+}
+
+func TestReapMissingDir(t *testing.T) {
+	hv := xen.NewFakeHypervisor(nil)
+	assert.Nil(t, Reap(context.Background(), "/nonexistent/state", hv, ioutil.Discard))
+}
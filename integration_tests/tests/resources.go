@@ -0,0 +1,149 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/unigornel/unigornel/integration_tests/brctl"
+	"github.com/unigornel/unigornel/integration_tests/ip"
+	"github.com/unigornel/unigornel/integration_tests/xen"
+)
+
+// Kinds of resources that are left on the host when they are not removed.
+// The journal records them, so that they can be reaped.
+const (
+	ResourceDomain = "domain"
+	ResourceBridge = "bridge"
+	ResourceFile   = "file"
+)
+
+// reapable reports whether resources of the kind can be reaped.
+func reapable(kind string) bool {
+	return kind == ResourceDomain || kind == ResourceBridge || kind == ResourceFile
+}
+
+type resource struct {
+	Kind   string
+	Name   string
+	Remove func(context.Context) error
+}
+
+// Registry records the resources that a test creates. They are removed in
+// reverse order when the test ends, however it ends. It is safe for
+// concurrent use.
+type Registry struct {
+	journal *Journal
+
+	mutex     sync.Mutex
+	resources []resource
+}
+
+// NewRegistry creates a registry. The reapable resources are recorded in
+// the journal, unless it is nil.
+func NewRegistry(journal *Journal) *Registry {
+	return &Registry{journal: journal}
+}
+
+// Add adds a resource that remove removes.
+func (r *Registry) Add(kind, name string, remove func(context.Context) error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.journal != nil && reapable(kind) {
+		r.journal.add(kind, name)
+	}
+	r.resources = append(r.resources, resource{kind, name, remove})
+}
+
+// AddFile adds a file.
+func (r *Registry) AddFile(path string) {
+	r.Add(ResourceFile, path, func(context.Context) error {
+		return removeFile(path)
+	})
+}
+
+// AddDomain adds a domain of the hypervisor.
+func (r *Registry) AddDomain(hv xen.Hypervisor, domain *xen.Domain) {
+	id := domain.ID
+	r.Add(ResourceDomain, domain.Name, func(ctx context.Context) error {
+		return hv.Destroy(ctx, id)
+	})
+}
+
+// AddBridge adds a network bridge.
+func (r *Registry) AddBridge(name string) {
+	r.Add(ResourceBridge, name, func(context.Context) error {
+		return removeBridge(name)
+	})
+}
+
+// Tag adds the ID of the run to a name, so that the reaper knows which run
+// created a resource with the name.
+func (r *Registry) Tag(name string) string {
+	if r.journal == nil {
+		return name
+	}
+	return name + "-" + r.journal.RunID()
+}
+
+// Teardown removes the resources, the last one first. It tries to remove
+// all of them and returns the first error.
+func (r *Registry) Teardown(ctx context.Context, w io.Writer) error {
+	var first error
+	for {
+		r.mutex.Lock()
+		n := len(r.resources)
+		if n == 0 {
+			r.mutex.Unlock()
+			return first
+		}
+		res := r.resources[n-1]
+		r.resources = r.resources[:n-1]
+		r.mutex.Unlock()
+
+		fmt.Fprintf(w, "[+] removing %v %v\n", res.Kind, res.Name)
+		if err := res.Remove(ctx); err != nil {
+			fmt.Fprintf(w, "[-] could not remove %v %v: %v\n", res.Kind, res.Name, err)
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		if r.journal != nil && reapable(res.Kind) {
+			r.journal.remove(res.Kind, res.Name)
+		}
+	}
+}
+
+type registryKey struct{}
+
+// WithRegistry returns a context that carries the registry of a test.
+func WithRegistry(ctx context.Context, r *Registry) context.Context {
+	return context.WithValue(ctx, registryKey{}, r)
+}
+
+// RegistryFrom returns the registry of a test. Without one, the resources
+// are added to a registry that is never torn down.
+func RegistryFrom(ctx context.Context) *Registry {
+	if r, ok := ctx.Value(registryKey{}).(*Registry); ok {
+		return r
+	}
+	return NewRegistry(nil)
+}
+
+func removeFile(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func removeBridge(name string) error {
+	if err := ip.Down(name); err != nil {
+		return err
+	}
+	return brctl.Delete(name)
+}
@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryTeardown(t *testing.T) {
+	r := NewRegistry(nil)
+
+	var removed []string
+	add := func(name string, err error) {
+		r.Add("thing", name, func(context.Context) error {
+			removed = append(removed, name)
+			return err
+		})
+	}
+	add("a", nil)
+	add("b", errors.New("b is stuck"))
+	add("c", errors.New("c is stuck"))
+	add("d", nil)
+
+	err := r.Teardown(context.Background(), ioutil.Discard)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "c is stuck", err.Error())
+	}
+	assert.Equal(t, []string{"d", "c", "b", "a"}, removed)
+
+	removed = nil
+	assert.Nil(t, r.Teardown(context.Background(), ioutil.Discard))
+	assert.Empty(t, removed)
+}
+
+func TestRegistryFrom(t *testing.T) {
+	r := NewRegistry(nil)
+	assert.True(t, r == RegistryFrom(WithRegistry(context.Background(), r)))
+	assert.NotNil(t, RegistryFrom(context.Background()))
+}
+
+func TestJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unigornel-journal-")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	j, err := OpenJournal(dir, "0123abcd")
+	require.Nil(t, err)
+	r := NewRegistry(j)
+	assert.Equal(t, "hello-0123abcd", r.Tag("hello"))
+
+	failing := errors.New("stuck")
+	r.AddFile("/nonexistent/unikernel")
+	r.Add(ResourceDomain, "kernel-hello-0123abcd-00000001", func(context.Context) error {
+		return failing
+	})
+	r.Add("memory", "256 MiB", func(context.Context) error {
+		return nil
+	})
+	assert.Equal(t, failing, r.Teardown(context.Background(), ioutil.Discard))
+
+	// The domain is left, so the journal is kept.
+	err = j.Close()
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "1 resources of run 0123abcd are left", err.Error())
+	}
+	e, err := readJournal(filepath.Join(dir, "0123abcd.journal"))
+	require.Nil(t, err)
+	assert.Equal(t, "0123abcd", e.RunID)
+	assert.Equal(t, os.Getpid(), e.PID)
+	if assert.Len(t, e.Resources, 1) {
+		assert.Equal(t, ResourceDomain, e.Resources[0].Kind)
+		assert.Equal(t, "kernel-hello-0123abcd-00000001", e.Resources[0].Name)
+	}
+
+	_, err = OpenJournal(dir, "0123abcd")
+	assert.NotNil(t, err)
+
+	j, err = OpenJournal(dir, "4567abcd")
+	require.Nil(t, err)
+	r = NewRegistry(j)
+	r.AddFile("/nonexistent/unikernel")
+	require.Nil(t, r.Teardown(context.Background(), ioutil.Discard))
+	require.Nil(t, j.Close())
+	_, err = os.Stat(filepath.Join(dir, "4567abcd.journal"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestNewRunID(t *testing.T) {
+	id := NewRunID()
+	assert.Len(t, id, 8)
+	assert.Equal(t, strings.ToLower(id), id)
+	assert.NotEqual(t, id, NewRunID())
+}
@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Labels of tests.
+const (
+	LabelSlow         = "slow"
+	LabelNeedsNetwork = "needs-network"
+	LabelNeedsRoot    = "needs-root"
+)
+
+// LabeledTest is a test with labels.
+type LabeledTest interface {
+	GetLabels() []string
+}
+
+// Labels returns the labels of a test.
+func Labels(t Test) []string {
+	if lt, ok := t.(LabeledTest); ok {
+		return lt.GetLabels()
+	}
+	return nil
+}
+
+// HasLabel reports whether a test has a label.
+func HasLabel(t Test, label string) bool {
+	for _, l := range Labels(t) {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// Selector selects tests. Every part of the selector that is set must
+// match; a part matches if any of its values matches.
+type Selector struct {
+	// Run selects the tests whose name matches an expression.
+	Run []*regexp.Regexp
+
+	// Skip excludes the tests whose name matches an expression.
+	Skip []*regexp.Regexp
+
+	// Categories selects the tests in a category.
+	Categories []string
+
+	// Labels selects the tests with a label. A label that starts with !
+	// excludes the tests with that label instead.
+	Labels []string
+}
+
+// Match reports whether the selector selects a test.
+func (s Selector) Match(t Test) bool {
+	name := t.GetName()
+	if len(s.Run) > 0 && !matchAny(s.Run, name) {
+		return false
+	}
+	if matchAny(s.Skip, name) {
+		return false
+	}
+
+	if len(s.Categories) > 0 {
+		found := false
+		for _, c := range s.Categories {
+			found = found || c == t.GetCategory()
+		}
+		if !found {
+			return false
+		}
+	}
+
+	wanted, found := false, false
+	for _, l := range s.Labels {
+		if strings.HasPrefix(l, "!") {
+			if HasLabel(t, l[1:]) {
+				return false
+			}
+			continue
+		}
+		wanted = true
+		found = found || HasLabel(t, l)
+	}
+	return !wanted || found
+}
+
+// Select returns the tests that the selector selects, in order.
+func (s Selector) Select(ts []Test) []Test {
+	var selected []Test
+	for _, t := range ts {
+		if s.Match(t) {
+			selected = append(selected, t)
+		}
+	}
+	return selected
+}
+
+func matchAny(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
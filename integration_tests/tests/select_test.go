@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelector(t *testing.T) {
+	ts := []Test{
+		&SimpleTest{Name: "hello_world", Category: "console", Labels: []string{LabelNeedsRoot}},
+		&SimpleTest{Name: "sleep_and_time", Category: "console", Labels: []string{LabelNeedsRoot, LabelSlow}},
+		&SimpleTest{Name: "reply_to_ping", Category: "network", Labels: []string{LabelNeedsRoot, LabelNeedsNetwork}},
+		&SimpleTest{Name: "ping_address", Category: "network", Labels: []string{LabelNeedsRoot, LabelNeedsNetwork, LabelSlow}},
+		&SimpleTest{Name: "unlabeled", Category: "other"},
+	}
+
+	type test struct {
+		Selector Selector
+		Names    []string
+	}
+
+	res := func(exprs ...string) []*regexp.Regexp {
+		var rs []*regexp.Regexp
+		for _, e := range exprs {
+			rs = append(rs, regexp.MustCompile(e))
+		}
+		return rs
+	}
+
+	tests := []test{
+		{
+			Selector: Selector{},
+			Names:    []string{"hello_world", "sleep_and_time", "reply_to_ping", "ping_address", "unlabeled"},
+		},
+		{
+			Selector: Selector{Run: res("ping")},
+			Names:    []string{"reply_to_ping", "ping_address"},
+		},
+		{
+			Selector: Selector{Run: res("^hello", "^ping")},
+			Names:    []string{"hello_world", "ping_address"},
+		},
+		{
+			Selector: Selector{Skip: res("ping", "time")},
+			Names:    []string{"hello_world", "unlabeled"},
+		},
+		{
+			Selector: Selector{Categories: []string{"network", "other"}},
+			Names:    []string{"reply_to_ping", "ping_address", "unlabeled"},
+		},
+		{
+			Selector: Selector{Labels: []string{LabelSlow}},
+			Names:    []string{"sleep_and_time", "ping_address"},
+		},
+		{
+			Selector: Selector{Labels: []string{"!" + LabelSlow, "!" + LabelNeedsNetwork}},
+			Names:    []string{"hello_world", "unlabeled"},
+		},
+		{
+			Selector: Selector{Labels: []string{LabelNeedsNetwork, "!" + LabelSlow}},
+			Names:    []string{"reply_to_ping"},
+		},
+		{
+			Selector: Selector{Run: res("_"), Categories: []string{"console"}, Skip: res("sleep")},
+			Names:    []string{"hello_world"},
+		},
+	}
+
+	for i, test := range tests {
+		var names []string
+		for _, t := range test.Selector.Select(ts) {
+			names = append(names, t.GetName())
+		}
+		assert.Equal(t, test.Names, names, "for test %d", i)
+	}
+}
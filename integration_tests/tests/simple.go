@@ -1,24 +1,27 @@
 package tests
 
 import (
-	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
-	"os"
-	"os/exec"
 	"path"
+	"strings"
 	"time"
 
+	"github.com/unigornel/unigornel/integration_tests/console"
 	"github.com/unigornel/unigornel/integration_tests/xen"
+	"github.com/unigornel/unigornel/unigornel/xl"
 )
 
 type SimpleTest struct {
 	Name        string
 	Category    string
 	Info        string
+	Labels      []string
 	Package     string
 	Memory      int
+	Args        []string
 	Stdin       []byte
 	Timeout     time.Duration
 	CanCrash    bool
@@ -26,12 +29,22 @@ type SimpleTest struct {
 	CanTimeout  bool
 	CheckRun    func(string) error
 
+	// Conversation is held with the console after the domain is unpaused.
+	Conversation []console.Step
+
+	// Hypervisor runs the domain. It defaults to xen.DefaultHypervisor.
+	Hypervisor xen.Hypervisor
+
 	unikernel  string
 	domain     *xen.Domain
 	didTimeout bool
 	output     string
 }
 
+// consoleCatchUp is the time that the console gets to catch up after the
+// domain stopped.
+var consoleCatchUp = 1 * time.Second
+
 func SimpleTestPackage(arg ...string) string {
 	s := append([]string{"github.com/unigornel/unigornel/integration_tests/tests"}, arg...)
 	return path.Join(s...)
@@ -49,115 +62,156 @@ func (t *SimpleTest) GetInfo() string {
 	return t.Info
 }
 
-func (t *SimpleTest) Build(w io.Writer) error {
-	file, err := Build(w, t.Name, t.Package)
+func (t *SimpleTest) GetLabels() []string {
+	return t.Labels
+}
+
+func (t *SimpleTest) GetMemory() int {
+	return t.Memory
+}
+
+func (t *SimpleTest) hypervisor() xen.Hypervisor {
+	if t.Hypervisor == nil {
+		return xen.DefaultHypervisor
+	}
+	return t.Hypervisor
+}
+
+func (t *SimpleTest) Build(ctx context.Context, w io.Writer) error {
+	file, err := Build(ctx, w, t.Name, t.Package)
 	t.unikernel = file
 	return err
 }
 
-func (t *SimpleTest) Setup(w io.Writer) error {
-	kernel := xen.Kernel{
+func (t *SimpleTest) Setup(ctx context.Context, w io.Writer) error {
+	if err := CheckArgs(t.Package, t.Args); err != nil {
+		return err
+	}
+
+	kernel := xl.Kernel{
 		Binary:  t.unikernel,
 		Memory:  t.Memory,
-		Name:    t.Name,
-		OnCrash: xen.OnCrashPreserve,
+		Name:    RegistryFrom(ctx).Tag(t.Name),
+		OnCrash: xl.ActionPreserve,
+		Extra:   strings.Join(t.Args, " "),
 	}
 
 	fmt.Fprintln(w, "[+] creating paused kernel")
-	dom, err := kernel.CreatePausedUniqueName(func(cmd *exec.Cmd) {
-		cmd.Stdout = w
-		cmd.Stderr = w
-	})
+	dom, err := xen.CreatePausedUniqueName(ctx, t.hypervisor(), &kernel, w)
+	if err != nil {
+		return err
+	}
 	fmt.Fprintln(w, "[+] domain created:", dom)
+	RegistryFrom(ctx).AddDomain(t.hypervisor(), dom)
 	t.domain = dom
-	return err
+	return nil
 }
 
-func (t *SimpleTest) Run(w io.Writer) error {
-	out := bytes.NewBuffer(nil)
-	console := t.domain.Console()
-	console.Stdout = io.MultiWriter(w, out)
-	console.Stderr = console.Stdout
-	stdin, err := console.StdinPipe()
-	if err != nil {
-		return err
-	}
+func (t *SimpleTest) Run(ctx context.Context, w io.Writer) error {
+	hv := t.hypervisor()
 
-	fmt.Fprintln(w, "[+] attching to the console")
-	if err := console.Start(); err != nil {
+	fmt.Fprintln(w, "[+] attaching to the console")
+	con, err := console.Attach(ctx, hv, t.domain.ID, w)
+	if err != nil {
 		return err
 	}
+	done := con.Detached()
 
 	if t.Stdin != nil {
 		fmt.Fprintln(w, "[+] writing to console")
-		if _, err := stdin.Write(t.Stdin); err != nil {
+		if err := con.Send(string(t.Stdin)); err != nil {
+			con.Close()
 			return err
 		}
 	}
 
-	done := make(chan struct{})
-	exited := make(chan error)
-	timeout := make(chan struct{})
-	go func() {
-		console.Wait()
-		close(done)
-	}()
-	go func() {
-		for {
-			select {
-			case <-done:
-				return
-			case <-timeout:
-				return
-			case <-time.After(1 * time.Second):
-				c, err := t.domain.Update()
-				if err != nil {
-					exited <- err
-					close(exited)
-					return
-				}
-				if c.State.Check(xen.DomainStateShutdown) || c.State.Check(xen.DomainStateCrashed) {
-					close(exited)
-					return
-				}
-			}
-		}
-	}()
-	go func() {
-		time.Sleep(t.Timeout)
-		close(timeout)
-	}()
+	watch := xen.Watch(ctx, hv, t.domain.ID)
+	defer watch.Stop()
+	events := watch.Events()
+
+	timer := time.NewTimer(t.Timeout)
+	defer timer.Stop()
 
 	fmt.Fprintln(w, "[+] unpausing unikernel domain")
-	if err := t.domain.Unpause().Run(); err != nil {
-		console.Process.Kill()
+	if err := hv.Unpause(ctx, t.domain.ID); err != nil {
+		con.Close()
 		return err
 	}
 
-	select {
-	case <-done:
-		return errors.New("console unexpectedly exited")
-	case err := <-exited:
-		// Make sure the console can catch up
-		time.Sleep(1 * time.Second)
-		console.Process.Kill()
-		if err != nil {
-			return err
+	var conversation chan error
+	if t.Conversation != nil {
+		conversation = make(chan error, 1)
+		go func() {
+			conversation <- con.Converse(t.Conversation)
+		}()
+	}
+
+	for running := true; running; {
+		select {
+		case <-ctx.Done():
+			con.Close()
+			t.output = con.Transcript()
+			return ctx.Err()
+		case <-done:
+			t.output = con.Transcript()
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return errors.New("console unexpectedly exited")
+		case err := <-conversation:
+			if err != nil {
+				con.Close()
+				t.output = con.Transcript()
+				return fmt.Errorf("conversation failed: %v", err)
+			}
+			fmt.Fprintln(w, "[+] conversation finished")
+			conversation = nil
+		case e := <-events:
+			if e.Kind == xen.EventError {
+				con.Close()
+				return e.Err
+			}
+			if e.Kind == xen.EventDestroyed {
+				con.Close()
+				return errors.New("domain disappeared")
+			}
+			if !e.Stopped() {
+				continue
+			}
+			fmt.Fprintln(w, "[+]", e)
+
+			// Make sure the console can catch up
+			if err := Sleep(ctx, consoleCatchUp); err != nil {
+				con.Close()
+				t.output = con.Transcript()
+				return err
+			}
+			con.Close()
+			t.didTimeout = false
+			running = false
+		case <-timer.C:
+			t.didTimeout = true
+			con.Close()
+			running = false
+		}
+	}
+	t.output = con.Transcript()
+
+	if conversation != nil {
+		// The conversation ends when the console detached.
+		if err := <-conversation; err != nil {
+			return fmt.Errorf("conversation failed: %v", err)
 		}
-		t.didTimeout = false
-		<-done
-	case <-timeout:
-		t.didTimeout = true
-		console.Process.Kill()
-		<-done
 	}
-	t.output = string(out.Bytes())
 
 	if t.didTimeout && !t.CanTimeout {
 		return errors.New("unikernel timed out")
 	}
 
-	domain, err := t.domain.Update()
+	domain, err := xen.DomainWithID(ctx, hv, t.domain.ID)
+	if err == nil && domain == nil {
+		err = errors.New("domain disappeared")
+	}
 	if err != nil {
 		return errors.New("domain not preserved: " + err.Error())
 	}
@@ -172,7 +226,7 @@ func (t *SimpleTest) Run(w io.Writer) error {
 	return nil
 }
 
-func (t *SimpleTest) Check(w io.Writer) error {
+func (t *SimpleTest) Check(ctx context.Context, w io.Writer) error {
 	if t.CheckRun == nil {
 		fmt.Fprintln(w, "[+] no output checks specified")
 		return nil
@@ -185,18 +239,8 @@ func (t *SimpleTest) Check(w io.Writer) error {
 	return nil
 }
 
-func (t *SimpleTest) Clean(w io.Writer, success bool) (err error) {
-	if t.unikernel != "" {
-		fmt.Fprintf(w, "[+] removing %s\n", t.unikernel)
-		os.Remove(t.unikernel)
-	}
-
-	if t.domain != nil {
-		cmd := t.domain.Destroy()
-		cmd.Stderr = w
-		cmd.Stdout = w
-		err = cmd.Run()
-	}
-
-	return
+// Clean does nothing: the unikernel and the domain are removed by the
+// registry of the test.
+func (t *SimpleTest) Clean(ctx context.Context, w io.Writer, success bool) error {
+	return nil
 }
@@ -0,0 +1,220 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unigornel/unigornel/integration_tests/console"
+	"github.com/unigornel/unigornel/integration_tests/xen"
+	"github.com/unigornel/unigornel/unigornel/xl"
+)
+
+// fakeUnikernel is the binary of the domains of the fake hypervisor.
+const fakeUnikernel = "/nonexistent/unikernel"
+
+func init() {
+	xen.WatchMinInterval = 5 * time.Millisecond
+	xen.WatchMaxInterval = 10 * time.Millisecond
+	consoleCatchUp = 10 * time.Millisecond
+}
+
+func TestSimpleTestRun(t *testing.T) {
+	type test struct {
+		Test   SimpleTest
+		Steps  []xen.FakeStep
+		Error  string
+		Output string
+	}
+
+	tests := []test{
+		{
+			Test:   SimpleTest{CanShutdown: true},
+			Steps:  []xen.FakeStep{{Output: "hello\n", State: xen.DomainStateShutdown}},
+			Output: "hello\n",
+		},
+		{
+			Test:   SimpleTest{},
+			Steps:  []xen.FakeStep{{Output: "hello\n", State: xen.DomainStateShutdown}},
+			Error:  "domain shutdown",
+			Output: "hello\n",
+		},
+		{
+			Test:  SimpleTest{CanShutdown: true},
+			Steps: []xen.FakeStep{{After: 20 * time.Millisecond, State: xen.DomainStateCrashed}},
+			Error: "domain crashed",
+		},
+		{
+			Test:  SimpleTest{CanCrash: true},
+			Steps: []xen.FakeStep{{State: xen.DomainStateCrashed}},
+		},
+		{
+			Test:   SimpleTest{Timeout: 50 * time.Millisecond},
+			Steps:  []xen.FakeStep{{Output: "waiting\n"}},
+			Error:  "unikernel timed out",
+			Output: "waiting\n",
+		},
+		{
+			Test:   SimpleTest{Timeout: 50 * time.Millisecond, CanTimeout: true},
+			Steps:  []xen.FakeStep{{Output: "waiting\n"}},
+			Output: "waiting\n",
+		},
+		{
+			Test: SimpleTest{Stdin: []byte("ping\n"), CanShutdown: true},
+			Steps: []xen.FakeStep{
+				{Output: "ready\n"},
+				{Input: "ping\n", Output: "pong\n", State: xen.DomainStateShutdown},
+			},
+			Output: "ready\npong\n",
+		},
+		{
+			Test: SimpleTest{
+				CanShutdown: true,
+				Conversation: []console.Step{
+					{Expect: "name\\? ", Send: "Unigornel\n"},
+					{Expect: "Hello, Unigornel"},
+				},
+			},
+			Steps: []xen.FakeStep{
+				{Output: "name? "},
+				{Input: "Unigornel\n", Output: "Hello, Unigornel\n", State: xen.DomainStateShutdown},
+			},
+			Output: "name? Hello, Unigornel\n",
+		},
+		{
+			Test: SimpleTest{
+				CanShutdown: true,
+				Conversation: []console.Step{
+					{Expect: "name\\? ", Send: "Unigornel\n"},
+					{Expect: "Hello, Unigornel"},
+				},
+			},
+			Steps:  []xen.FakeStep{{Output: "name? Goodbye\n", State: xen.DomainStateShutdown}},
+			Error:  "conversation failed: step 1: console detached",
+			Output: "name? Goodbye\n",
+		},
+		{
+			Test: SimpleTest{
+				CanShutdown:  true,
+				Conversation: []console.Step{{Expect: "ready", Timeout: 20 * time.Millisecond}},
+			},
+			Steps:  []xen.FakeStep{{Output: "booting\n"}},
+			Error:  "conversation failed: step 0: timed out after 20ms waiting for 'ready'",
+			Output: "booting\n",
+		},
+	}
+
+	for i, test := range tests {
+		hv := xen.NewFakeHypervisor(func(xl.Kernel) []xen.FakeStep {
+			return test.Steps
+		})
+		st := test.Test
+		st.Name = "test"
+		st.Memory = 32
+		st.Hypervisor = hv
+		st.unikernel = fakeUnikernel
+		if st.Timeout == 0 {
+			st.Timeout = 10 * time.Second
+		}
+
+		registry := NewRegistry(nil)
+		ctx := WithRegistry(context.Background(), registry)
+		require.Nil(t, st.Setup(ctx, ioutil.Discard), "for test %d", i)
+		err := st.Run(ctx, ioutil.Discard)
+		if test.Error == "" {
+			assert.Nil(t, err, "for test %d", i)
+		} else if assert.NotNil(t, err, "for test %d", i) {
+			assert.Equal(t, test.Error, err.Error(), "for test %d", i)
+		}
+		assert.Equal(t, test.Output, st.output, "for test %d", i)
+
+		require.Nil(t, st.Clean(ctx, ioutil.Discard, err == nil), "for test %d", i)
+		require.Nil(t, registry.Teardown(ctx, ioutil.Discard), "for test %d", i)
+		domains, err := hv.List(ctx)
+		require.Nil(t, err, "for test %d", i)
+		assert.Empty(t, domains, "for test %d", i)
+	}
+}
+
+func TestSimpleTestSetup(t *testing.T) {
+	ctx := context.Background()
+	hv := xen.NewFakeHypervisor(nil)
+	st := SimpleTest{Name: "hello", Memory: 32, Args: []string{"a=1", "b=2"}, Hypervisor: hv}
+	st.unikernel = fakeUnikernel
+
+	var kernel xl.Kernel
+	hv.Script = func(k xl.Kernel) []xen.FakeStep {
+		kernel = k
+		return nil
+	}
+
+	require.Nil(t, st.Setup(ctx, ioutil.Discard))
+	assert.True(t, strings.HasPrefix(kernel.Name, "kernel-hello-"))
+	assert.Equal(t, 32, kernel.Memory)
+	assert.Equal(t, "a=1 b=2", kernel.Extra)
+	assert.Equal(t, xl.ActionPreserve, kernel.OnCrash)
+
+	d, err := xen.DomainWithID(ctx, hv, st.domain.ID)
+	require.Nil(t, err)
+	require.NotNil(t, d)
+	assert.True(t, d.State.Check(xen.DomainStatePaused))
+}
+
+func TestSimpleTestCheck(t *testing.T) {
+	ctx := WithRegistry(context.Background(), NewRegistry(nil))
+	hv := xen.NewFakeHypervisor(func(xl.Kernel) []xen.FakeStep {
+		return []xen.FakeStep{{Output: "Hello, world!\n", State: xen.DomainStateShutdown}}
+	})
+	st := SimpleTest{
+		Name:        "hello",
+		Memory:      32,
+		Timeout:     10 * time.Second,
+		CanShutdown: true,
+		Hypervisor:  hv,
+		CheckRun: func(out string) error {
+			if !strings.Contains(out, "Hello, world!") {
+				return errors.New("no greeting")
+			}
+			return nil
+		},
+	}
+
+	st.unikernel = fakeUnikernel
+	require.Nil(t, st.Setup(ctx, ioutil.Discard))
+	require.Nil(t, st.Run(ctx, ioutil.Discard))
+	assert.Nil(t, st.Check(ctx, ioutil.Discard))
+	require.Nil(t, st.Clean(ctx, ioutil.Discard, true))
+	require.Nil(t, RegistryFrom(ctx).Teardown(ctx, ioutil.Discard))
+
+	st.output = "Goodbye"
+	assert.NotNil(t, st.Check(ctx, ioutil.Discard))
+}
+
+func TestSimpleTestRunCancel(t *testing.T) {
+	hv := xen.NewFakeHypervisor(func(xl.Kernel) []xen.FakeStep {
+		return []xen.FakeStep{{Output: "waiting\n", State: xen.DomainStateBlocked}}
+	})
+	st := SimpleTest{Name: "hang", Memory: 32, Timeout: 10 * time.Second, Hypervisor: hv}
+	st.unikernel = fakeUnikernel
+
+	registry := NewRegistry(nil)
+	ctx, cancel := context.WithTimeout(WithRegistry(context.Background(), registry), 50*time.Millisecond)
+	defer cancel()
+
+	require.Nil(t, st.Setup(ctx, ioutil.Discard))
+	start := time.Now()
+	err := st.Run(ctx, ioutil.Discard)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(start) < 5*time.Second)
+
+	require.Nil(t, st.Clean(context.Background(), ioutil.Discard, false))
+	require.Nil(t, registry.Teardown(context.Background(), ioutil.Discard))
+	domains, err := hv.List(context.Background())
+	require.Nil(t, err)
+	assert.Empty(t, domains)
+}
@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// SubnetAllocator hands out subnets of a network that do not overlap. It is
+// safe for concurrent use.
+type SubnetAllocator struct {
+	network *net.IPNet
+	ones    int
+
+	mutex sync.Mutex
+	used  map[uint32]bool
+}
+
+// NewSubnetAllocator splits an IPv4 network into subnets with a prefix of
+// ones bits.
+func NewSubnetAllocator(network *net.IPNet, ones int) (*SubnetAllocator, error) {
+	ip := network.IP.To4()
+	networkOnes, bits := network.Mask.Size()
+	if ip == nil || bits != 32 {
+		return nil, fmt.Errorf("network %v is not an IPv4 network", network)
+	}
+	if ones < networkOnes || ones > 32 {
+		return nil, fmt.Errorf("network %v has no /%d subnets", network, ones)
+	}
+
+	return &SubnetAllocator{
+		network: &net.IPNet{IP: ip.Mask(network.Mask), Mask: network.Mask},
+		ones:    ones,
+		used:    make(map[uint32]bool),
+	}, nil
+}
+
+// Allocate returns a subnet that is not in use.
+func (a *SubnetAllocator) Allocate() (*net.IPNet, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	networkOnes, _ := a.network.Mask.Size()
+	base := binary.BigEndian.Uint32(a.network.IP)
+	size := uint64(1) << uint(32-a.ones)
+	count := uint64(1) << uint(a.ones-networkOnes)
+
+	for i := uint64(0); i < count; i++ {
+		start := base + uint32(i*size)
+		if a.used[start] {
+			continue
+		}
+		a.used[start] = true
+
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, start)
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(a.ones, 32)}, nil
+	}
+	return nil, fmt.Errorf("no free /%d subnets in %v", a.ones, a.network)
+}
+
+// Release returns a subnet to the allocator. Any address in the subnet
+// identifies it.
+func (a *SubnetAllocator) Release(subnet *net.IPNet) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	start := subnet.IP.To4().Mask(net.CIDRMask(a.ones, 32))
+	delete(a.used, binary.BigEndian.Uint32(start))
+}
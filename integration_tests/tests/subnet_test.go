@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubnetAllocator(t *testing.T) {
+	_, network, err := net.ParseCIDR("10.123.123.0/28")
+	require.Nil(t, err)
+
+	a, err := NewSubnetAllocator(network, 30)
+	require.Nil(t, err)
+
+	var subnets []string
+	for i := 0; i < 4; i++ {
+		s, err := a.Allocate()
+		require.Nil(t, err, "for subnet %d", i)
+		subnets = append(subnets, s.String())
+	}
+	assert.Equal(t, []string{
+		"10.123.123.0/30",
+		"10.123.123.4/30",
+		"10.123.123.8/30",
+		"10.123.123.12/30",
+	}, subnets)
+
+	_, err = a.Allocate()
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "no free /30 subnets in 10.123.123.0/28", err.Error())
+	}
+
+	_, released, _ := net.ParseCIDR("10.123.123.4/30")
+	a.Release(released)
+	s, err := a.Allocate()
+	require.Nil(t, err)
+	assert.Equal(t, "10.123.123.4/30", s.String())
+
+	// A caller that changed the address in place still releases the
+	// subnet.
+	s.IP[3]++
+	a.Release(s)
+	s, err = a.Allocate()
+	require.Nil(t, err)
+	assert.Equal(t, "10.123.123.4/30", s.String())
+}
+
+func TestNewSubnetAllocatorErrors(t *testing.T) {
+	type test struct {
+		Network string
+		Ones    int
+		Error   string
+	}
+
+	tests := []test{
+		{"10.123.123.0/30", 30, ""},
+		{"10.123.123.0/31", 30, "network 10.123.123.0/31 has no /30 subnets"},
+		{"10.123.123.0/24", 33, "network 10.123.123.0/24 has no /33 subnets"},
+		{"fd00::/64", 126, "network fd00::/64 is not an IPv4 network"},
+	}
+
+	for i, test := range tests {
+		_, network, err := net.ParseCIDR(test.Network)
+		require.Nil(t, err, "for test %d", i)
+
+		_, err = NewSubnetAllocator(network, test.Ones)
+		if test.Error == "" {
+			assert.Nil(t, err, "for test %d", i)
+		} else if assert.NotNil(t, err, "for test %d", i) {
+			assert.Equal(t, test.Error, err.Error(), "for test %d", i)
+		}
+	}
+}
@@ -2,9 +2,11 @@ package tests
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/unigornel/unigornel/integration_tests/junit"
@@ -14,11 +16,55 @@ type Test interface {
 	GetName() string
 	GetCategory() string
 	GetInfo() string
-	Build(io.Writer) error
-	Setup(io.Writer) error
-	Run(io.Writer) error
-	Check(io.Writer) error
-	Clean(w io.Writer, success bool) error
+	Build(context.Context, io.Writer) error
+	Setup(context.Context, io.Writer) error
+	Run(context.Context, io.Writer) error
+	Check(context.Context, io.Writer) error
+	Clean(ctx context.Context, w io.Writer, success bool) error
+}
+
+// Timeouts are the deadlines of the phases of a test. A zero timeout means
+// that the phase has no deadline of its own.
+type Timeouts struct {
+	Build time.Duration
+	Setup time.Duration
+	Run   time.Duration
+	Check time.Duration
+	Clean time.Duration
+}
+
+// DefaultTimeouts are the timeouts of the test runner.
+var DefaultTimeouts = Timeouts{
+	Build: 10 * time.Minute,
+	Setup: 1 * time.Minute,
+	Run:   5 * time.Minute,
+	Check: 1 * time.Minute,
+	Clean: 1 * time.Minute,
+}
+
+// Options configure how tests are run.
+type Options struct {
+	Timeouts Timeouts
+
+	// Memory reserves the memory of a MemoryTest from Setup until its
+	// resources are removed.
+	// It may be nil.
+	Memory *MemoryScheduler
+
+	// Output receives the output of a test while it runs. It defaults to
+	// os.Stdout.
+	Output io.Writer
+
+	// Journal records the resources of the tests, so that they can be
+	// reaped if the run does not remove them. It may be nil.
+	Journal *Journal
+}
+
+func (o Options) output() io.Writer {
+	if o.Output == nil {
+		return os.Stdout
+	}
+	return o.Output
 }
 
 type Result struct {
@@ -26,6 +72,10 @@ type Result struct {
 	Error    error
 	Output   string
 	Duration time.Duration
+
+	// Skipped is set when the test did not run because the run was
+	// cancelled. Error holds the reason.
+	Skipped bool
 }
 
 func JUnit(r Result) junit.TestCase {
@@ -35,7 +85,9 @@ func JUnit(r Result) junit.TestCase {
 		Output:    r.Output,
 		Time:      fmt.Sprintf("%f", r.Duration.Seconds()),
 	}
-	if r.Error != nil {
+	if r.Skipped {
+		tc.Skipped = &junit.Skipped{Message: r.Error.Error()}
+	} else if r.Error != nil {
 		tc.Failure = &junit.Failure{
 			Message:  "integration test failure",
 			Contents: r.Error.Error(),
@@ -44,18 +96,24 @@ func JUnit(r Result) junit.TestCase {
 	return tc
 }
 
-func Run(t Test) (result Result) {
+// Run runs the phases of a test. Each phase gets its own deadline. The
+// test is cleaned up however it ends, even when ctx is done, so that no
+// domains are left behind.
+func Run(ctx context.Context, t Test, o Options) (result Result) {
+	out := &syncWriter{w: o.output()}
+	timeouts := o.Timeouts
+
 	start := time.Now()
 	result.Test = t
 	defer func() {
 		result.Duration = time.Now().Sub(start)
-		fmt.Println("[+] test ended in", result.Duration)
+		fmt.Fprintln(out, "[+] test ended in", result.Duration)
 	}()
 	defer func() {
 		if result.Error == nil {
-			fmt.Println("[+] successfully ran test")
+			fmt.Fprintln(out, "[+] successfully ran test")
 		} else {
-			fmt.Println("[-] test error:", result.Error)
+			fmt.Fprintln(out, "[-] test error:", result.Error)
 		}
 	}()
 	defer func() {
@@ -68,34 +126,185 @@ func Run(t Test) (result Result) {
 		}
 	}()
 
-	buffer := bytes.NewBuffer(nil)
-	w := io.MultiWriter(os.Stdout, buffer)
+	var output bytes.Buffer
+	buffer := &syncWriter{w: &output}
+	w := io.MultiWriter(out, buffer)
 	defer func() {
-		result.Output = string(buffer.Bytes())
+		result.Output = output.String()
 	}()
 
-	result.Error = t.Build(w)
+	registry := NewRegistry(o.Journal)
+	ctx = WithRegistry(ctx, registry)
+
+	runSucceeded := false
+	defer func() {
+		cw := w
+		if result.Error != nil {
+			cw = buffer
+		}
+
+		// The test may have been cancelled, but its resources must go
+		// anyway.
+		ctx := WithRegistry(context.Background(), registry)
+		err := phase(ctx, "clean", timeouts.Clean, func(ctx context.Context) error {
+			err := t.Clean(ctx, cw, runSucceeded)
+			if terr := registry.Teardown(ctx, cw); err == nil {
+				err = terr
+			}
+			return err
+		})
+		if result.Error == nil {
+			result.Error = err
+		}
+	}()
+
+	result.Error = phase(ctx, "build", timeouts.Build, func(ctx context.Context) error {
+		return t.Build(ctx, w)
+	})
 	if result.Error != nil {
 		return
 	}
 
-	result.Error = t.Setup(w)
-	if result.Error != nil {
-		return
+	if mt, ok := t.(MemoryTest); ok && o.Memory != nil {
+		mib := mt.GetMemory()
+		fmt.Fprintf(w, "[+] waiting for %d MiB of memory\n", mib)
+		if result.Error = o.Memory.Acquire(ctx, mib); result.Error != nil {
+			return
+		}
+		registry.Add("memory", fmt.Sprintf("%d MiB", mib), func(context.Context) error {
+			o.Memory.Release(mib)
+			return nil
+		})
 	}
 
-	result.Error = t.Run(w)
+	result.Error = phase(ctx, "setup", timeouts.Setup, func(ctx context.Context) error {
+		return t.Setup(ctx, w)
+	})
 	if result.Error != nil {
-		t.Clean(buffer, false)
 		return
 	}
 
-	result.Error = t.Check(w)
+	result.Error = phase(ctx, "run", timeouts.Run, func(ctx context.Context) error {
+		return t.Run(ctx, w)
+	})
 	if result.Error != nil {
-		t.Clean(buffer, true)
 		return
 	}
+	runSucceeded = true
 
-	result.Error = t.Clean(w, true)
+	result.Error = phase(ctx, "check", timeouts.Check, func(ctx context.Context) error {
+		return t.Check(ctx, w)
+	})
 	return
 }
+
+// phase runs a phase of a test with a timeout. Errors of a phase that ran
+// out of time say so.
+func phase(ctx context.Context, name string, timeout time.Duration, f func(context.Context) error) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	err := f(ctx)
+	if err == nil || ctx.Err() == nil {
+		return err
+	}
+	if err == ctx.Err() {
+		return fmt.Errorf("%v phase: %v", name, err)
+	}
+	return fmt.Errorf("%v phase: %v: %v", name, ctx.Err(), err)
+}
+
+// Sleep waits for d, or until ctx is done.
+func Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// RunAll runs the tests, at most parallel at the same time. The output of
+// tests that run in parallel is written to the output in one piece when a
+// test ends, so that it does not interleave. The unikernels are built once
+// and removed when all tests ended. When ctx is done, the tests that did not
+// start yet are skipped.
+func RunAll(ctx context.Context, ts []Test, parallel int, o Options) []Result {
+	out := &syncWriter{w: o.output()}
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	builds := NewBuildCache(o.Journal)
+	ctx = WithBuildCache(ctx, builds)
+	defer func() {
+		ctx := context.Background()
+		if o.Timeouts.Clean > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, o.Timeouts.Clean)
+			defer cancel()
+		}
+		builds.Remove(ctx, out)
+	}()
+
+	results := make([]Result, len(ts))
+	slots := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, test := range ts {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if err := ctx.Err(); err != nil {
+			fmt.Fprintf(out, "[-] skipping %d tests: %v\n", len(ts)-i, err)
+			for j := i; j < len(ts); j++ {
+				results[j] = Result{
+					Test:    ts[j],
+					Error:   fmt.Errorf("skipped: %v", err),
+					Skipped: true,
+				}
+			}
+			break
+		}
+
+		wg.Add(1)
+		go func(i int, test Test) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			o := o
+			if parallel == 1 {
+				fmt.Fprintf(out, "Running test %s (%d/%d)\n", test.GetName(), i+1, len(ts))
+				o.Output = out
+				results[i] = Run(ctx, test, o)
+				return
+			}
+
+			buffer := bytes.NewBuffer(nil)
+			fmt.Fprintf(buffer, "Running test %s (%d/%d)\n", test.GetName(), i+1, len(ts))
+			o.Output = buffer
+			results[i] = Run(ctx, test, o)
+			out.Write(buffer.Bytes())
+		}(i, test)
+	}
+	wg.Wait()
+	return results
+}
+
+// syncWriter serializes the writes to a writer.
+type syncWriter struct {
+	mutex sync.Mutex
+	w     io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.w.Write(p)
+}
@@ -0,0 +1,279 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// phaseTest records the phases that ran. A phase in Hang blocks until its
+// context is done; a phase in Fail returns an error.
+type phaseTest struct {
+	Hang   string
+	Fail   string
+	phases []string
+	clean  error
+}
+
+func (t *phaseTest) GetName() string     { return "phases" }
+func (t *phaseTest) GetCategory() string { return "test" }
+func (t *phaseTest) GetInfo() string     { return "" }
+
+func (t *phaseTest) phase(ctx context.Context, name string) error {
+	t.phases = append(t.phases, name)
+	if t.Hang == name {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	if t.Fail == name {
+		return errors.New(name + " failed")
+	}
+	return nil
+}
+
+func (t *phaseTest) Build(ctx context.Context, w io.Writer) error { return t.phase(ctx, "build") }
+func (t *phaseTest) Setup(ctx context.Context, w io.Writer) error { return t.phase(ctx, "setup") }
+func (t *phaseTest) Run(ctx context.Context, w io.Writer) error   { return t.phase(ctx, "run") }
+func (t *phaseTest) Check(ctx context.Context, w io.Writer) error { return t.phase(ctx, "check") }
+
+func (t *phaseTest) Clean(ctx context.Context, w io.Writer, success bool) error {
+	t.clean = ctx.Err()
+	return t.phase(ctx, "clean")
+}
+
+func TestRun(t *testing.T) {
+	type test struct {
+		Test      phaseTest
+		Cancelled bool
+		Phases    []string
+		Error     string
+	}
+
+	timeouts := Timeouts{
+		Build: time.Second,
+		Setup: time.Second,
+		Run:   20 * time.Millisecond,
+		Check: time.Second,
+		Clean: time.Second,
+	}
+
+	tests := []test{
+		{
+			Phases: []string{"build", "setup", "run", "check", "clean"},
+		},
+		{
+			Test:   phaseTest{Fail: "setup"},
+			Phases: []string{"build", "setup", "clean"},
+			Error:  "setup failed",
+		},
+		{
+			Test:   phaseTest{Fail: "check"},
+			Phases: []string{"build", "setup", "run", "check", "clean"},
+			Error:  "check failed",
+		},
+		{
+			Test:   phaseTest{Hang: "run"},
+			Phases: []string{"build", "setup", "run", "clean"},
+			Error:  "run phase: context deadline exceeded",
+		},
+		{
+			Test:      phaseTest{Hang: "build"},
+			Cancelled: true,
+			Phases:    []string{"build", "clean"},
+			Error:     "build phase: context canceled",
+		},
+	}
+
+	for i, test := range tests {
+		ctx, cancel := context.WithCancel(context.Background())
+		if test.Cancelled {
+			cancel()
+		}
+
+		pt := test.Test
+		result := Run(ctx, &pt, Options{Timeouts: timeouts, Output: ioutil.Discard})
+		cancel()
+
+		assert.Equal(t, test.Phases, pt.phases, "for test %d", i)
+		assert.Nil(t, pt.clean, "for test %d", i)
+		if test.Error == "" {
+			assert.Nil(t, result.Error, "for test %d", i)
+		} else if assert.NotNil(t, result.Error, "for test %d", i) {
+			assert.Equal(t, test.Error, result.Error.Error(), "for test %d", i)
+		}
+	}
+}
+
+// concurrency counts the tests that run at the same time.
+type concurrency struct {
+	mutex   sync.Mutex
+	running int
+	max     int
+}
+
+// concurrentTest is a test whose run phase takes a while.
+type concurrentTest struct {
+	phaseTest
+	name    string
+	memory  int
+	counter *concurrency
+}
+
+func (t *concurrentTest) GetName() string { return t.name }
+func (t *concurrentTest) GetMemory() int  { return t.memory }
+
+func (t *concurrentTest) Run(ctx context.Context, w io.Writer) error {
+	c := t.counter
+	c.mutex.Lock()
+	c.running++
+	if c.running > c.max {
+		c.max = c.running
+	}
+	c.mutex.Unlock()
+
+	io.WriteString(w, "running "+t.name+"\n")
+	time.Sleep(50 * time.Millisecond)
+	io.WriteString(w, "done "+t.name+"\n")
+
+	c.mutex.Lock()
+	c.running--
+	c.mutex.Unlock()
+	return nil
+}
+
+func TestRunAll(t *testing.T) {
+	type test struct {
+		Parallel int
+		Memory   int
+
+		// Min and Max bound the number of tests that run at the same time.
+		Min int
+		Max int
+	}
+
+	tests := []test{
+		{Parallel: 1, Min: 1, Max: 1},
+		{Parallel: 4, Min: 2, Max: 4},
+		{Parallel: 4, Memory: 512, Min: 1, Max: 2},
+	}
+
+	for i, test := range tests {
+		counter := &concurrency{}
+		var ts []Test
+		for j := 0; j < 6; j++ {
+			name := string(rune('a' + j))
+			ts = append(ts, &concurrentTest{name: name, memory: 256, counter: counter})
+		}
+
+		var out syncWriter
+		var buffer strings.Builder
+		out.w = &buffer
+		o := Options{Timeouts: DefaultTimeouts, Output: &out}
+		if test.Memory != 0 {
+			o.Memory = NewMemoryScheduler(test.Memory)
+		}
+
+		results := RunAll(context.Background(), ts, test.Parallel, o)
+		assert.True(t, counter.max >= test.Min, "for test %d", i)
+		assert.True(t, counter.max <= test.Max, "for test %d", i)
+		for j, r := range results {
+			assert.Nil(t, r.Error, "for test %d, result %d", i, j)
+			assert.Equal(t, ts[j], r.Test, "for test %d, result %d", i, j)
+
+			// The output of a test is not interleaved with other tests.
+			name := ts[j].GetName()
+			assert.Contains(t, buffer.String(), "running "+name+"\ndone "+name+"\n", "for test %d", i)
+		}
+	}
+}
+
+// cancellingTest cancels the run of all tests when it runs.
+type cancellingTest struct {
+	phaseTest
+	cancel context.CancelFunc
+}
+
+func (t *cancellingTest) Run(ctx context.Context, w io.Writer) error {
+	t.cancel()
+	return nil
+}
+
+func TestRunAllCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ts := []Test{
+		&cancellingTest{cancel: cancel},
+		&phaseTest{},
+		&phaseTest{},
+	}
+	results := RunAll(ctx, ts, 1, Options{Timeouts: DefaultTimeouts, Output: ioutil.Discard})
+
+	assert.False(t, results[0].Skipped)
+	assert.Nil(t, results[0].Error)
+	for i, r := range results[1:] {
+		assert.True(t, r.Skipped, "for result %d", i+1)
+		assert.Equal(t, ts[i+1], r.Test, "for result %d", i+1)
+		if assert.NotNil(t, r.Error, "for result %d", i+1) {
+			assert.Equal(t, "skipped: context canceled", r.Error.Error(), "for result %d", i+1)
+		}
+		assert.Nil(t, ts[i+1].(*phaseTest).phases, "for result %d", i+1)
+	}
+
+	tc := JUnit(results[1])
+	assert.Nil(t, tc.Failure)
+	if assert.NotNil(t, tc.Skipped) {
+		assert.Equal(t, "skipped: context canceled", tc.Skipped.Message)
+	}
+}
+
+func TestSleep(t *testing.T) {
+	assert.Nil(t, Sleep(context.Background(), time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	assert.Equal(t, context.Canceled, Sleep(ctx, time.Minute))
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+// leakyTest adds a resource in every phase and fails in Setup.
+type leakyTest struct {
+	phaseTest
+	removed []string
+}
+
+func (t *leakyTest) add(ctx context.Context, name string) {
+	RegistryFrom(ctx).Add("thing", name, func(context.Context) error {
+		t.removed = append(t.removed, name)
+		return nil
+	})
+}
+
+func (t *leakyTest) Build(ctx context.Context, w io.Writer) error {
+	t.add(ctx, "unikernel")
+	return nil
+}
+
+func (t *leakyTest) Setup(ctx context.Context, w io.Writer) error {
+	t.add(ctx, "bridge")
+	t.add(ctx, "domain")
+	return errors.New("setup failed")
+}
+
+func TestRunTeardown(t *testing.T) {
+	lt := &leakyTest{}
+	result := Run(context.Background(), lt, Options{Timeouts: DefaultTimeouts, Output: ioutil.Discard})
+	if assert.NotNil(t, result.Error) {
+		assert.Equal(t, "setup failed", result.Error.Error())
+	}
+	assert.Equal(t, []string{"domain", "bridge", "unikernel"}, lt.removed)
+	assert.Contains(t, result.Output, "[+] removing thing domain")
+}
@@ -1,34 +1,41 @@
 package xen
 
 import (
+	"context"
 	"os/exec"
 	"strconv"
+
+	"github.com/unigornel/unigornel/integration_tests/proc"
 )
 
-func Xl(args ...string) *exec.Cmd {
-	return exec.Command("xl", args...)
+func Xl(ctx context.Context, args ...string) *exec.Cmd {
+	return proc.Command(ctx, "xl", args...)
 }
 
-func Create(paused bool, config string) *exec.Cmd {
+func Create(ctx context.Context, paused bool, config string) *exec.Cmd {
 	args := []string{"create", "-f", config}
 	if paused {
 		args = append(args, "-p")
 	}
-	return Xl(args...)
+	return Xl(ctx, args...)
+}
+
+func Unpause(ctx context.Context, id int) *exec.Cmd {
+	return Xl(ctx, "unpause", strconv.Itoa(id))
 }
 
-func Unpause(id int) *exec.Cmd {
-	return Xl("unpause", strconv.Itoa(id))
+func Console(ctx context.Context, id int) *exec.Cmd {
+	return Xl(ctx, "console", strconv.Itoa(id))
 }
 
-func Console(id int) *exec.Cmd {
-	return Xl("console", strconv.Itoa(id))
+func List(ctx context.Context, args ...string) *exec.Cmd {
+	return Xl(ctx, append([]string{"list"}, args...)...)
 }
 
-func List() *exec.Cmd {
-	return Xl("list")
+func Destroy(ctx context.Context, id int) *exec.Cmd {
+	return Xl(ctx, "destroy", strconv.Itoa(id))
 }
 
-func Destroy(id int) *exec.Cmd {
-	return Xl("destroy", strconv.Itoa(id))
+func Info(ctx context.Context) *exec.Cmd {
+	return Xl(ctx, "info")
 }
@@ -0,0 +1,340 @@
+package xen
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/unigornel/unigornel/unigornel/xl"
+)
+
+// FakeStep is a step that a domain of the fake hypervisor takes after it is
+// unpaused.
+type FakeStep struct {
+	// After waits before the step is taken.
+	After time.Duration
+
+	// Input waits until the string is written to the console. The input up
+	// to and including the string is consumed.
+	Input string
+
+	// Output is written to the console.
+	Output string
+
+	// State is the new state of the domain, unless it is zero.
+	State DomainState
+}
+
+// FakeHypervisor is an in-memory hypervisor for testing the harness. Its
+// domains follow a script instead of running a kernel.
+type FakeHypervisor struct {
+	// Script returns the steps of a new domain. A domain keeps running
+	// after its last step.
+	Script func(kernel xl.Kernel) []FakeStep
+
+	// Memory is the memory of the host in MiB. It defaults to
+	// DefaultFakeMemory.
+	Memory int
+
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	nextID  int
+	domains map[int]*fakeDomain
+}
+
+type fakeDomain struct {
+	Domain
+	steps     []FakeStep
+	output    bytes.Buffer
+	input     bytes.Buffer
+	consoles  []*fakeConsole
+	destroyed chan struct{}
+}
+
+// DefaultFakeMemory is the default memory of the fake host, in MiB.
+const DefaultFakeMemory = 4096
+
+// NewFakeHypervisor creates a fake hypervisor whose domains follow the
+// script.
+func NewFakeHypervisor(script func(kernel xl.Kernel) []FakeStep) *FakeHypervisor {
+	hv := &FakeHypervisor{
+		Script:  script,
+		nextID:  1,
+		domains: make(map[int]*fakeDomain),
+	}
+	hv.cond = sync.NewCond(&hv.mutex)
+	return hv
+}
+
+func (hv *FakeHypervisor) Create(ctx context.Context, kernel xl.Kernel, w io.Writer) (*Domain, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := kernel.Validate(); err != nil {
+		return nil, err
+	}
+
+	hv.mutex.Lock()
+	defer hv.mutex.Unlock()
+
+	for _, d := range hv.domains {
+		if d.Name == kernel.Name {
+			return nil, fmt.Errorf("domain '%v' already exists", kernel.Name)
+		}
+	}
+	if free := hv.freeMemory(); kernel.Memory > free {
+		return nil, fmt.Errorf("not enough memory for domain '%v': %d MiB free", kernel.Name, free)
+	}
+
+	d := &fakeDomain{
+		Domain: Domain{
+			ID:     hv.nextID,
+			Name:   kernel.Name,
+			Memory: kernel.Memory,
+			VCPUs:  1,
+			State:  DomainStatePaused,
+
+			MaxMemory:      kernel.Memory,
+			ShutdownReason: ShutdownReasonNone,
+			Config: &DomainConfig{
+				Type:      "pv",
+				Kernel:    kernel.Binary,
+				Cmdline:   kernel.Extra,
+				Memory:    kernel.Memory,
+				MaxMemory: kernel.Memory,
+				VCPUs:     1,
+				OnCrash:   kernel.OnCrash,
+			},
+		},
+		destroyed: make(chan struct{}),
+	}
+	if hv.Script != nil {
+		d.steps = hv.Script(kernel)
+	}
+	hv.domains[d.ID] = d
+	hv.nextID++
+
+	dom := d.Domain
+	return &dom, nil
+}
+
+func (hv *FakeHypervisor) Unpause(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	hv.mutex.Lock()
+	defer hv.mutex.Unlock()
+
+	d, err := hv.domain(id)
+	if err != nil {
+		return err
+	}
+	if !d.State.Check(DomainStatePaused) {
+		return fmt.Errorf("domain %v is not paused", id)
+	}
+
+	d.State = DomainStateRunning
+	go hv.run(d)
+	return nil
+}
+
+func (hv *FakeHypervisor) Destroy(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	hv.mutex.Lock()
+	defer hv.mutex.Unlock()
+
+	d, err := hv.domain(id)
+	if err != nil {
+		return err
+	}
+
+	delete(hv.domains, id)
+	close(d.destroyed)
+	for _, c := range d.consoles {
+		c.detach()
+	}
+	d.consoles = nil
+	hv.cond.Broadcast()
+	return nil
+}
+
+func (hv *FakeHypervisor) List(ctx context.Context) ([]Domain, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	hv.mutex.Lock()
+	defer hv.mutex.Unlock()
+
+	domains := make([]Domain, 0, len(hv.domains))
+	for id := 1; id < hv.nextID; id++ {
+		if d, ok := hv.domains[id]; ok {
+			domains = append(domains, d.Domain)
+		}
+	}
+	return domains, nil
+}
+
+// FreeMemory returns the memory in MiB that is left for new domains: Memory,
+// or DefaultFakeMemory, minus the memory of the domains.
+func (hv *FakeHypervisor) FreeMemory(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	hv.mutex.Lock()
+	defer hv.mutex.Unlock()
+	return hv.freeMemory(), nil
+}
+
+// freeMemory returns the memory that no domain uses. The mutex must be
+// held.
+func (hv *FakeHypervisor) freeMemory() int {
+	free := hv.Memory
+	if free == 0 {
+		free = DefaultFakeMemory
+	}
+	for _, d := range hv.domains {
+		free -= d.Memory
+	}
+	return free
+}
+
+// Console attaches to the console of a domain. The output that the domain
+// wrote before is written to w first.
+func (hv *FakeHypervisor) Console(ctx context.Context, id int, w io.Writer) (DomainConsole, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	hv.mutex.Lock()
+	defer hv.mutex.Unlock()
+
+	d, err := hv.domain(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(d.output.Bytes()); err != nil {
+		return nil, err
+	}
+
+	c := &fakeConsole{hv: hv, d: d, w: w, done: make(chan struct{})}
+	d.consoles = append(d.consoles, c)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Close()
+		case <-c.done:
+		}
+	}()
+	return c, nil
+}
+
+func (hv *FakeHypervisor) domain(id int) (*fakeDomain, error) {
+	d, ok := hv.domains[id]
+	if !ok {
+		return nil, fmt.Errorf("domain %v does not exist", id)
+	}
+	return d, nil
+}
+
+// run takes the steps of a domain until it is destroyed.
+func (hv *FakeHypervisor) run(d *fakeDomain) {
+	for _, step := range d.steps {
+		select {
+		case <-time.After(step.After):
+		case <-d.destroyed:
+			return
+		}
+
+		hv.mutex.Lock()
+		for !hv.consumeInput(d, step.Input) {
+			select {
+			case <-d.destroyed:
+				hv.mutex.Unlock()
+				return
+			default:
+			}
+			hv.cond.Wait()
+		}
+
+		d.output.WriteString(step.Output)
+		for _, c := range d.consoles {
+			c.w.Write([]byte(step.Output))
+		}
+		if step.State != 0 {
+			d.State = step.State
+			switch {
+			case d.State.Check(DomainStateCrashed):
+				d.ShutdownReason = ShutdownReasonCrash
+			case d.State.Check(DomainStateShutdown):
+				d.ShutdownReason = ShutdownReasonPoweroff
+			}
+		}
+		hv.mutex.Unlock()
+	}
+}
+
+func (hv *FakeHypervisor) consumeInput(d *fakeDomain, s string) bool {
+	in := d.input.String()
+	i := strings.Index(in, s)
+	if i < 0 {
+		return false
+	}
+	d.input.Reset()
+	d.input.WriteString(in[i+len(s):])
+	return true
+}
+
+type fakeConsole struct {
+	hv   *FakeHypervisor
+	d    *fakeDomain
+	w    io.Writer
+	once sync.Once
+	done chan struct{}
+}
+
+func (c *fakeConsole) Write(p []byte) (int, error) {
+	c.hv.mutex.Lock()
+	defer c.hv.mutex.Unlock()
+
+	select {
+	case <-c.done:
+		return 0, errors.New("console is detached")
+	default:
+	}
+
+	c.d.input.Write(p)
+	c.hv.cond.Broadcast()
+	return len(p), nil
+}
+
+func (c *fakeConsole) Wait() error {
+	<-c.done
+	return nil
+}
+
+func (c *fakeConsole) Close() error {
+	c.hv.mutex.Lock()
+	defer c.hv.mutex.Unlock()
+
+	for i, other := range c.d.consoles {
+		if other == c {
+			c.d.consoles = append(c.d.consoles[:i], c.d.consoles[i+1:]...)
+			break
+		}
+	}
+	c.detach()
+	return nil
+}
+
+func (c *fakeConsole) detach() {
+	c.once.Do(func() {
+		close(c.done)
+	})
+}
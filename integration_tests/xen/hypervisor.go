@@ -0,0 +1,195 @@
+package xen
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/unigornel/unigornel/integration_tests/proc"
+	"github.com/unigornel/unigornel/unigornel/xl"
+)
+
+// Hypervisor manages the lifecycle and the consoles of domains.
+type Hypervisor interface {
+	// Create creates a paused domain for the kernel. The output of the
+	// hypervisor tools is written to w.
+	Create(ctx context.Context, kernel xl.Kernel, w io.Writer) (*Domain, error)
+	Unpause(ctx context.Context, id int) error
+	Destroy(ctx context.Context, id int) error
+	List(ctx context.Context) ([]Domain, error)
+
+	// FreeMemory returns the memory that is free for new domains, in MiB.
+	FreeMemory(ctx context.Context) (int, error)
+
+	// Console attaches to the console of a domain. The output of the
+	// domain is written to w. The console detaches when the context is
+	// done.
+	Console(ctx context.Context, id int, w io.Writer) (DomainConsole, error)
+}
+
+// DomainConsole is an attached domain console. Writes go to the input of the
+// domain.
+type DomainConsole interface {
+	io.Writer
+
+	// Wait waits until the console is detached.
+	Wait() error
+
+	// Close detaches the console.
+	Close() error
+}
+
+// DefaultHypervisor is used by tests that do not set a hypervisor.
+var DefaultHypervisor Hypervisor = XlHypervisor{}
+
+// DomainWithID returns the domain with the ID, or nil if there is none.
+func DomainWithID(ctx context.Context, hv Hypervisor, id int) (*Domain, error) {
+	return DomainWith(ctx, hv, func(domain Domain) bool {
+		return domain.ID == id
+	})
+}
+
+// DomainWithName returns the domain with the name, or nil if there is none.
+func DomainWithName(ctx context.Context, hv Hypervisor, name string) (*Domain, error) {
+	return DomainWith(ctx, hv, func(domain Domain) bool {
+		return domain.Name == name
+	})
+}
+
+// DomainWith returns the first domain for which f is true, or nil if there
+// is none.
+func DomainWith(ctx context.Context, hv Hypervisor, f func(Domain) bool) (*Domain, error) {
+	domains, err := hv.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dom := range domains {
+		if f(dom) {
+			return &dom, nil
+		}
+	}
+	return nil, nil
+}
+
+// XlHypervisor is the hypervisor of the local Xen host. It runs the xl
+// tool.
+type XlHypervisor struct{}
+
+func (XlHypervisor) Create(ctx context.Context, kernel xl.Kernel, w io.Writer) (*Domain, error) {
+	fh, err := ioutil.TempFile("", kernel.Name+"-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(fh.Name())
+	defer fh.Close()
+
+	if err := kernel.WriteConfiguration(fh); err != nil {
+		return nil, err
+	}
+
+	cmd := Create(ctx, true, fh.Name())
+	cmd.Stdout = w
+	cmd.Stderr = w
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+
+	dom, err := DomainWithName(ctx, XlHypervisor{}, kernel.Name)
+	if err != nil {
+		return nil, err
+	} else if dom == nil {
+		return nil, fmt.Errorf("could not create the paused kernel: %v", kernel.Name)
+	}
+	return dom, nil
+}
+
+func (XlHypervisor) Unpause(ctx context.Context, id int) error {
+	return runXl(Unpause(ctx, id))
+}
+
+func (XlHypervisor) Destroy(ctx context.Context, id int) error {
+	return runXl(Destroy(ctx, id))
+}
+
+// List lists the domains with their configuration. The state of the
+// domains comes from `xl list -v` and the configuration from `xl list -l`.
+func (XlHypervisor) List(ctx context.Context) ([]Domain, error) {
+	out, err := List(ctx, "-v").Output()
+	if err != nil {
+		return nil, err
+	}
+	domains, err := ParseListVerbose(bytes.NewReader(out))
+	if err != nil {
+		return nil, err
+	}
+
+	out, err = List(ctx, "-l").Output()
+	if err != nil {
+		return nil, err
+	}
+	configs, err := ParseListLong(bytes.NewReader(out))
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeDomains(domains, configs), nil
+}
+
+func (XlHypervisor) FreeMemory(ctx context.Context) (int, error) {
+	out, err := Info(ctx).Output()
+	if err != nil {
+		return 0, err
+	}
+	info, err := ParseInfo(bytes.NewReader(out))
+	if err != nil {
+		return 0, err
+	}
+	return info.FreeMemory()
+}
+
+func (XlHypervisor) Console(ctx context.Context, id int, w io.Writer) (DomainConsole, error) {
+	cmd := Console(ctx, id)
+	cmd.Stdout = w
+	cmd.Stderr = w
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &xlConsole{cmd: cmd, stdin: stdin}, nil
+}
+
+// runXl runs an xl command and adds its output to the error.
+func runXl(cmd *exec.Cmd) error {
+	out, err := cmd.CombinedOutput()
+	if err != nil && len(out) > 0 {
+		return fmt.Errorf("%v: %v", err, strings.TrimSpace(string(out)))
+	}
+	return err
+}
+
+type xlConsole struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+}
+
+func (c *xlConsole) Write(p []byte) (int, error) {
+	return c.stdin.Write(p)
+}
+
+func (c *xlConsole) Wait() error {
+	return c.cmd.Wait()
+}
+
+func (c *xlConsole) Close() error {
+	return proc.Kill(c.cmd)
+}
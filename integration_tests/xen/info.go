@@ -0,0 +1,46 @@
+package xen
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// HostInfo is the information about the host from `xl info`, by key.
+type HostInfo map[string]string
+
+// FreeMemory returns the memory of the host that is free for new domains,
+// in MiB.
+func (info HostInfo) FreeMemory() (int, error) {
+	v, ok := info["free_memory"]
+	if !ok {
+		return 0, fmt.Errorf("xl info has no free_memory")
+	}
+	mib, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid free_memory '%v' in xl info", v)
+	}
+	return mib, nil
+}
+
+// ParseInfo parses the output of `xl info`. Every line is a KEY : VALUE
+// pair.
+func ParseInfo(r io.Reader) (HostInfo, error) {
+	info := make(HostInfo)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		i := strings.Index(line, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("could not parse xl info output: invalid line: %v", line)
+		}
+		info[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+	}
+	return info, scanner.Err()
+}
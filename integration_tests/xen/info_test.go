@@ -0,0 +1,49 @@
+package xen
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseInfo(t *testing.T) {
+	fh, err := os.Open("testdata/info.txt")
+	require.Nil(t, err)
+	defer fh.Close()
+
+	info, err := ParseInfo(fh)
+	require.Nil(t, err)
+	assert.Equal(t, "xenhost", info["host"])
+	assert.Equal(t, "placeholder dom0_mem=4096M,max:4096M", info["xen_commandline"])
+	assert.Equal(t, "", info["xen_changeset"])
+
+	mib, err := info.FreeMemory()
+	assert.Nil(t, err)
+	assert.Equal(t, 11871, mib)
+}
+
+func TestParseInfoErrors(t *testing.T) {
+	type test struct {
+		Input string
+		Error string
+	}
+
+	tests := []test{
+		{"host : xenhost\ngarbage\n", "could not parse xl info output: invalid line: garbage"},
+	}
+
+	for i, test := range tests {
+		_, err := ParseInfo(strings.NewReader(test.Input))
+		if assert.NotNil(t, err, "for test %d", i) {
+			assert.Equal(t, test.Error, err.Error(), "for test %d", i)
+		}
+	}
+
+	_, err := HostInfo{"host": "xenhost"}.FreeMemory()
+	assert.NotNil(t, err)
+	_, err = HostInfo{"free_memory": "lots"}.FreeMemory()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,281 @@
+package xen
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/unigornel/unigornel/unigornel/xl"
+)
+
+// ShutdownReason is the reason why a domain shut down.
+type ShutdownReason int
+
+const (
+	ShutdownReasonNone      ShutdownReason = -1
+	ShutdownReasonPoweroff  ShutdownReason = 0
+	ShutdownReasonReboot    ShutdownReason = 1
+	ShutdownReasonSuspend   ShutdownReason = 2
+	ShutdownReasonCrash     ShutdownReason = 3
+	ShutdownReasonWatchdog  ShutdownReason = 4
+	ShutdownReasonSoftReset ShutdownReason = 5
+)
+
+func (r ShutdownReason) String() string {
+	switch r {
+	case ShutdownReasonNone:
+		return "none"
+	case ShutdownReasonPoweroff:
+		return "poweroff"
+	case ShutdownReasonReboot:
+		return "reboot"
+	case ShutdownReasonSuspend:
+		return "suspend"
+	case ShutdownReasonCrash:
+		return "crash"
+	case ShutdownReasonWatchdog:
+		return "watchdog"
+	case ShutdownReasonSoftReset:
+		return "soft_reset"
+	}
+	return fmt.Sprintf("unknown (%d)", int(r))
+}
+
+// DomainConfig is the configuration of a domain as reported by
+// `xl list -l`.
+type DomainConfig struct {
+	Type    string
+	Kernel  string
+	Cmdline string
+
+	// Memory and MaxMemory are in MiB.
+	Memory    int
+	MaxMemory int
+	VCPUs     int
+
+	OnPoweroff xl.Action
+	OnReboot   xl.Action
+	OnCrash    xl.Action
+
+	VIFs []xl.VIF
+
+	// Raw is the full configuration in the JSON format of libxl.
+	Raw json.RawMessage
+}
+
+// listLongEntry is an element of the output of `xl list -l`.
+type listLongEntry struct {
+	DomID  int             `json:"domid"`
+	Config json.RawMessage `json:"config"`
+}
+
+// libxlConfig is the part of the libxl domain configuration that is parsed.
+type libxlConfig struct {
+	CInfo struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+		UUID string `json:"uuid"`
+	} `json:"c_info"`
+	BInfo struct {
+		MaxVCPUs   int    `json:"max_vcpus"`
+		MaxMemKB   int    `json:"max_memkb"`
+		TargetMemK int    `json:"target_memkb"`
+		Kernel     string `json:"kernel"`
+		Cmdline    string `json:"cmdline"`
+		PV         struct {
+			Kernel  string `json:"kernel"`
+			Cmdline string `json:"cmdline"`
+		} `json:"type.pv"`
+	} `json:"b_info"`
+	Nics []struct {
+		BackendDomID   int    `json:"backend_domid"`
+		BackendDomName string `json:"backend_domname"`
+		DevID          int    `json:"devid"`
+		MAC            string `json:"mac"`
+		IP             string `json:"ip"`
+		Bridge         string `json:"bridge"`
+		Model          string `json:"model"`
+		Script         string `json:"script"`
+	} `json:"nics"`
+	OnPoweroff string `json:"on_poweroff"`
+	OnReboot   string `json:"on_reboot"`
+	OnCrash    string `json:"on_crash"`
+}
+
+// ParseListLong parses the output of `xl list -l`. Only the fields in the
+// configuration are set; the state of the domains is not part of it.
+func ParseListLong(r io.Reader) ([]Domain, error) {
+	var entries []listLongEntry
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("could not parse xl list -l output: %v", err)
+	}
+
+	domains := make([]Domain, 0, len(entries))
+	for _, e := range entries {
+		var c libxlConfig
+		if err := json.Unmarshal(e.Config, &c); err != nil {
+			return nil, fmt.Errorf("could not parse configuration of domain %d: %v", e.DomID, err)
+		}
+
+		config := &DomainConfig{
+			Type:       c.CInfo.Type,
+			Kernel:     c.BInfo.Kernel,
+			Cmdline:    c.BInfo.Cmdline,
+			Memory:     c.BInfo.TargetMemK / 1024,
+			MaxMemory:  c.BInfo.MaxMemKB / 1024,
+			VCPUs:      c.BInfo.MaxVCPUs,
+			OnPoweroff: actionFromLibxl(c.OnPoweroff),
+			OnReboot:   actionFromLibxl(c.OnReboot),
+			OnCrash:    actionFromLibxl(c.OnCrash),
+			Raw:        e.Config,
+		}
+		// Older versions of Xen keep the kernel with the PV options.
+		if config.Kernel == "" {
+			config.Kernel = c.BInfo.PV.Kernel
+		}
+		if config.Cmdline == "" {
+			config.Cmdline = c.BInfo.PV.Cmdline
+		}
+		for _, n := range c.Nics {
+			config.VIFs = append(config.VIFs, xl.VIF{
+				DevID:       n.DevID,
+				MAC:         n.MAC,
+				IP:          n.IP,
+				Bridge:      n.Bridge,
+				Model:       n.Model,
+				Script:      n.Script,
+				BackendID:   n.BackendDomID,
+				BackendName: n.BackendDomName,
+			})
+		}
+
+		domains = append(domains, Domain{
+			ID:             e.DomID,
+			Name:           c.CInfo.Name,
+			UUID:           c.CInfo.UUID,
+			Memory:         config.Memory,
+			MaxMemory:      config.MaxMemory,
+			VCPUs:          config.VCPUs,
+			ShutdownReason: ShutdownReasonNone,
+			Config:         config,
+		})
+	}
+	return domains, nil
+}
+
+// actionFromLibxl converts an action in the JSON format of libxl to the
+// action in an xl configuration file.
+func actionFromLibxl(s string) xl.Action {
+	if s == "restart_rename" {
+		return xl.ActionRenameRestart
+	}
+	return xl.Action(strings.Replace(s, "_", "-", -1))
+}
+
+var uuidRegexp = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// ParseListVerbose parses the output of `xl list -v`. Names may contain
+// spaces: the columns are counted from the UUID.
+func ParseListVerbose(r io.Reader) ([]Domain, error) {
+	domains := make([]Domain, 0)
+	scanner := bufio.NewScanner(r)
+	for header := true; scanner.Scan(); header = false {
+		if header || strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		domain, err := domainFromVerboseLine(scanner.Text())
+		if err != nil {
+			return nil, err
+		}
+		domains = append(domains, domain)
+	}
+	return domains, scanner.Err()
+}
+
+func domainFromVerboseLine(line string) (domain Domain, err error) {
+	fields := strings.Fields(line)
+
+	u := -1
+	for i, f := range fields {
+		if uuidRegexp.MatchString(f) {
+			u = i
+		}
+	}
+	// The name is followed by the ID, memory, VCPUs, state and time.
+	if u < 6 || u+1 >= len(fields) {
+		err = fmt.Errorf("could not parse xl list output: invalid line: %v", line)
+		return
+	}
+
+	domain.Name = nameFromLine(line, u-5)
+	domain.UUID = fields[u]
+
+	if domain.ID, err = strconv.Atoi(fields[u-5]); err != nil {
+		return
+	}
+	if domain.Memory, err = strconv.Atoi(fields[u-4]); err != nil {
+		return
+	}
+	if domain.VCPUs, err = strconv.Atoi(fields[u-3]); err != nil {
+		return
+	}
+	if domain.State, err = parseDomainState(fields[u-2]); err != nil {
+		return
+	}
+	if domain.Time, err = strconv.ParseFloat(fields[u-1], 64); err != nil {
+		return
+	}
+
+	domain.ShutdownReason = ShutdownReasonNone
+	if reason := fields[u+1]; reason != "-" {
+		var r int
+		if r, err = strconv.Atoi(reason); err != nil {
+			return
+		}
+		domain.ShutdownReason = ShutdownReason(r)
+	}
+	return
+}
+
+// nameFromLine returns the text before field n of a line of xl list,
+// which is the name of the domain.
+func nameFromLine(line string, n int) string {
+	pos := 0
+	for i := 0; i < n; i++ {
+		pos += strings.IndexFunc(line[pos:], isNotSpace)
+		pos += strings.IndexFunc(line[pos:], unicode.IsSpace)
+	}
+	return strings.TrimSpace(line[:pos])
+}
+
+func isNotSpace(r rune) bool {
+	return !unicode.IsSpace(r)
+}
+
+// mergeDomains adds the configurations of `xl list -l` to the domains of
+// `xl list -v`. The domains are matched by ID.
+func mergeDomains(domains, configs []Domain) []Domain {
+	byID := make(map[int]Domain)
+	for _, c := range configs {
+		byID[c.ID] = c
+	}
+
+	for i, d := range domains {
+		c, ok := byID[d.ID]
+		if !ok {
+			continue
+		}
+		domains[i].MaxMemory = c.MaxMemory
+		domains[i].Config = c.Config
+		if domains[i].UUID == "" {
+			domains[i].UUID = c.UUID
+		}
+	}
+	return domains
+}
@@ -0,0 +1,171 @@
+package xen
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unigornel/unigornel/unigornel/xl"
+)
+
+func TestParseListLong(t *testing.T) {
+	fh, err := os.Open("testdata/list-l.json")
+	require.Nil(t, err)
+	defer fh.Close()
+
+	domains, err := ParseListLong(fh)
+	require.Nil(t, err)
+	require.Len(t, domains, 3)
+
+	dom0 := domains[0]
+	assert.Equal(t, 0, dom0.ID)
+	assert.Equal(t, "Domain-0", dom0.Name)
+	assert.Equal(t, 4096, dom0.Memory)
+	assert.Empty(t, dom0.Config.VIFs)
+
+	ping := domains[1]
+	assert.Equal(t, 7, ping.ID)
+	assert.Equal(t, "kernel-reply_to_ping-1f2e3d4c", ping.Name)
+	assert.Equal(t, "0d3c8a4e-2f7b-4c55-9a3e-61d5f0b9e7a2", ping.UUID)
+	assert.Equal(t, 256, ping.Memory)
+	assert.Equal(t, 256, ping.MaxMemory)
+	assert.Equal(t, 1, ping.VCPUs)
+	assert.Equal(t, ShutdownReasonNone, ping.ShutdownReason)
+	assert.Equal(t, "pv", ping.Config.Type)
+	assert.Equal(t, "/tmp/unigornel-reply_to_ping-123456789", ping.Config.Kernel)
+	assert.Equal(t, "ip_address=10.0.100.3 ip_netmask=255.255.255.0", ping.Config.Cmdline)
+	assert.Equal(t, xl.Action(""), ping.Config.OnPoweroff)
+	assert.Equal(t, xl.ActionRestart, ping.Config.OnReboot)
+	assert.Equal(t, xl.ActionPreserve, ping.Config.OnCrash)
+	assert.Equal(t, []xl.VIF{
+		{
+			DevID:  0,
+			MAC:    "00:16:3e:5a:0b:11",
+			Bridge: "unigornel0",
+			Script: "/etc/xen/scripts/vif-bridge",
+		},
+	}, ping.Config.VIFs)
+	assert.Contains(t, string(ping.Config.Raw), `"claim_mode": "True"`)
+
+	web := domains[2]
+	assert.Equal(t, "web server", web.Name)
+	assert.Equal(t, 64, web.Memory)
+	assert.Equal(t, 128, web.MaxMemory)
+	assert.Equal(t, 2, web.VCPUs)
+	assert.Equal(t, "pvh", web.Config.Type)
+	assert.Equal(t, "/srv/unikernels/web", web.Config.Kernel)
+	assert.Equal(t, "port=8080", web.Config.Cmdline)
+	assert.Equal(t, []xl.VIF{
+		{
+			DevID:       0,
+			MAC:         "00:16:3e:11:22:33",
+			IP:          "10.0.0.2",
+			Bridge:      "xenbr0",
+			Model:       "e1000",
+			BackendID:   3,
+			BackendName: "netback",
+		},
+		{
+			DevID:  1,
+			MAC:    "00:16:3e:11:22:34",
+			Bridge: "xenbr1",
+		},
+	}, web.Config.VIFs)
+}
+
+func TestParseListLongInvalid(t *testing.T) {
+	inputs := []string{
+		"",
+		"{}",
+		`[{"domid": 1, "config": {"c_info": []}}]`,
+	}
+
+	for i, in := range inputs {
+		_, err := ParseListLong(strings.NewReader(in))
+		assert.NotNil(t, err, "for test %d", i)
+	}
+}
+
+func TestParseListVerbose(t *testing.T) {
+	fh, err := os.Open("testdata/list-v.txt")
+	require.Nil(t, err)
+	defer fh.Close()
+
+	domains, err := ParseListVerbose(fh)
+	require.Nil(t, err)
+
+	expected := []Domain{
+		{
+			ID:             0,
+			Name:           "Domain-0",
+			UUID:           "00000000-0000-0000-0000-000000000000",
+			Memory:         4096,
+			VCPUs:          4,
+			State:          DomainStateRunning,
+			Time:           1261.3,
+			ShutdownReason: ShutdownReasonNone,
+		},
+		{
+			ID:             7,
+			Name:           "kernel-reply_to_ping-1f2e3d4c",
+			UUID:           "0d3c8a4e-2f7b-4c55-9a3e-61d5f0b9e7a2",
+			Memory:         256,
+			VCPUs:          1,
+			State:          DomainStatePaused,
+			ShutdownReason: ShutdownReasonNone,
+		},
+		{
+			ID:             12,
+			Name:           "web server",
+			UUID:           "b4f1e6c2-9d0a-4e3b-8c7f-2a5d6e1f9b30",
+			Memory:         64,
+			VCPUs:          2,
+			State:          DomainStateShutdown | DomainStateCrashed,
+			Time:           3.5,
+			ShutdownReason: ShutdownReasonCrash,
+		},
+	}
+	assert.Equal(t, expected, domains)
+}
+
+func TestParseListVerboseInvalid(t *testing.T) {
+	lines := []string{
+		"Domain-0 0 4096 4 r----- 1261.3",
+		"Domain-0 0 4096 4 r----- 1261.3 00000000-0000-0000-0000-000000000000",
+		"Domain-0 zero 4096 4 r----- 1261.3 00000000-0000-0000-0000-000000000000 -",
+		"Domain-0 0 4096 4 r---- 1261.3 00000000-0000-0000-0000-000000000000 -",
+		"Domain-0 0 4096 4 r----- 1261.3 00000000-0000-0000-0000-000000000000 poweroff",
+	}
+
+	for i, line := range lines {
+		_, err := ParseListVerbose(strings.NewReader("header\n" + line + "\n"))
+		assert.NotNil(t, err, "for test %d", i)
+	}
+}
+
+func TestMergeDomains(t *testing.T) {
+	long, err := os.Open("testdata/list-l.json")
+	require.Nil(t, err)
+	defer long.Close()
+	verbose, err := os.Open("testdata/list-v.txt")
+	require.Nil(t, err)
+	defer verbose.Close()
+
+	configs, err := ParseListLong(long)
+	require.Nil(t, err)
+	domains, err := ParseListVerbose(verbose)
+	require.Nil(t, err)
+
+	domains = mergeDomains(domains[1:], configs)
+	require.Len(t, domains, 2)
+	for i, d := range domains {
+		require.NotNil(t, d.Config, "for test %d", i)
+		assert.Equal(t, d.Name, configs[i+1].Name, "for test %d", i)
+	}
+	assert.Equal(t, DomainStatePaused, domains[0].State)
+	assert.Equal(t, 256, domains[0].MaxMemory)
+	assert.Equal(t, ShutdownReasonCrash, domains[1].ShutdownReason)
+	assert.Equal(t, 128, domains[1].MaxMemory)
+}
@@ -0,0 +1,220 @@
+package xen
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// The intervals at which a watcher polls the state of a domain. It polls
+// fast after a change, and slows down while nothing happens.
+var (
+	WatchMinInterval = 50 * time.Millisecond
+	WatchMaxInterval = 1 * time.Second
+)
+
+// EventKind is the kind of a state transition of a domain.
+type EventKind int
+
+const (
+	EventCreated EventKind = iota
+	EventRunning
+	EventBlocked
+	EventPaused
+	EventShutdown
+	EventCrashed
+	EventDestroyed
+	EventError
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventCreated:
+		return "created"
+	case EventRunning:
+		return "running"
+	case EventBlocked:
+		return "blocked"
+	case EventPaused:
+		return "paused"
+	case EventShutdown:
+		return "shutdown"
+	case EventCrashed:
+		return "crashed"
+	case EventDestroyed:
+		return "destroyed"
+	case EventError:
+		return "error"
+	}
+	return fmt.Sprintf("unknown (%d)", int(k))
+}
+
+// Event is a state transition of a domain.
+type Event struct {
+	Kind EventKind
+
+	// Domain is the domain after the transition. For EventDestroyed it is
+	// the domain as it was last seen.
+	Domain Domain
+
+	// Err is set for EventError.
+	Err error
+}
+
+func (e Event) String() string {
+	switch e.Kind {
+	case EventShutdown:
+		return fmt.Sprintf("domain %d shutdown (%v)", e.Domain.ID, e.Domain.ShutdownReason)
+	case EventError:
+		return fmt.Sprintf("domain %d: %v", e.Domain.ID, e.Err)
+	}
+	return fmt.Sprintf("domain %d %v", e.Domain.ID, e.Kind)
+}
+
+// Stopped reports whether the domain stopped running: it shut down,
+// crashed or was destroyed.
+func (e Event) Stopped() bool {
+	return e.Kind == EventShutdown || e.Kind == EventCrashed || e.Kind == EventDestroyed
+}
+
+// eventKind returns the kind of event for the state of a domain, and false
+// if the state has none, e.g. while the domain is dying.
+func eventKind(state DomainState) (EventKind, bool) {
+	switch {
+	case state.Check(DomainStateCrashed):
+		return EventCrashed, true
+	case state.Check(DomainStateShutdown):
+		return EventShutdown, true
+	case state.Check(DomainStatePaused):
+		return EventPaused, true
+	case state.Check(DomainStateBlocked):
+		return EventBlocked, true
+	case state.Check(DomainStateRunning):
+		return EventRunning, true
+	}
+	return 0, false
+}
+
+// Watcher delivers the state transitions of a domain.
+type Watcher struct {
+	ctx    context.Context
+	hv     Hypervisor
+	id     int
+	events chan Event
+	stop   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+// Watch watches the state of a domain. The first events are EventCreated
+// and the current state. The events end after EventDestroyed or
+// EventError, or when the watcher is stopped or the context is done.
+func Watch(ctx context.Context, hv Hypervisor, id int) *Watcher {
+	w := &Watcher{
+		ctx:    ctx,
+		hv:     hv,
+		id:     id,
+		events: make(chan Event, 16),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Events returns the channel of events. It is closed when the events end.
+func (w *Watcher) Events() <-chan Event {
+	return w.events
+}
+
+// Stop stops the watcher.
+func (w *Watcher) Stop() {
+	w.once.Do(func() {
+		close(w.stop)
+	})
+	<-w.done
+}
+
+func (w *Watcher) run() {
+	defer close(w.done)
+	defer close(w.events)
+
+	var last *Domain
+	var lastKind EventKind
+	hasKind := false
+	interval := WatchMinInterval
+
+	for {
+		dom, err := DomainWithID(w.ctx, w.hv, w.id)
+		switch {
+		case w.ctx.Err() != nil:
+			return
+
+		case err != nil:
+			e := Event{Kind: EventError, Err: err}
+			if last != nil {
+				e.Domain = *last
+			} else {
+				e.Domain.ID = w.id
+			}
+			w.send(e)
+			return
+
+		case dom == nil:
+			e := Event{Kind: EventDestroyed}
+			if last != nil {
+				e.Domain = *last
+			} else {
+				e.Domain.ID = w.id
+			}
+			w.send(e)
+			return
+		}
+
+		if last == nil && !w.send(Event{Kind: EventCreated, Domain: *dom}) {
+			return
+		}
+		last = dom
+
+		changed := false
+		if kind, ok := eventKind(dom.State); ok && (!hasKind || kind != lastKind) {
+			if !w.send(Event{Kind: kind, Domain: *dom}) {
+				return
+			}
+			// Domains switch between running and blocked all the time.
+			changed = !hasKind || !isActive(kind) || !isActive(lastKind)
+			lastKind, hasKind = kind, true
+		}
+
+		if changed {
+			interval = WatchMinInterval
+		} else if interval *= 2; interval > WatchMaxInterval {
+			interval = WatchMaxInterval
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-w.stop:
+			return
+		case <-w.ctx.Done():
+			return
+		}
+	}
+}
+
+func isActive(kind EventKind) bool {
+	return kind == EventRunning || kind == EventBlocked
+}
+
+// send sends an event. It returns false if the watcher was stopped.
+func (w *Watcher) send(e Event) bool {
+	select {
+	case w.events <- e:
+		return true
+	case <-w.stop:
+		return false
+	case <-w.ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,144 @@
+package xen
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unigornel/unigornel/unigornel/xl"
+)
+
+func init() {
+	WatchMinInterval = time.Millisecond
+	WatchMaxInterval = 5 * time.Millisecond
+}
+
+// collect returns the kinds of the events until the channel is closed.
+func collect(t *testing.T, w *Watcher) ([]EventKind, []Event) {
+	var kinds []EventKind
+	var events []Event
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e, ok := <-w.Events():
+			if !ok {
+				return kinds, events
+			}
+			kinds = append(kinds, e.Kind)
+			events = append(events, e)
+		case <-timeout:
+			t.Fatalf("watcher did not finish, got %v", kinds)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	type test struct {
+		Steps   []FakeStep
+		Destroy time.Duration
+		Kinds   []EventKind
+		Reason  ShutdownReason
+	}
+
+	tests := []test{
+		{
+			Steps: []FakeStep{
+				{After: 20 * time.Millisecond, State: DomainStateBlocked},
+				{After: 20 * time.Millisecond, State: DomainStateShutdown},
+			},
+			Destroy: 80 * time.Millisecond,
+			Kinds:   []EventKind{EventCreated, EventPaused, EventRunning, EventBlocked, EventShutdown, EventDestroyed},
+			Reason:  ShutdownReasonPoweroff,
+		},
+		{
+			Steps:   []FakeStep{{After: 20 * time.Millisecond, State: DomainStateCrashed}},
+			Destroy: 60 * time.Millisecond,
+			Kinds:   []EventKind{EventCreated, EventPaused, EventRunning, EventCrashed, EventDestroyed},
+			Reason:  ShutdownReasonCrash,
+		},
+		{
+			Destroy: 30 * time.Millisecond,
+			Kinds:   []EventKind{EventCreated, EventPaused, EventRunning, EventDestroyed},
+			Reason:  ShutdownReasonNone,
+		},
+	}
+
+	for i, test := range tests {
+		hv := NewFakeHypervisor(func(xl.Kernel) []FakeStep {
+			return test.Steps
+		})
+		dom, err := hv.Create(context.Background(), xl.Kernel{Name: "watched", Binary: "/nonexistent/unikernel", Memory: 32}, nil)
+		require.Nil(t, err, "for test %d", i)
+
+		w := Watch(context.Background(), hv, dom.ID)
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			hv.Unpause(context.Background(), dom.ID)
+			time.Sleep(test.Destroy)
+			hv.Destroy(context.Background(), dom.ID)
+		}()
+
+		kinds, events := collect(t, w)
+		assert.Equal(t, test.Kinds, kinds, "for test %d", i)
+
+		last := events[len(events)-1]
+		assert.Equal(t, dom.ID, last.Domain.ID, "for test %d", i)
+		assert.Equal(t, "watched", last.Domain.Name, "for test %d", i)
+		assert.Equal(t, test.Reason, last.Domain.ShutdownReason, "for test %d", i)
+		w.Stop()
+	}
+}
+
+func TestWatchMissingDomain(t *testing.T) {
+	w := Watch(context.Background(), NewFakeHypervisor(nil), 42)
+	kinds, events := collect(t, w)
+	assert.Equal(t, []EventKind{EventDestroyed}, kinds)
+	assert.Equal(t, 42, events[0].Domain.ID)
+}
+
+type failingHypervisor struct {
+	*FakeHypervisor
+}
+
+func (failingHypervisor) List(context.Context) ([]Domain, error) {
+	return nil, errors.New("xl list failed")
+}
+
+func TestWatchError(t *testing.T) {
+	w := Watch(context.Background(), failingHypervisor{NewFakeHypervisor(nil)}, 1)
+	kinds, events := collect(t, w)
+	assert.Equal(t, []EventKind{EventError}, kinds)
+	assert.Equal(t, "domain 1: xl list failed", events[0].String())
+}
+
+func TestWatchStop(t *testing.T) {
+	hv := NewFakeHypervisor(nil)
+	dom, err := hv.Create(context.Background(), xl.Kernel{Name: "watched", Binary: "/nonexistent/unikernel", Memory: 32}, nil)
+	require.Nil(t, err)
+
+	w := Watch(context.Background(), hv, dom.ID)
+	w.Stop()
+	w.Stop()
+
+	// The events end, even if nobody reads them.
+	kinds, _ := collect(t, w)
+	assert.True(t, len(kinds) <= 2)
+}
+
+func TestEventString(t *testing.T) {
+	tests := []struct {
+		Event  Event
+		String string
+	}{
+		{Event{Kind: EventCreated, Domain: Domain{ID: 3}}, "domain 3 created"},
+		{Event{Kind: EventShutdown, Domain: Domain{ID: 3, ShutdownReason: ShutdownReasonReboot}}, "domain 3 shutdown (reboot)"},
+		{Event{Kind: EventCrashed, Domain: Domain{ID: 3}}, "domain 3 crashed"},
+	}
+
+	for i, test := range tests {
+		assert.Equal(t, test.String, test.Event.String(), "for test %d", i)
+	}
+}
@@ -1,67 +1,44 @@
 package xen
 
 import (
+	"context"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"os"
-	"os/exec"
-	"path"
-	"regexp"
-	"strconv"
-	"strings"
-)
+	"math/rand"
+	"sync"
+	"time"
 
-const (
-	OnCrashPreserve = "preserve"
+	"github.com/unigornel/unigornel/unigornel/xl"
 )
 
-type Kernel struct {
-	Binary  string
-	Memory  int
-	Name    string
-	OnCrash string
-	VIF     string
+var names = struct {
+	sync.Mutex
+	rand *rand.Rand
+	used map[uint32]bool
+}{
+	rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	used: make(map[uint32]bool),
 }
 
-func (kernel *Kernel) CreatePausedUniqueName(f func(cmd *exec.Cmd)) (*Domain, error) {
-	fh, err := ioutil.TempFile("", "kernel-"+kernel.Name+"-")
-	if err != nil {
-		return nil, err
-	}
-	defer os.Remove(fh.Name())
-	defer fh.Close()
-
-	kernel.Name = path.Base(fh.Name())
-	kernel.WriteConfiguration(fh)
-
-	cmd := Create(true, fh.Name())
-	if f != nil {
-		f(cmd)
-	}
-
-	err = cmd.Run()
-	if err != nil {
-		return nil, err
-	}
-
-	dom, err := DomainWithName(kernel.Name)
-	if err != nil {
-		return nil, err
-	} else if dom == nil {
-		return nil, fmt.Errorf("could not create the paused kernel: %s", kernel)
+// uniqueSuffix returns a random suffix that was not returned before. It is
+// safe for concurrent use.
+func uniqueSuffix() uint32 {
+	names.Lock()
+	defer names.Unlock()
+	for {
+		n := names.rand.Uint32()
+		if !names.used[n] {
+			names.used[n] = true
+			return n
+		}
 	}
-	return dom, err
 }
 
-func (k Kernel) WriteConfiguration(w io.Writer) {
-	fmt.Fprintf(w, "kernel = \"%s\"\n", k.Binary)
-	fmt.Fprintf(w, "memory = %d\n", k.Memory)
-	fmt.Fprintf(w, "name = \"%s\"\n", k.Name)
-	fmt.Fprintf(w, "on_crash = \"%s\"\n", k.OnCrash)
-	if k.VIF != "" {
-		fmt.Fprintf(w, "vif = %s", k.VIF)
-	}
+// CreatePausedUniqueName creates a paused domain for the kernel. A random
+// suffix is added to the name of the kernel to make it unique.
+func CreatePausedUniqueName(ctx context.Context, hv Hypervisor, kernel *xl.Kernel, w io.Writer) (*Domain, error) {
+	kernel.Name = fmt.Sprintf("kernel-%v-%08x", kernel.Name, uniqueSuffix())
+	return hv.Create(ctx, *kernel, w)
 }
 
 type DomainState int
@@ -83,112 +60,20 @@ func (state DomainState) Check(mask DomainState) bool {
 type Domain struct {
 	ID     int
 	Name   string
+	UUID   string
 	Memory int
 	VCPUs  int
 	State  DomainState
 	Time   float64
-}
 
-func (domain Domain) Update() (*Domain, error) {
-	return DomainWithID(domain.ID)
-}
-
-func (domain Domain) Destroy() *exec.Cmd {
-	return Destroy(domain.ID)
-}
-
-func (domain Domain) Unpause() *exec.Cmd {
-	return Unpause(domain.ID)
-}
-
-func (domain Domain) Console() *exec.Cmd {
-	return Console(domain.ID)
-}
-
-func ListDomains() ([]Domain, error) {
-	out, err := List().Output()
-	if err != nil {
-		return nil, err
-	}
-
-	domains := make([]Domain, 0)
-	for _, line := range strings.Split(string(out), "\n")[1:] {
-		if line != "" {
-			domain, err := domainFromListLine(line)
-			if err != nil {
-				return nil, err
-			}
-			domains = append(domains, domain)
-		}
-	}
+	// MaxMemory is in MiB, like Memory.
+	MaxMemory int
 
-	return domains, nil
-}
-
-func DomainWithID(id int) (*Domain, error) {
-	return DomainWith(func(domain Domain) bool {
-		return domain.ID == id
-	})
-}
-
-func DomainWithName(name string) (*Domain, error) {
-	return DomainWith(func(domain Domain) bool {
-		return domain.Name == name
-	})
-}
-
-func DomainWith(f func(Domain) bool) (*Domain, error) {
-	domains, err := ListDomains()
-	if err != nil {
-		return nil, err
-	}
-
-	for _, dom := range domains {
-		if f(dom) {
-			return &dom, nil
-		}
-	}
-	return nil, nil
-}
-
-func domainFromListLine(str string) (domain Domain, err error) {
-	s := regexp.MustCompile("\\s+").Split(str, -1)
-	if len(s) != 6 {
-		err = fmt.Errorf("could not parse xl list output: invalid line: %s", str)
-		return
-	}
-
-	name := s[0]
-	id := s[1]
-	mem := s[2]
-	vcpus := s[3]
-	state := s[4]
-	time := s[5]
-
-	domain.Name = name
-
-	domain.ID, err = strconv.Atoi(id)
-	if err != nil {
-		return
-	}
-
-	domain.Memory, err = strconv.Atoi(mem)
-	if err != nil {
-		return
-	}
-
-	domain.VCPUs, err = strconv.Atoi(vcpus)
-	if err != nil {
-		return
-	}
-
-	domain.State, err = parseDomainState(state)
-	if err != nil {
-		return
-	}
+	// ShutdownReason is ShutdownReasonNone unless the domain shut down.
+	ShutdownReason ShutdownReason
 
-	domain.Time, err = strconv.ParseFloat(time, 64)
-	return
+	// Config is nil if the configuration of the domain is unknown.
+	Config *DomainConfig
 }
 
 func parseDomainState(str string) (DomainState, error) {
@@ -0,0 +1,23 @@
+package settings
+
+import (
+	"strings"
+)
+
+// Args returns the arguments of the unikernel: the words of the kernel
+// command line (`unigornel run -- ARGS...` or extra in the xl
+// configuration), or the command-line arguments on other systems.
+func Args() []string {
+	return args()
+}
+
+// applyArgs overrides the values with the KEY=VALUE arguments.
+func applyArgs(values map[string][]string, args []string) {
+	for _, a := range args {
+		parts := strings.SplitN(a, "=", 2)
+		if len(parts) != 2 || ValidateKey(parts[0]) != nil {
+			continue
+		}
+		values[parts[0]] = []string{parts[1]}
+	}
+}
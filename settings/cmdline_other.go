@@ -0,0 +1,14 @@
+// +build !unigornel
+
+package settings
+
+import (
+	"os"
+)
+
+func args() []string {
+	if len(os.Args) < 2 {
+		return nil
+	}
+	return os.Args[1:]
+}
@@ -0,0 +1,21 @@
+// +build unigornel
+
+package settings
+
+/*
+#include <mini-os/hypervisor.h>
+
+static const char *unigornel_cmdline(void) {
+	return (const char *)start_info.cmd_line;
+}
+*/
+import "C"
+
+import (
+	"strings"
+)
+
+// args splits the command line that Xen passes to Mini-OS.
+func args() []string {
+	return strings.Fields(C.GoString(C.unigornel_cmdline()))
+}
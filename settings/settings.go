@@ -0,0 +1,251 @@
+// Package settings gives a unikernel access to the settings that were given
+// to `unigornel build --set` or declared with a default in the manifest.
+// KEY=VALUE arguments on the kernel command line override them, so one
+// image can run with different settings.
+//
+// The settings are checked against the schema in the manifest when the
+// unikernel is built or run with unigornel, so a unikernel can read them
+// without handling errors. An override that is not of the type of the
+// setting is reported and ignored:
+//
+//	address := settings.IPv4("ip_address")
+//	if settings.IsSet("ip_gateway") {
+//		gateway := settings.IPv4("ip_gateway")
+//	}
+package settings
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Type is the type of a setting.
+type Type string
+
+// The types of settings.
+const (
+	TypeString   Type = "string"
+	TypeInt      Type = "int"
+	TypeBool     Type = "bool"
+	TypeIPv4     Type = "ipv4"
+	TypeDuration Type = "duration"
+)
+
+// Setting declares a setting in the manifest.
+type Setting struct {
+	Type Type `yaml:"type"`
+
+	// Default is used when the setting is not given at build time.
+	Default string `yaml:"default,omitempty"`
+
+	// Required settings must be given at build time.
+	Required bool `yaml:"required,omitempty"`
+
+	Description string `yaml:"description,omitempty"`
+}
+
+// Symbol is the variable that `unigornel build` sets with -X.
+const Symbol = "github.com/unigornel/unigornel/settings.encoded"
+
+// encoded holds the settings as a URL query.
+var encoded string
+
+var keyRegexp = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// ValidateKey checks that the name of a setting is a lowercase identifier.
+func ValidateKey(key string) error {
+	if !keyRegexp.MatchString(key) {
+		return fmt.Errorf("invalid setting name '%v' (use lowercase letters, digits and underscores)", key)
+	}
+	return nil
+}
+
+// Validate checks the declaration of a setting.
+func (s Setting) Validate() error {
+	switch s.Type {
+	case TypeString, TypeInt, TypeBool, TypeIPv4, TypeDuration:
+	default:
+		return fmt.Errorf("unknown type '%v' (expected string, int, bool, ipv4 or duration)", s.Type)
+	}
+
+	if s.Required && s.Default != "" {
+		return fmt.Errorf("a required setting cannot have a default")
+	}
+	if s.Default != "" {
+		if err := s.Type.Check(s.Default); err != nil {
+			return fmt.Errorf("default: %v", err)
+		}
+	}
+	return nil
+}
+
+// Check checks that the value has the type.
+func (t Type) Check(value string) error {
+	var err error
+	switch t {
+	case TypeString:
+	case TypeInt:
+		_, err = strconv.Atoi(value)
+	case TypeBool:
+		_, err = strconv.ParseBool(value)
+	case TypeIPv4:
+		_, err = parseIPv4(value)
+	case TypeDuration:
+		_, err = time.ParseDuration(value)
+	default:
+		err = fmt.Errorf("unknown type")
+	}
+
+	if err != nil {
+		return fmt.Errorf("'%v' is not a valid %v", value, t)
+	}
+	return nil
+}
+
+// Encode encodes the values for the Symbol variable.
+func Encode(values map[string]string) string {
+	q := make(url.Values)
+	for k, v := range values {
+		q.Set(k, v)
+	}
+	return q.Encode()
+}
+
+var (
+	decodeOnce sync.Once
+	values     url.Values
+	overrides  url.Values
+
+	// rejected are the overrides that were reported as invalid.
+	rejectedMutex sync.Mutex
+	rejected      = make(map[string]bool)
+)
+
+func decode() {
+	decodeOnce.Do(func() {
+		var err error
+		if values, err = url.ParseQuery(encoded); err != nil {
+			panic(fmt.Sprintf("settings: invalid encoding: %v", err))
+		}
+		overrides = make(url.Values)
+		applyArgs(overrides, args())
+	})
+}
+
+func first(values url.Values, key string) (string, bool) {
+	v, ok := values[key]
+	if !ok || len(v) == 0 {
+		return "", false
+	}
+	return v[0], true
+}
+
+// Lookup returns the value of a setting and whether it is set.
+func Lookup(key string) (string, bool) {
+	decode()
+	if v, ok := first(overrides, key); ok {
+		return v, true
+	}
+	return first(values, key)
+}
+
+// IsSet reports whether a setting has a value.
+func IsSet(key string) bool {
+	_, ok := Lookup(key)
+	return ok
+}
+
+// lookup returns the value of a setting of the type. An override on the
+// command line that is not of the type is reported once and ignored. The
+// values given at build time were checked by unigornel, so reading them
+// with the wrong type is a bug in the unikernel.
+func lookup(key string, t Type) (string, bool) {
+	decode()
+	if v, ok := first(overrides, key); ok {
+		err := t.Check(v)
+		if err == nil {
+			return v, true
+		}
+		reject(key, err)
+	}
+
+	v, ok := first(values, key)
+	if ok {
+		if err := t.Check(v); err != nil {
+			panic(fmt.Sprintf("settings: %v: %v", key, err))
+		}
+	}
+	return v, ok
+}
+
+// reject reports an invalid override on the standard error.
+func reject(key string, err error) {
+	rejectedMutex.Lock()
+	defer rejectedMutex.Unlock()
+	if !rejected[key] {
+		rejected[key] = true
+		fmt.Fprintf(os.Stderr, "settings: ignoring %v on the command line: %v\n", key, err)
+	}
+}
+
+// String returns the value of a string setting, or "" if it is not set.
+func String(key string) string {
+	v, _ := lookup(key, TypeString)
+	return v
+}
+
+// Int returns the value of an int setting, or 0 if it is not set.
+func Int(key string) int {
+	v, ok := lookup(key, TypeInt)
+	if !ok {
+		return 0
+	}
+	i, _ := strconv.Atoi(v)
+	return i
+}
+
+// Bool returns the value of a bool setting, or false if it is not set.
+func Bool(key string) bool {
+	v, ok := lookup(key, TypeBool)
+	if !ok {
+		return false
+	}
+	b, _ := strconv.ParseBool(v)
+	return b
+}
+
+// IPv4 returns the value of an ipv4 setting, or 0.0.0.0 if it is not set.
+func IPv4(key string) [4]byte {
+	v, ok := lookup(key, TypeIPv4)
+	if !ok {
+		return [4]byte{}
+	}
+	a, _ := parseIPv4(v)
+	return a
+}
+
+// Duration returns the value of a duration setting, or 0 if it is not set.
+func Duration(key string) time.Duration {
+	v, ok := lookup(key, TypeDuration)
+	if !ok {
+		return 0
+	}
+	d, _ := time.ParseDuration(v)
+	return d
+}
+
+func parseIPv4(s string) ([4]byte, error) {
+	var a [4]byte
+	ip := net.ParseIP(s).To4()
+	if ip == nil {
+		return a, fmt.Errorf("invalid IPv4 address")
+	}
+	copy(a[:], ip)
+	return a, nil
+}
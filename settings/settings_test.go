@@ -0,0 +1,69 @@
+package settings
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSettings(t *testing.T) {
+	encoded = Encode(map[string]string{
+		"name":    "hello world&more",
+		"count":   "3",
+		"verbose": "true",
+		"address": "10.0.100.2",
+		"timeout": "1m30s",
+	})
+	decodeOnce = sync.Once{}
+
+	assert.Equal(t, "hello world&more", String("name"))
+	assert.Equal(t, 3, Int("count"))
+	assert.True(t, Bool("verbose"))
+	assert.Equal(t, [4]byte{10, 0, 100, 2}, IPv4("address"))
+	assert.Equal(t, 90*time.Second, Duration("timeout"))
+
+	assert.False(t, IsSet("gateway"))
+	assert.Equal(t, [4]byte{}, IPv4("gateway"))
+	assert.Panics(t, func() { Int("name") })
+}
+
+func TestInvalidOverride(t *testing.T) {
+	encoded = Encode(map[string]string{
+		"count":   "3",
+		"address": "10.0.100.2",
+	})
+	decodeOnce = sync.Once{}
+	decode()
+	applyArgs(overrides, []string{"count=many", "address=10.0.0.2", "gateway=nowhere"})
+
+	assert.Equal(t, 3, Int("count"))
+	assert.Equal(t, [4]byte{10, 0, 0, 2}, IPv4("address"))
+	assert.False(t, IsSet("nothing"))
+	assert.NotPanics(t, func() { IPv4("gateway") })
+	assert.Equal(t, [4]byte{}, IPv4("gateway"))
+	assert.True(t, rejected["count"])
+	assert.True(t, rejected["gateway"])
+}
+
+func TestValidate(t *testing.T) {
+	assert.Nil(t, Setting{Type: TypeIPv4, Default: "10.0.0.1"}.Validate())
+	assert.NotNil(t, Setting{Type: "float"}.Validate())
+	assert.NotNil(t, Setting{Type: TypeInt, Default: "x"}.Validate())
+	assert.NotNil(t, Setting{Type: TypeInt, Default: "1", Required: true}.Validate())
+
+	assert.Nil(t, ValidateKey("ip_address"))
+	assert.NotNil(t, ValidateKey("ip-address"))
+}
+
+func TestApplyArgs(t *testing.T) {
+	values := map[string][]string{"ip_address": {"10.0.100.2"}, "count": {"1"}}
+	applyArgs(values, []string{"ip_address=10.0.0.2", "verbose", "Bad-Key=x", "name=a=b"})
+
+	assert.Equal(t, map[string][]string{
+		"ip_address": {"10.0.0.2"},
+		"count":      {"1"},
+		"name":       {"a=b"},
+	}, values)
+}
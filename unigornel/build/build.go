@@ -1,10 +1,14 @@
 package build
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/unigornel/unigornel/unigornel/env"
+	"github.com/unigornel/unigornel/unigornel/manifest"
 	"github.com/urfave/cli"
 )
 
@@ -18,6 +22,8 @@ func Build() cli.Command {
 			buildVerboseFlag(),
 			outputFlag(),
 			ldflagsFlag(),
+			setFlag(),
+			env.ToolchainFlag(),
 		},
 		Action: func(ctx *cli.Context) error {
 			options := BuildOptions{
@@ -29,6 +35,7 @@ func Build() cli.Command {
 				OS: OSOptions{
 					Output: ctx.String(outputFlagName),
 				},
+				Settings: ctx.StringSlice(setFlagName),
 			}
 
 			if ctx.NArg() > 1 {
@@ -38,12 +45,17 @@ func Build() cli.Command {
 				options.Go.Package = ctx.Args()[0]
 			}
 
-			minios, err := env.RequireMiniOSRoot()
+			toolchain, err := env.RequireToolchain(ctx)
 			if err != nil {
 				return err
 			}
-			options.Go.MiniOSRoot = minios
-			options.OS.MiniOSRoot = minios
+			options.Go.GoRoot = toolchain.GoRoot
+			options.Go.MiniOSRoot = toolchain.MiniOS
+			options.OS.MiniOSRoot = toolchain.MiniOS
+
+			if err := options.applyManifest(); err != nil {
+				return cli.NewExitError("error: "+err.Error(), 1)
+			}
 
 			if err := options.buildAll(); err != nil {
 				return cli.NewExitError("error: "+err.Error(), 1)
@@ -56,6 +68,45 @@ func Build() cli.Command {
 type BuildOptions struct {
 	Go GoOptions
 	OS OSOptions
+
+	// Settings are the KEY=VALUE assignments of --set.
+	Settings []string
+}
+
+// applyManifest uses the manifest in the package directory for the options
+// that are not given, and checks the settings against it.
+func (o *BuildOptions) applyManifest() error {
+	dir, err := packageDir(o.Go.GoRoot, o.Go.Package)
+	if err != nil {
+		return err
+	}
+
+	m, ok, err := manifest.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	if len(o.Settings) > 0 && len(m.Settings) == 0 {
+		return fmt.Errorf("--set needs settings declared in %v", filepath.Join(dir, manifest.FileName))
+	}
+	if !ok {
+		return nil
+	}
+
+	if o.OS.Output == "" {
+		o.OS.Output = m.Name
+	}
+
+	ldflags := []string{m.LDFlags}
+	if len(m.Settings) > 0 {
+		values, err := resolveSettings(m, o.Settings)
+		if err != nil {
+			return err
+		}
+		ldflags = append(ldflags, settingsLDFlags(values))
+	}
+	ldflags = append(ldflags, o.Go.LDFlags)
+	o.Go.LDFlags = strings.TrimSpace(strings.Join(ldflags, " "))
+	return nil
 }
 
 func (o *BuildOptions) buildTemporaryCArchive() error {
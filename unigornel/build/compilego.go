@@ -4,8 +4,8 @@ import (
 	"fmt"
 	"os"
 	"path"
-	"strings"
 
+	"github.com/unigornel/unigornel/unigornel/config"
 	"github.com/unigornel/unigornel/unigornel/env"
 	"github.com/unigornel/unigornel/unigornel/exec"
 	"github.com/urfave/cli"
@@ -57,6 +57,7 @@ func CompileGo() cli.Command {
 			buildVerboseFlag(),
 			outputFlag(),
 			ldflagsFlag(),
+			env.ToolchainFlag(),
 		},
 		Action: func(ctx *cli.Context) error {
 			options := GoOptions{
@@ -77,11 +78,12 @@ func CompileGo() cli.Command {
 				options.Package = ctx.Args()[0]
 			}
 
-			minios, err := env.RequireMiniOSRoot()
+			toolchain, err := env.RequireToolchain(ctx)
 			if err != nil {
 				return err
 			}
-			options.MiniOSRoot = minios
+			options.GoRoot = toolchain.GoRoot
+			options.MiniOSRoot = toolchain.MiniOS
 
 			if err := compileGo(options); err != nil {
 				return cli.NewExitError("error: "+err.Error(), 1)
@@ -95,6 +97,7 @@ type GoOptions struct {
 	BuildAll     bool
 	BuildVerbose bool
 	Package      string
+	GoRoot       string
 	MiniOSRoot   string
 	Output       string
 	LDFlags      string
@@ -117,18 +120,10 @@ func generateMiniOSLinks(options GoOptions) error {
 
 func compileCArchive(options GoOptions) error {
 	fmt.Printf("[+] compiling Go to a c-archive (%s)\n", options.Output)
-	include := strings.Join([]string{
-		"-isystem", path.Join(options.MiniOSRoot, "include"),
-		"-isystem", path.Join(options.MiniOSRoot, "include", "x86"),
-		"-isystem", path.Join(options.MiniOSRoot, "include", "x86", "x86_64"),
-	}, " ")
-
-	envs := append(os.Environ(), []string{
-		"CGO_ENABLED=1",
-		"CGO_CFLAGS=" + include,
-		"GOOS=unigornel",
-		"GOARCH=amd64",
-	}...)
+	toolchain := config.Config{
+		GoRoot: options.GoRoot,
+		MiniOS: options.MiniOSRoot,
+	}
 
 	args := []string{"build", "-buildmode=c-archive"}
 	args = append(args, "-o", options.Output)
@@ -156,8 +151,8 @@ func compileCArchive(options GoOptions) error {
 			fmt.Println("[-] warning:", err)
 		}
 	}()
-	cmd := exec.InTerminal("go", args...)
-	cmd.Env = envs
+	cmd := exec.InTerminal(env.GoBinary(toolchain), args...)
+	cmd.Env = env.GoEnviron(toolchain)
 	return cmd.Run()
 }
 
@@ -174,6 +169,13 @@ func compileGo(options GoOptions) error {
 	if err := generateMiniOSLinks(options); err != nil {
 		return err
 	}
+
+	removeShim, err := generateMainShim(options)
+	if err != nil {
+		return err
+	}
+	defer removeShim()
+
 	if err := compileCArchive(options); err != nil {
 		return err
 	}
@@ -19,6 +19,7 @@ func CompileOS() cli.Command {
 		ArgsUsage: "C-ARCHIVE",
 		Flags: []cli.Flag{
 			outputFlag(),
+			env.ToolchainFlag(),
 		},
 		Action: func(ctx *cli.Context) error {
 			options := OSOptions{
@@ -30,7 +31,7 @@ func CompileOS() cli.Command {
 			}
 			options.CArchive = ctx.Args()[0]
 
-			minios, err := env.RequireMiniOSRoot()
+			minios, err := env.RequireMiniOSRoot(ctx)
 			if err != nil {
 				return err
 			}
@@ -0,0 +1,76 @@
+package build
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/unigornel/unigornel/settings"
+	"github.com/unigornel/unigornel/unigornel/manifest"
+	"github.com/urfave/cli"
+)
+
+const setFlagName = "set"
+
+func setFlag() cli.Flag {
+	return cli.StringSliceFlag{
+		Name:  setFlagName,
+		Usage: "set a setting declared in " + manifest.FileName + " (KEY=VALUE, can be repeated)",
+	}
+}
+
+// SettingsError lists all problems with the settings of a build.
+type SettingsError []string
+
+func (e SettingsError) Error() string {
+	return "invalid settings:\n  " + strings.Join(e, "\n  ")
+}
+
+// resolveSettings checks the KEY=VALUE assignments against the settings
+// declared in the manifest and applies the defaults.
+func resolveSettings(m manifest.Manifest, assignments []string) (map[string]string, error) {
+	var problems SettingsError
+	values := make(map[string]string)
+
+	for _, a := range assignments {
+		parts := strings.SplitN(a, "=", 2)
+		if len(parts) != 2 {
+			problems = append(problems, fmt.Sprintf("%v: expected KEY=VALUE", a))
+			continue
+		}
+
+		key, value := parts[0], parts[1]
+		s, ok := m.Settings[key]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%v: not declared in %v", key, manifest.FileName))
+			continue
+		}
+		if err := s.Type.Check(value); err != nil {
+			problems = append(problems, fmt.Sprintf("%v: %v", key, err))
+			continue
+		}
+		values[key] = value
+	}
+
+	for _, key := range m.SettingNames() {
+		if _, ok := values[key]; ok {
+			continue
+		}
+
+		s := m.Settings[key]
+		if s.Required {
+			problems = append(problems, fmt.Sprintf("%v: required (use --set %v=VALUE)", key, key))
+		} else if s.Default != "" {
+			values[key] = s.Default
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, problems
+	}
+	return values, nil
+}
+
+// settingsLDFlags returns the linker flag that sets the values.
+func settingsLDFlags(values map[string]string) string {
+	return "-X " + settings.Symbol + "=" + settings.Encode(values)
+}
@@ -0,0 +1,54 @@
+package build
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/unigornel/unigornel/settings"
+	"github.com/unigornel/unigornel/unigornel/manifest"
+)
+
+func TestResolveSettings(t *testing.T) {
+	m := manifest.Manifest{
+		Name: "ping",
+		Settings: map[string]settings.Setting{
+			"ip_address": {Type: settings.TypeIPv4, Default: "10.0.100.2"},
+			"ip_gateway": {Type: settings.TypeIPv4},
+			"count":      {Type: settings.TypeInt, Required: true},
+		},
+	}
+
+	cases := []struct {
+		Set         []string
+		Values      map[string]string
+		ErrorRegexp *regexp.Regexp
+	}{
+		{
+			Set:    []string{"count=3"},
+			Values: map[string]string{"ip_address": "10.0.100.2", "count": "3"},
+		},
+		{
+			Set:    []string{"count=3", "ip_address=10.0.0.1", "ip_gateway=10.0.0.254"},
+			Values: map[string]string{"ip_address": "10.0.0.1", "ip_gateway": "10.0.0.254", "count": "3"},
+		},
+		{
+			Set:         []string{},
+			ErrorRegexp: regexp.MustCompile("count: required"),
+		},
+		{
+			Set:         []string{"count=three", "ip_address=10.0.0.300", "mtu=1500", "ip_gateway"},
+			ErrorRegexp: regexp.MustCompile(`(?s)count: 'three' is not a valid int.*ip_address: '10.0.0.300' is not a valid ipv4.*mtu: not declared.*ip_gateway: expected KEY=VALUE`),
+		},
+	}
+
+	for i, c := range cases {
+		values, err := resolveSettings(m, c.Set)
+		if c.ErrorRegexp == nil {
+			assert.Nil(t, err, "for test %d", i)
+			assert.Equal(t, c.Values, values, "for test %d", i)
+		} else if assert.NotNil(t, err, "for test %d", i) {
+			assert.True(t, c.ErrorRegexp.MatchString(err.Error()), "for test %d: %v", i, err)
+		}
+	}
+}
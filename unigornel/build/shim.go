@@ -0,0 +1,170 @@
+package build
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// shimFile is the file that is generated in the package directory to export
+// Main for a plain main package.
+const shimFile = "zz_unigornel_main.go"
+
+// shimSource exports Main, which Mini-OS calls, and runs the main function
+// of the program. The build constraint keeps a leftover shim from breaking
+// ordinary builds.
+const shimSource = `// Code generated by unigornel build. DO NOT EDIT.
+
+// +build unigornel
+
+package main
+
+import "C"
+
+//export Main
+func Main(unused int) {
+	main()
+}
+`
+
+// mainPackage describes how a main package starts.
+type mainPackage struct {
+	Dir        string
+	ExportMain bool
+	HasMain    bool
+	HasMainFn  bool
+}
+
+// packageDir returns the directory of the package to build.
+func packageDir(goroot, pkg string) (string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	if pkg == "" {
+		return wd, nil
+	}
+
+	ctx := build.Default
+	if goroot != "" {
+		ctx.GOROOT = goroot
+	}
+	p, err := ctx.Import(pkg, wd, build.FindOnly)
+	if err != nil {
+		return "", err
+	}
+	return p.Dir, nil
+}
+
+// inspectMainPackage parses the Go files of the package in dir that are
+// built for GOOS=unigornel. It returns nil if dir is not a main package.
+func inspectMainPackage(dir string) (*mainPackage, error) {
+	ctx := build.Default
+	ctx.GOOS = "unigornel"
+	ctx.GOARCH = "amd64"
+	ctx.CgoEnabled = true
+	ctx.BuildTags = append(ctx.BuildTags, "unigornel")
+
+	p, err := ctx.ImportDir(dir, 0)
+	if err != nil {
+		if _, ok := err.(*build.NoGoError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if p.Name != "main" {
+		return nil, nil
+	}
+
+	m := &mainPackage{Dir: dir}
+	fset := token.NewFileSet()
+	for _, name := range append(p.GoFiles, p.CgoFiles...) {
+		if name == shimFile {
+			continue
+		}
+
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv != nil {
+				continue
+			}
+			switch fn.Name.Name {
+			case "main":
+				m.HasMain = true
+			case "Main":
+				m.HasMainFn = true
+				m.ExportMain = m.ExportMain || exportsMain(fn)
+			}
+		}
+	}
+	return m, nil
+}
+
+func exportsMain(fn *ast.FuncDecl) bool {
+	if fn.Doc == nil {
+		return false
+	}
+	for _, c := range fn.Doc.List {
+		if strings.TrimSpace(c.Text) == "//export Main" {
+			return true
+		}
+	}
+	return false
+}
+
+// needsShim reports whether the package is a plain main package that needs
+// a generated Main.
+func (m *mainPackage) needsShim() (bool, error) {
+	switch {
+	case m.ExportMain:
+		return false, nil
+	case m.HasMainFn:
+		return false, fmt.Errorf("%v: Main is defined but not exported (add //export Main, or remove Main to use main)", m.Dir)
+	case !m.HasMain:
+		return false, fmt.Errorf("%v: no main function", m.Dir)
+	}
+	return true, nil
+}
+
+// generateMainShim writes the shim to a plain main package. The returned
+// function removes the shim again.
+func generateMainShim(options GoOptions) (func(), error) {
+	noop := func() {}
+
+	dir, err := packageDir(options.GoRoot, options.Package)
+	if err != nil {
+		return noop, err
+	}
+
+	m, err := inspectMainPackage(dir)
+	if err != nil || m == nil {
+		return noop, err
+	}
+
+	shim, err := m.needsShim()
+	if err != nil || !shim {
+		return noop, err
+	}
+
+	file := filepath.Join(dir, shimFile)
+	fmt.Println("[+] generating Main for func main in", file)
+	if err := ioutil.WriteFile(file, []byte(shimSource), 0644); err != nil {
+		return noop, err
+	}
+	return func() {
+		if err := os.Remove(file); err != nil {
+			fmt.Println("[-] warning:", err)
+		}
+	}, nil
+}
@@ -0,0 +1,83 @@
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNeedsShim(t *testing.T) {
+	cases := []struct {
+		Files       map[string]string
+		Shim        bool
+		ErrorRegexp *regexp.Regexp
+	}{
+		{
+			Files: map[string]string{"main.go": "package main\n\nfunc main() {}\n"},
+			Shim:  true,
+		},
+		{
+			Files: map[string]string{
+				"main.go": "package main\n\nimport \"C\"\n\nfunc main() {}\n\n//export Main\nfunc Main(unused int) {}\n",
+			},
+			Shim: false,
+		},
+		{
+			Files: map[string]string{
+				"main.go": "package main\n\nfunc main() {}\n",
+				shimFile:  shimSource,
+			},
+			Shim: true,
+		},
+		{
+			Files: map[string]string{
+				"main.go":       "package main\n\nfunc helper() {}\n",
+				"main_linux.go": "package main\n\nfunc main() {}\n",
+			},
+			ErrorRegexp: regexp.MustCompile("no main function"),
+		},
+		{
+			Files:       map[string]string{"main.go": "package main\n\nfunc main() {}\n\nfunc Main(unused int) {}\n"},
+			ErrorRegexp: regexp.MustCompile("Main is defined but not exported"),
+		},
+	}
+
+	for i, c := range cases {
+		dir, err := ioutil.TempDir("", "unigornel-shim")
+		require.Nil(t, err)
+		defer os.RemoveAll(dir)
+
+		for name, content := range c.Files {
+			require.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+		}
+
+		m, err := inspectMainPackage(dir)
+		require.Nil(t, err, "for test %d", i)
+		require.NotNil(t, m, "for test %d", i)
+
+		shim, err := m.needsShim()
+		if c.ErrorRegexp == nil {
+			assert.Nil(t, err, "for test %d", i)
+			assert.Equal(t, c.Shim, shim, "for test %d", i)
+		} else if assert.NotNil(t, err, "for test %d", i) {
+			assert.True(t, c.ErrorRegexp.MatchString(err.Error()), "for test %d: %v", i, err)
+		}
+	}
+}
+
+func TestInspectLibraryPackage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unigornel-shim")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "lib.go"), []byte("package lib\n"), 0644))
+
+	m, err := inspectMainPackage(dir)
+	assert.Nil(t, err)
+	assert.Nil(t, m)
+}
@@ -1,17 +1,136 @@
 package config
 
-import "gopkg.in/yaml.v2"
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
 
 // Config holds the unigornel configuration.
+//
+// The top-level goroot, minios and libraries form the unnamed toolchain.
+// Named toolchains inherit the top-level values they do not set.
 type Config struct {
-	GoRoot    string `yaml:"goroot"`
-	MiniOS    string `yaml:"minios"`
-	Libraries string `yaml:"libraries"`
+	// Version is the schema version of the file. Files without a
+	// version are migrated when they are read.
+	Version int `yaml:"version,omitempty"`
+
+	GoRoot    string `yaml:"goroot,omitempty"`
+	MiniOS    string `yaml:"minios,omitempty"`
+	Libraries string `yaml:"libraries,omitempty"`
+
+	// Mirror is a directory of bare library repositories that is used
+	// instead of the origin of each library.
+	Mirror string `yaml:"mirror,omitempty"`
+
+	// Templates is a directory of project templates for `unigornel new`.
+	// Each subdirectory is a template.
+	Templates string `yaml:"templates,omitempty"`
+
+	// Default is the name of the toolchain that is used when none is
+	// selected.
+	Default    string               `yaml:"default,omitempty"`
+	Toolchains map[string]Toolchain `yaml:"toolchains,omitempty"`
+}
+
+// Toolchain is a named combination of a Go fork and Mini-OS.
+type Toolchain struct {
+	GoRoot    string `yaml:"goroot,omitempty"`
+	MiniOS    string `yaml:"minios,omitempty"`
+	Libraries string `yaml:"libraries,omitempty"`
+}
+
+// Toolchain returns the configuration with the named toolchain applied to
+// the top-level values. An empty name selects the default toolchain, or the
+// unnamed toolchain if there is no default.
+func (c Config) Toolchain(name string) (Config, error) {
+	if name == "" {
+		name = c.Default
+	}
+	if name == "" {
+		return c, nil
+	}
+
+	t, ok := c.Toolchains[name]
+	if !ok {
+		return c, fmt.Errorf("unknown toolchain '%v' (known: %v)", name, c.ToolchainNames())
+	}
+
+	if t.GoRoot != "" {
+		c.GoRoot = t.GoRoot
+	}
+	if t.MiniOS != "" {
+		c.MiniOS = t.MiniOS
+	}
+	if t.Libraries != "" {
+		c.Libraries = t.Libraries
+	}
+	return c, nil
 }
 
-// ParseConfig will parse a Config object from YAML data.
+// resolvePaths makes the relative paths in the configuration relative to
+// dir instead of the working directory.
+func (c Config) resolvePaths(dir string) Config {
+	resolve := func(p string) string {
+		if p == "" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(dir, p)
+	}
+
+	c.GoRoot = resolve(c.GoRoot)
+	c.MiniOS = resolve(c.MiniOS)
+	c.Libraries = resolve(c.Libraries)
+	c.Mirror = resolve(c.Mirror)
+	c.Templates = resolve(c.Templates)
+
+	toolchains := make(map[string]Toolchain, len(c.Toolchains))
+	for name, t := range c.Toolchains {
+		t.GoRoot = resolve(t.GoRoot)
+		t.MiniOS = resolve(t.MiniOS)
+		t.Libraries = resolve(t.Libraries)
+		toolchains[name] = t
+	}
+	if c.Toolchains != nil {
+		c.Toolchains = toolchains
+	}
+	return c
+}
+
+// ToolchainNames returns the sorted names of the named toolchains.
+func (c Config) ToolchainNames() []string {
+	names := make([]string, 0, len(c.Toolchains))
+	for name := range c.Toolchains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseConfig will parse a Config object from YAML data. Older versions
+// of the schema are migrated, and unknown keys are an error.
 func ParseConfig(data []byte) (Config, error) {
 	var c Config
-	err := yaml.Unmarshal(data, &c)
+
+	migrated, err := migrate(data)
+	if err != nil {
+		return c, err
+	}
+
+	err = yaml.UnmarshalStrict(migrated, &c)
 	return c, err
 }
+
+// WriteConfig will write a Config object as YAML to a file. It replaces the
+// whole file; use OpenFile to edit a file without losing its comments.
+func WriteConfig(file string, c Config) error {
+	c.Version = CurrentVersion
+	data, err := yaml.Marshal(&c)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0644)
+}
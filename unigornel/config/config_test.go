@@ -0,0 +1,130 @@
+package config
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConfig(t *testing.T) {
+	cases := []struct {
+		Input       string
+		ErrorRegexp *regexp.Regexp
+		Config      Config
+	}{
+		{
+			Input: "goroot: /go\nminios: /minios\n",
+			Config: Config{
+				Version: CurrentVersion,
+				GoRoot:  "/go",
+				MiniOS:  "/minios",
+			},
+		},
+		{
+			Input: "version: 1\ndefault: next\ntoolchains:\n  next:\n    goroot: /next\n",
+			Config: Config{
+				Version:    1,
+				Default:    "next",
+				Toolchains: map[string]Toolchain{"next": {GoRoot: "/next"}},
+			},
+		},
+		{
+			Input:       "goroot: /go\nminis: /minios\n",
+			ErrorRegexp: regexp.MustCompile("minis not found"),
+		},
+		{
+			Input:       "version: 99\n",
+			ErrorRegexp: regexp.MustCompile("newer than the supported version"),
+		},
+	}
+
+	for i, c := range cases {
+		config, err := ParseConfig([]byte(c.Input))
+		if c.ErrorRegexp == nil {
+			assert.Nil(t, err, "for test %d", i)
+			assert.Equal(t, c.Config, config, "for test %d", i)
+		} else if assert.NotNil(t, err, "for test %d", i) {
+			assert.True(t, c.ErrorRegexp.MatchString(err.Error()), "for test %d: %v", i, err)
+		}
+	}
+}
+
+func TestLayersMerged(t *testing.T) {
+	layers := Layers{
+		{Origin: "/etc/unigornel.yaml", Config: Config{GoRoot: "/system/go", MiniOS: "/system/minios"}},
+		{Origin: "/home/user/.unigornel.yaml", Config: Config{
+			MiniOS:     "/user/minios",
+			Toolchains: map[string]Toolchain{"next": {GoRoot: "/next/go"}},
+		}},
+		{Origin: "env", Config: Config{MiniOS: "/env/minios"}, origins: map[string]string{"minios": "env:UNIGORNEL_MINIOS"}},
+	}
+
+	c := layers.Merged()
+	assert.Equal(t, "/system/go", c.GoRoot)
+	assert.Equal(t, "/env/minios", c.MiniOS)
+	assert.Equal(t, Toolchain{GoRoot: "/next/go"}, c.Toolchains["next"])
+
+	assert.Equal(t, "/etc/unigornel.yaml", layers.Origin("goroot"))
+	assert.Equal(t, "env:UNIGORNEL_MINIOS", layers.Origin("minios"))
+	assert.Equal(t, "/home/user/.unigornel.yaml", layers.Origin("toolchains.next.goroot"))
+	assert.Equal(t, "", layers.Origin("mirror"))
+
+	next, err := c.Toolchain("next")
+	assert.Nil(t, err)
+	assert.Equal(t, "/next/go", next.GoRoot)
+	assert.Equal(t, "/env/minios", next.MiniOS)
+}
+
+func TestLayersToolchain(t *testing.T) {
+	file := Layer{Origin: "/home/user/.unigornel.yaml", Config: Config{
+		Default: "stable",
+		Toolchains: map[string]Toolchain{
+			"stable": {GoRoot: "/stable/go", MiniOS: "/stable/minios", Libraries: "/stable/libraries.yaml"},
+			"next":   {GoRoot: "/next/go", MiniOS: "/next/minios"},
+		},
+	}}
+	environment := Layer{
+		Origin:  "env",
+		Config:  Config{GoRoot: "/env/go", MiniOS: "/env/minios"},
+		origins: map[string]string{"goroot": "env:UNIGORNEL_GOROOT", "minios": "env:UNIGORNEL_MINIOS"},
+	}
+
+	cases := []struct {
+		Layers    Layers
+		Name      string
+		GoRoot    string
+		MiniOS    string
+		Libraries string
+	}{
+		{Layers{file}, "", "/stable/go", "/stable/minios", "/stable/libraries.yaml"},
+		{Layers{file, environment}, "", "/env/go", "/env/minios", "/stable/libraries.yaml"},
+		{Layers{file, environment}, "next", "/next/go", "/next/minios", ""},
+	}
+
+	for i, c := range cases {
+		config, err := c.Layers.Toolchain(c.Name)
+		assert.Nil(t, err, "for test %d", i)
+		assert.Equal(t, c.GoRoot, config.GoRoot, "for test %d", i)
+		assert.Equal(t, c.MiniOS, config.MiniOS, "for test %d", i)
+		assert.Equal(t, c.Libraries, config.Libraries, "for test %d", i)
+	}
+
+	_, err := Layers{file, environment}.Toolchain("unknown")
+	assert.NotNil(t, err)
+}
+
+func TestResolvePaths(t *testing.T) {
+	c := Config{
+		GoRoot:     "/opt/go",
+		MiniOS:     "minios",
+		Libraries:  "../libraries.yaml",
+		Toolchains: map[string]Toolchain{"next": {GoRoot: "next/go"}},
+	}.resolvePaths("/project")
+
+	assert.Equal(t, "/opt/go", c.GoRoot)
+	assert.Equal(t, "/project/minios", c.MiniOS)
+	assert.Equal(t, "/libraries.yaml", c.Libraries)
+	assert.Equal(t, "", c.Mirror)
+	assert.Equal(t, "/project/next/go", c.Toolchains["next"].GoRoot)
+}
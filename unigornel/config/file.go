@@ -0,0 +1,205 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// File is a single configuration file that can be edited without losing
+// the ordering and the comments of the original document.
+type File struct {
+	Path string
+	doc  yaml.Node
+}
+
+// OpenFile reads a configuration file for editing. A missing file is an
+// empty configuration.
+func OpenFile(file string) (*File, error) {
+	f := &File{Path: file}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := f.parse(data); err != nil {
+		return nil, fmt.Errorf("%v: %v", file, err)
+	}
+	return f, nil
+}
+
+func (f *File) parse(data []byte) error {
+	if err := yaml.Unmarshal(data, &f.doc); err != nil {
+		return err
+	}
+	if f.doc.Kind == 0 {
+		f.doc = yaml.Node{
+			Kind:    yaml.DocumentNode,
+			Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}},
+		}
+	}
+	if len(f.doc.Content) != 1 || f.doc.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("expected a mapping at the top level")
+	}
+	return nil
+}
+
+// Version returns the schema version of the file.
+func (f *File) Version() (int, error) {
+	return documentVersion(&f.doc)
+}
+
+// Migrate upgrades the file to the current version of the schema.
+func (f *File) Migrate() error {
+	return migrateDocument(&f.doc)
+}
+
+// Config decodes the current contents of the file.
+func (f *File) Config() (Config, error) {
+	data, err := f.encode()
+	if err != nil {
+		return Config{}, err
+	}
+	return ParseConfig(data)
+}
+
+// Set changes the value of a key, like Config.Set. An empty value removes
+// the key. Other keys keep their position and comments.
+func (f *File) Set(key, value string) error {
+	var c Config
+	if err := c.Set(key, value); err != nil {
+		return err
+	}
+
+	root := f.doc.Content[0]
+	parts := strings.Split(key, ".")
+	if len(parts) == 1 {
+		setMappingValue(root, key, value)
+		return nil
+	}
+
+	toolchains := mappingValue(root, parts[0])
+	if toolchains == nil || toolchains.Kind != yaml.MappingNode {
+		if value == "" {
+			return nil
+		}
+		toolchains = setMappingNode(root, parts[0])
+	}
+
+	t := mappingValue(toolchains, parts[1])
+	if t == nil || t.Kind != yaml.MappingNode {
+		if value == "" {
+			return nil
+		}
+		t = setMappingNode(toolchains, parts[1])
+	}
+
+	setMappingValue(t, parts[2], value)
+	if len(t.Content) == 0 {
+		removeMappingKey(toolchains, parts[1])
+	}
+	if len(toolchains.Content) == 0 {
+		removeMappingKey(root, parts[0])
+	}
+	return nil
+}
+
+// Save migrates the file and writes it. It refuses to write a file that
+// does not parse.
+func (f *File) Save() error {
+	if err := f.Migrate(); err != nil {
+		return fmt.Errorf("%v: %v", f.Path, err)
+	}
+
+	data, err := f.encode()
+	if err != nil {
+		return err
+	}
+	if _, err := ParseConfig(data); err != nil {
+		return fmt.Errorf("%v: %v", f.Path, err)
+	}
+	return ioutil.WriteFile(f.Path, data, 0644)
+}
+
+func (f *File) encode() ([]byte, error) {
+	var b bytes.Buffer
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(&f.doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	if m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setMappingValue sets a scalar value in place, so that it keeps its
+// comments. An empty value removes the key.
+func setMappingValue(m *yaml.Node, key, value string) {
+	if value == "" {
+		removeMappingKey(m, key)
+		return
+	}
+
+	tag := "!!str"
+	if key == "version" {
+		tag = "!!int"
+	}
+
+	if v := mappingValue(m, key); v != nil {
+		v.Kind = yaml.ScalarNode
+		v.Tag = tag
+		v.Style = 0
+		v.Value = value
+		v.Content = nil
+		return
+	}
+
+	k := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}
+	v := &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+	if key == "version" {
+		// The version goes first, where readers expect it.
+		m.Content = append([]*yaml.Node{k, v}, m.Content...)
+	} else {
+		m.Content = append(m.Content, k, v)
+	}
+}
+
+// setMappingNode replaces the value of the key by an empty mapping.
+func setMappingNode(m *yaml.Node, key string) *yaml.Node {
+	n := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content[i+1] = n
+			return n
+		}
+	}
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, n)
+	return n
+}
+
+func removeMappingKey(m *yaml.Node, key string) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content = append(m.Content[:i], m.Content[i+2:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrate(t *testing.T) {
+	cases := []struct {
+		Input       string
+		Output      string
+		ErrorRegexp *regexp.Regexp
+	}{
+		{
+			Input:  "# the go fork\ngoroot: /go # built\nminios: /minios\n",
+			Output: "version: 1\n# the go fork\ngoroot: /go # built\nminios: /minios\n",
+		},
+		{
+			Input:  "version: 0\ngoroot: /go\n",
+			Output: "version: 1\ngoroot: /go\n",
+		},
+		{
+			Input:  "",
+			Output: "version: 1\n",
+		},
+		{
+			Input:  "version: 1\n# kept as is\ngoroot:   /go\n",
+			Output: "version: 1\n# kept as is\ngoroot:   /go\n",
+		},
+		{
+			Input:       "version: 2\ngoroot: /go\n",
+			ErrorRegexp: regexp.MustCompile("configuration version 2 is newer than the supported version 1"),
+		},
+		{
+			Input:       "version: next\n",
+			ErrorRegexp: regexp.MustCompile("invalid configuration version 'next'"),
+		},
+		{
+			Input:       "version: -1\n",
+			ErrorRegexp: regexp.MustCompile("invalid configuration version '-1'"),
+		},
+		{
+			Input:       "- goroot\n",
+			ErrorRegexp: regexp.MustCompile("expected a mapping at the top level"),
+		},
+	}
+
+	for i, c := range cases {
+		out, err := migrate([]byte(c.Input))
+		if c.ErrorRegexp == nil {
+			assert.Nil(t, err, "for test %d", i)
+			assert.Equal(t, c.Output, string(out), "for test %d", i)
+		} else if assert.NotNil(t, err, "for test %d", i) {
+			assert.True(t, c.ErrorRegexp.MatchString(err.Error()), "for test %d: %v", i, err)
+		}
+	}
+}
+
+func TestFileSet(t *testing.T) {
+	type set struct {
+		Key   string
+		Value string
+	}
+
+	input := `# system toolchain
+goroot: /go # built by hand
+minios: /minios
+
+# toolchains to try
+toolchains:
+  next:
+    goroot: /next/go # master
+`
+
+	cases := []struct {
+		Input  string
+		Set    []set
+		Output string
+	}{
+		{
+			Input: input,
+			Set:   []set{{"goroot", "/stable/go"}, {"mirror", "/mirror"}},
+			Output: `version: 1
+# system toolchain
+goroot: /stable/go # built by hand
+minios: /minios
+# toolchains to try
+toolchains:
+  next:
+    goroot: /next/go # master
+mirror: /mirror
+`,
+		},
+		{
+			Input: input,
+			Set:   []set{{"toolchains.next.minios", "/next/minios"}, {"toolchains.dev.goroot", "/dev/go"}, {"minios", ""}},
+			Output: `version: 1
+# system toolchain
+goroot: /go # built by hand
+# toolchains to try
+toolchains:
+  next:
+    goroot: /next/go # master
+    minios: /next/minios
+  dev:
+    goroot: /dev/go
+`,
+		},
+		{
+			Input: input,
+			Set:   []set{{"toolchains.next.goroot", ""}, {"toolchains.dev.goroot", ""}},
+			Output: `version: 1
+# system toolchain
+goroot: /go # built by hand
+minios: /minios
+`,
+		},
+		{
+			Input:  "",
+			Set:    []set{{"default", "next"}, {"toolchains.next.goroot", "/next/go"}},
+			Output: "version: 1\ndefault: next\ntoolchains:\n  next:\n    goroot: /next/go\n",
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "unigornel-config")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	for i, c := range cases {
+		file := filepath.Join(dir, "config.yaml")
+		os.Remove(file)
+		if c.Input != "" {
+			require.Nil(t, ioutil.WriteFile(file, []byte(c.Input), 0644))
+		}
+
+		f, err := OpenFile(file)
+		if !assert.Nil(t, err, "for test %d", i) {
+			continue
+		}
+		for _, s := range c.Set {
+			assert.Nil(t, f.Set(s.Key, s.Value), "for test %d", i)
+		}
+		assert.Nil(t, f.Save(), "for test %d", i)
+
+		out, err := ioutil.ReadFile(file)
+		assert.Nil(t, err, "for test %d", i)
+		assert.Equal(t, c.Output, string(out), "for test %d", i)
+	}
+}
+
+func TestFileSetErrors(t *testing.T) {
+	f, err := OpenFile(filepath.Join(os.TempDir(), "unigornel-missing.yaml"))
+	require.Nil(t, err)
+
+	assert.NotNil(t, f.Set("gorot", "/go"))
+	assert.NotNil(t, f.Set("toolchains.next.gorot", "/go"))
+	assert.NotNil(t, f.Set("toolchains..goroot", "/go"))
+}
@@ -0,0 +1,300 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// SystemConfigPath is the system-wide configuration file.
+	SystemConfigPath = "/etc/unigornel.yaml"
+
+	// ProjectConfigName is the name of the project-local configuration
+	// file. It is found by walking up from the working directory.
+	ProjectConfigName = ".unigornel.yaml"
+
+	// envOrigin is the origin of the environment layer.
+	envOrigin = "env"
+)
+
+// The environment variables that override configuration keys.
+var envKeys = []struct {
+	Key string
+	Env string
+}{
+	{"goroot", "UNIGORNEL_GOROOT"},
+	{"minios", "UNIGORNEL_MINIOS"},
+	{"libraries", "UNIGORNEL_LIBRARIES"},
+	{"mirror", "UNIGORNEL_LIBS_MIRROR"},
+	{"default", "UNIGORNEL_TOOLCHAIN"},
+}
+
+// Layer is a source of configuration values.
+type Layer struct {
+	// Origin is the path of the file, or "env" for the environment.
+	Origin string
+	Config Config
+
+	// origins maps keys to a more specific origin, such as the
+	// environment variable that set the key.
+	origins map[string]string
+}
+
+// Layers are configuration layers, from the lowest to the highest
+// precedence.
+type Layers []Layer
+
+// UserConfigPath returns the path of the configuration file of the current
+// user.
+func UserConfigPath() (string, error) {
+	u, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(u.HomeDir, ProjectConfigName), nil
+}
+
+// FindProjectConfig walks up from dir and returns the first project-local
+// configuration file, or an empty string if there is none.
+func FindProjectConfig(dir string) string {
+	for {
+		p := filepath.Join(dir, ProjectConfigName)
+		if info, err := os.Stat(p); err == nil && !info.IsDir() {
+			return p
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// ReadConfig reads a single configuration file.
+func ReadConfig(file string) (Config, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return Config{}, err
+	}
+
+	c, err := ParseConfig(data)
+	if err != nil {
+		return c, fmt.Errorf("%v: %v", file, err)
+	}
+	return c, nil
+}
+
+// LoadLayers reads all configuration layers. In increasing precedence these
+// are the system file, the user file, the project file, the explicit file
+// and the environment. Missing files are skipped, except for the explicit
+// file, which may be empty. Relative paths in a file are relative to the
+// directory of that file.
+func LoadLayers(explicit string) (Layers, error) {
+	var files []string
+	files = append(files, SystemConfigPath)
+
+	userFile, err := UserConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, userFile)
+
+	if wd, err := os.Getwd(); err == nil {
+		if p := FindProjectConfig(wd); p != "" && !sameFile(p, userFile) {
+			files = append(files, p)
+		}
+	}
+
+	var layers Layers
+	for _, f := range files {
+		c, err := ReadConfig(f)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		layers = append(layers, Layer{Origin: f, Config: c.resolvePaths(filepath.Dir(f))})
+	}
+
+	if explicit != "" {
+		c, err := ReadConfig(explicit)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, Layer{Origin: explicit, Config: c.resolvePaths(filepath.Dir(explicit))})
+	}
+
+	if l, ok := environmentLayer(); ok {
+		layers = append(layers, l)
+	}
+	return layers, nil
+}
+
+func environmentLayer() (Layer, bool) {
+	l := Layer{
+		Origin:  envOrigin,
+		origins: make(map[string]string),
+	}
+	for _, e := range envKeys {
+		if v := os.Getenv(e.Env); v != "" {
+			l.Config.Set(e.Key, v)
+			l.origins[e.Key] = "env:" + e.Env
+		}
+	}
+	return l, len(l.origins) > 0
+}
+
+func sameFile(a, b string) bool {
+	ia, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	ib, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(ia, ib)
+}
+
+// Merged returns the configuration with the values of the higher layers
+// replacing those of the lower layers.
+func (layers Layers) Merged() Config {
+	var c Config
+	for _, l := range layers {
+		for _, kv := range l.Config.Values() {
+			c.Set(kv.Key, kv.Value)
+		}
+	}
+	return c
+}
+
+// Toolchain merges the layers and applies the named toolchain. Without a
+// name, the toolchain values in the environment replace those of the
+// selected toolchain, so a shell that was set up with `unigornel env` keeps
+// its toolchain when the configuration has a default. An explicit name wins
+// over the environment.
+func (layers Layers) Toolchain(name string) (Config, error) {
+	c, err := layers.Merged().Toolchain(name)
+	if err != nil || name != "" {
+		return c, err
+	}
+
+	for _, l := range layers {
+		if l.Origin != envOrigin {
+			continue
+		}
+		for _, key := range []string{"goroot", "minios", "libraries"} {
+			if v, ok := l.Config.Get(key); ok {
+				c.Set(key, v)
+			}
+		}
+	}
+	return c, nil
+}
+
+// Origin returns where the value of the key comes from, or an empty string
+// if the key is not set.
+func (layers Layers) Origin(key string) string {
+	for i := len(layers) - 1; i >= 0; i-- {
+		l := layers[i]
+		if _, ok := l.Config.Get(key); !ok {
+			continue
+		}
+		if o, ok := l.origins[key]; ok {
+			return o
+		}
+		return l.Origin
+	}
+	return ""
+}
+
+// KeyValue is a configuration key and its value.
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+// Values returns all keys that are set, in the order of the file format.
+func (c Config) Values() []KeyValue {
+	var kvs []KeyValue
+	add := func(key, value string) {
+		if value != "" {
+			kvs = append(kvs, KeyValue{key, value})
+		}
+	}
+
+	add("goroot", c.GoRoot)
+	add("minios", c.MiniOS)
+	add("libraries", c.Libraries)
+	add("mirror", c.Mirror)
+	add("default", c.Default)
+	add("templates", c.Templates)
+	for _, name := range c.ToolchainNames() {
+		t := c.Toolchains[name]
+		add("toolchains."+name+".goroot", t.GoRoot)
+		add("toolchains."+name+".minios", t.MiniOS)
+		add("toolchains."+name+".libraries", t.Libraries)
+	}
+	return kvs
+}
+
+// Get returns the value of a key, and whether it is set.
+func (c Config) Get(key string) (string, bool) {
+	for _, kv := range c.Values() {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return "", false
+}
+
+// Set changes the value of a key. An empty value unsets the key.
+func (c *Config) Set(key, value string) error {
+	switch key {
+	case "goroot":
+		c.GoRoot = value
+	case "minios":
+		c.MiniOS = value
+	case "libraries":
+		c.Libraries = value
+	case "mirror":
+		c.Mirror = value
+	case "default":
+		c.Default = value
+	case "templates":
+		c.Templates = value
+	default:
+		parts := strings.Split(key, ".")
+		if len(parts) != 3 || parts[0] != "toolchains" || parts[1] == "" {
+			return fmt.Errorf("unknown configuration key '%v'", key)
+		}
+
+		name := parts[1]
+		t := c.Toolchains[name]
+		switch parts[2] {
+		case "goroot":
+			t.GoRoot = value
+		case "minios":
+			t.MiniOS = value
+		case "libraries":
+			t.Libraries = value
+		default:
+			return fmt.Errorf("unknown configuration key '%v'", key)
+		}
+
+		if c.Toolchains == nil {
+			c.Toolchains = make(map[string]Toolchain)
+		}
+		if t == (Toolchain{}) {
+			delete(c.Toolchains, name)
+		} else {
+			c.Toolchains[name] = t
+		}
+	}
+	return nil
+}
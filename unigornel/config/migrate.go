@@ -0,0 +1,78 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentVersion is the schema version written by this version of
+// unigornel.
+const CurrentVersion = 1
+
+// migrations upgrade the top-level mapping of a configuration from version i
+// to version i+1. They edit the document in place, so that comments survive.
+var migrations = []func(*yaml.Node) error{
+	// Version 0 files were written before the schema was versioned.
+	// Their keys are unchanged in version 1.
+	func(m *yaml.Node) error {
+		return nil
+	},
+}
+
+func documentVersion(doc *yaml.Node) (int, error) {
+	v := mappingValue(doc.Content[0], "version")
+	if v == nil {
+		return 0, nil
+	}
+
+	version, err := strconv.Atoi(v.Value)
+	if err != nil || version < 0 {
+		return 0, fmt.Errorf("invalid configuration version '%v'", v.Value)
+	}
+	return version, nil
+}
+
+// migrateDocument upgrades the document to the current version.
+func migrateDocument(doc *yaml.Node) error {
+	version, err := documentVersion(doc)
+	if err != nil {
+		return err
+	}
+
+	if version > CurrentVersion {
+		return fmt.Errorf("configuration version %d is newer than the supported version %d", version, CurrentVersion)
+	} else if version == CurrentVersion {
+		return nil
+	}
+
+	root := doc.Content[0]
+	for v := version; v < CurrentVersion; v++ {
+		if err := migrations[v](root); err != nil {
+			return fmt.Errorf("migrating configuration from version %d: %v", v, err)
+		}
+	}
+	setMappingValue(root, "version", strconv.Itoa(CurrentVersion))
+	return nil
+}
+
+// migrate upgrades the configuration in data to the current version.
+func migrate(data []byte) ([]byte, error) {
+	var f File
+	if err := f.parse(data); err != nil {
+		return nil, err
+	}
+
+	version, err := f.Version()
+	if err != nil {
+		return nil, err
+	} else if version == CurrentVersion {
+		return data, nil
+	}
+
+	if err := f.Migrate(); err != nil {
+		return nil, err
+	}
+	return f.encode()
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ValidationError lists all problems found in a configuration.
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e, "\n  ")
+}
+
+// Validate checks that the paths in the configuration exist and hold what
+// unigornel expects. Named toolchains are validated after merging them with
+// the top-level values.
+func (c Config) Validate() error {
+	var problems ValidationError
+	add := func(prefix string, err error) {
+		if err != nil {
+			problems = append(problems, prefix+err.Error())
+		}
+	}
+
+	if c.Default != "" {
+		if _, ok := c.Toolchains[c.Default]; !ok {
+			problems = append(problems, fmt.Sprintf("default: unknown toolchain '%v'", c.Default))
+		}
+	}
+
+	if c.GoRoot != "" || c.MiniOS != "" || len(c.Toolchains) == 0 {
+		problems = append(problems, c.validateSelected("")...)
+	}
+
+	for _, name := range c.ToolchainNames() {
+		t, _ := c.Toolchain(name)
+		problems = append(problems, t.validateSelected("toolchains."+name+".")...)
+	}
+
+	if c.Mirror != "" {
+		add("mirror: ", requireDir(c.Mirror))
+	}
+	if c.Templates != "" {
+		add("templates: ", requireDir(c.Templates))
+	}
+
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// ValidateSelected checks the top-level goroot, minios and libraries, which
+// hold the selected toolchain after calling Toolchain.
+func (c Config) ValidateSelected() error {
+	if problems := c.validateSelected(""); len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+func (c Config) validateSelected(prefix string) ValidationError {
+	var problems ValidationError
+	add := func(key string, err error) {
+		if err != nil {
+			problems = append(problems, prefix+key+": "+err.Error())
+		}
+	}
+
+	add("goroot", ValidateGoRoot(c.GoRoot))
+	add("minios", ValidateMiniOS(c.MiniOS))
+	add("libraries", validateLibraries(c.Libraries))
+	return problems
+}
+
+// ValidateGoRoot checks that goroot holds a built Go toolchain that
+// supports GOOS=unigornel.
+func ValidateGoRoot(goroot string) error {
+	if goroot == "" {
+		return fmt.Errorf("not set")
+	}
+	if err := requireDir(goroot); err != nil {
+		return err
+	}
+
+	runtime, _ := filepath.Glob(filepath.Join(goroot, "src", "runtime", "*unigornel*.go"))
+	if len(runtime) == 0 {
+		return fmt.Errorf("%v does not support GOOS=unigornel", goroot)
+	}
+
+	if _, err := os.Stat(filepath.Join(goroot, "bin", "go")); err != nil {
+		return fmt.Errorf("%v is not built (run `unigornel toolchain build`)", goroot)
+	}
+	return nil
+}
+
+// ValidateMiniOS checks that minios is a Mini-OS tree.
+func ValidateMiniOS(minios string) error {
+	if minios == "" {
+		return fmt.Errorf("not set")
+	}
+	if err := requireDir(minios); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(filepath.Join(minios, "Makefile")); err != nil {
+		return fmt.Errorf("%v has no Makefile", minios)
+	}
+	return nil
+}
+
+func validateLibraries(file string) error {
+	if file == "" {
+		return nil
+	}
+	if _, err := os.Stat(file); err != nil {
+		return fmt.Errorf("%v does not exist", file)
+	}
+	return nil
+}
+
+func requireDir(dir string) error {
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%v does not exist", dir)
+	} else if err != nil {
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("%v is not a directory", dir)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTree creates the files in dir. Names that end in a slash are
+// directories.
+func testTree(t *testing.T, dir string, files ...string) {
+	for _, f := range files {
+		p := filepath.Join(dir, f)
+		if f[len(f)-1] == '/' {
+			require.Nil(t, os.MkdirAll(p, 0755))
+			continue
+		}
+		require.Nil(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.Nil(t, ioutil.WriteFile(p, nil, 0644))
+	}
+}
+
+func TestValidateGoRoot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unigornel-validate")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	testTree(t, dir,
+		"go/src/runtime/os_unigornel.go", "go/bin/go",
+		"unbuilt/src/runtime/os_unigornel.go",
+		"upstream/src/runtime/os_linux.go", "upstream/bin/go",
+		"file",
+	)
+
+	cases := []struct {
+		GoRoot      string
+		ErrorRegexp *regexp.Regexp
+	}{
+		{filepath.Join(dir, "go"), nil},
+		{"", regexp.MustCompile("^not set$")},
+		{filepath.Join(dir, "missing"), regexp.MustCompile("does not exist")},
+		{filepath.Join(dir, "file"), regexp.MustCompile("is not a directory")},
+		{filepath.Join(dir, "upstream"), regexp.MustCompile("does not support GOOS=unigornel")},
+		{filepath.Join(dir, "unbuilt"), regexp.MustCompile("is not built")},
+	}
+
+	for i, c := range cases {
+		err := ValidateGoRoot(c.GoRoot)
+		if c.ErrorRegexp == nil {
+			assert.Nil(t, err, "for test %d", i)
+		} else if assert.NotNil(t, err, "for test %d", i) {
+			assert.True(t, c.ErrorRegexp.MatchString(err.Error()), "for test %d: %v", i, err)
+		}
+	}
+}
+
+func TestValidateMiniOS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unigornel-validate")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	testTree(t, dir, "minios/Makefile", "empty/", "file")
+
+	cases := []struct {
+		MiniOS      string
+		ErrorRegexp *regexp.Regexp
+	}{
+		{filepath.Join(dir, "minios"), nil},
+		{"", regexp.MustCompile("^not set$")},
+		{filepath.Join(dir, "missing"), regexp.MustCompile("does not exist")},
+		{filepath.Join(dir, "file"), regexp.MustCompile("is not a directory")},
+		{filepath.Join(dir, "empty"), regexp.MustCompile("has no Makefile")},
+	}
+
+	for i, c := range cases {
+		err := ValidateMiniOS(c.MiniOS)
+		if c.ErrorRegexp == nil {
+			assert.Nil(t, err, "for test %d", i)
+		} else if assert.NotNil(t, err, "for test %d", i) {
+			assert.True(t, c.ErrorRegexp.MatchString(err.Error()), "for test %d: %v", i, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unigornel-validate")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	testTree(t, dir,
+		"go/src/runtime/os_unigornel.go", "go/bin/go",
+		"minios/Makefile",
+		"libraries.yaml",
+		"mirror/",
+	)
+	goroot := filepath.Join(dir, "go")
+	minios := filepath.Join(dir, "minios")
+	missing := filepath.Join(dir, "missing")
+
+	cases := []struct {
+		Config   Config
+		Problems []string
+	}{
+		{
+			Config: Config{GoRoot: goroot, MiniOS: minios, Libraries: filepath.Join(dir, "libraries.yaml"), Mirror: filepath.Join(dir, "mirror")},
+		},
+		{
+			Config:   Config{},
+			Problems: []string{"goroot: not set", "minios: not set"},
+		},
+		{
+			Config: Config{GoRoot: goroot, MiniOS: minios, Libraries: missing, Mirror: missing, Templates: missing},
+			Problems: []string{
+				"libraries: " + missing + " does not exist",
+				"mirror: " + missing + " does not exist",
+				"templates: " + missing + " does not exist",
+			},
+		},
+		{
+			// Named toolchains inherit the top-level values.
+			Config: Config{
+				MiniOS:     minios,
+				Default:    "next",
+				Toolchains: map[string]Toolchain{"next": {GoRoot: goroot}},
+			},
+			Problems: []string{"goroot: not set"},
+		},
+		{
+			Config: Config{
+				Default: "stable",
+				Toolchains: map[string]Toolchain{
+					"next": {GoRoot: goroot, MiniOS: missing},
+				},
+			},
+			Problems: []string{
+				"default: unknown toolchain 'stable'",
+				"toolchains.next.minios: " + missing + " does not exist",
+			},
+		},
+	}
+
+	for i, c := range cases {
+		err := c.Config.Validate()
+		if c.Problems == nil {
+			assert.Nil(t, err, "for test %d", i)
+		} else if assert.IsType(t, ValidationError{}, err, "for test %d", i) {
+			assert.Equal(t, ValidationError(c.Problems), err, "for test %d", i)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package env
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/unigornel/unigornel/unigornel/config"
+	"github.com/urfave/cli"
+)
+
+const (
+	showOriginFlagName = "show-origin"
+	systemFlagName     = "system"
+	projectFlagName    = "project"
+)
+
+func showOriginFlag() cli.Flag {
+	return cli.BoolFlag{
+		Name:  showOriginFlagName,
+		Usage: "show where each value comes from",
+	}
+}
+
+func systemFlag() cli.Flag {
+	return cli.BoolFlag{
+		Name:  systemFlagName,
+		Usage: "write to the system-wide configuration file (" + config.SystemConfigPath + ")",
+	}
+}
+
+func projectFlag() cli.Flag {
+	return cli.BoolFlag{
+		Name:  projectFlagName,
+		Usage: "write to the project configuration file (" + config.ProjectConfigName + ")",
+	}
+}
+
+// Config is the `config` command.
+func Config() cli.Command {
+	return cli.Command{
+		Name:  "config",
+		Usage: "show and change the configuration",
+		Description: `The configuration is merged from the following layers. Later layers
+   override earlier ones:
+
+     1. the system-wide file (` + config.SystemConfigPath + `)
+     2. the user file (~/` + config.ProjectConfigName + `)
+     3. the project file (` + config.ProjectConfigName + ` in the working directory or a parent)
+     4. the file given with --config
+     5. the environment (UNIGORNEL_GOROOT, UNIGORNEL_MINIOS, UNIGORNEL_LIBRARIES,
+        UNIGORNEL_LIBS_MIRROR and UNIGORNEL_TOOLCHAIN)
+
+   Relative paths in a file are relative to the directory of that file.`,
+		Flags: []cli.Flag{
+			ConfigFlag(),
+		},
+		Subcommands: []cli.Command{
+			{
+				Name:      "get",
+				Usage:     "show the value of a key",
+				ArgsUsage: "KEY",
+				Flags: []cli.Flag{
+					showOriginFlag(),
+				},
+				Action: func(ctx *cli.Context) error {
+					if ctx.NArg() != 1 {
+						cli.ShowSubcommandHelp(ctx)
+						return cli.NewExitError("error: subcommand expects one argument", 1)
+					}
+					o := configOptions{
+						ConfigFile: ConfigFile(ctx),
+						ShowOrigin: ctx.Bool(showOriginFlagName),
+					}
+					if err := o.get(ctx.Args()[0]); err != nil {
+						return cli.NewExitError("error: "+err.Error(), 1)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "set",
+				Usage:     "change the value of a key (an empty value unsets the key)",
+				ArgsUsage: "KEY VALUE",
+				Flags: []cli.Flag{
+					systemFlag(),
+					projectFlag(),
+				},
+				Action: func(ctx *cli.Context) error {
+					if ctx.NArg() != 2 {
+						cli.ShowSubcommandHelp(ctx)
+						return cli.NewExitError("error: subcommand expects two arguments", 1)
+					}
+					o := configOptions{
+						ConfigFile: ConfigFile(ctx),
+						System:     ctx.Bool(systemFlagName),
+						Project:    ctx.Bool(projectFlagName),
+					}
+					if err := o.set(ctx.Args()[0], ctx.Args()[1]); err != nil {
+						return cli.NewExitError("error: "+err.Error(), 1)
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "validate",
+				Usage: "check that the configured paths exist and hold a usable toolchain",
+				Action: func(ctx *cli.Context) error {
+					o := configOptions{
+						ConfigFile: ConfigFile(ctx),
+					}
+					if err := o.validate(); err != nil {
+						return cli.NewExitError("error: "+err.Error(), 1)
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "migrate",
+				Usage: "rewrite a configuration file in the current schema version",
+				Flags: []cli.Flag{
+					systemFlag(),
+					projectFlag(),
+				},
+				Action: func(ctx *cli.Context) error {
+					o := configOptions{
+						ConfigFile: ConfigFile(ctx),
+						System:     ctx.Bool(systemFlagName),
+						Project:    ctx.Bool(projectFlagName),
+					}
+					if err := o.migrate(); err != nil {
+						return cli.NewExitError("error: "+err.Error(), 1)
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "list",
+				Usage: "show all values",
+				Flags: []cli.Flag{
+					showOriginFlag(),
+				},
+				Action: func(ctx *cli.Context) error {
+					o := configOptions{
+						ConfigFile: ConfigFile(ctx),
+						ShowOrigin: ctx.Bool(showOriginFlagName),
+					}
+					if err := o.list(); err != nil {
+						return cli.NewExitError("error: "+err.Error(), 1)
+					}
+					return nil
+				},
+			},
+		},
+	}
+}
+
+type configOptions struct {
+	ConfigFile string
+	ShowOrigin bool
+	System     bool
+	Project    bool
+}
+
+func (o *configOptions) print(layers config.Layers, kv config.KeyValue) {
+	if o.ShowOrigin {
+		fmt.Printf("%v\t%v=%v\n", layers.Origin(kv.Key), kv.Key, kv.Value)
+	} else {
+		fmt.Printf("%v=%v\n", kv.Key, kv.Value)
+	}
+}
+
+func (o *configOptions) get(key string) error {
+	layers, err := config.LoadLayers(o.ConfigFile)
+	if err != nil {
+		return err
+	}
+
+	value, ok := layers.Merged().Get(key)
+	if !ok {
+		return fmt.Errorf("key '%v' is not set", key)
+	}
+
+	if o.ShowOrigin {
+		o.print(layers, config.KeyValue{Key: key, Value: value})
+	} else {
+		fmt.Println(value)
+	}
+	return nil
+}
+
+func (o *configOptions) list() error {
+	layers, err := config.LoadLayers(o.ConfigFile)
+	if err != nil {
+		return err
+	}
+
+	for _, kv := range layers.Merged().Values() {
+		o.print(layers, kv)
+	}
+	return nil
+}
+
+// target returns the file that set and migrate write to.
+func (o *configOptions) target() (string, error) {
+	switch {
+	case o.System && o.Project:
+		return "", fmt.Errorf("--system and --project are mutually exclusive")
+	case o.System:
+		return config.SystemConfigPath, nil
+	case o.Project:
+		wd, err := os.Getwd()
+		if err != nil {
+			return "", err
+		}
+		if p := config.FindProjectConfig(wd); p != "" {
+			return p, nil
+		}
+		return config.ProjectConfigName, nil
+	default:
+		return ConfigPath(o.ConfigFile)
+	}
+}
+
+func (o *configOptions) set(key, value string) error {
+	file, err := o.target()
+	if err != nil {
+		return err
+	}
+
+	f, err := config.OpenFile(file)
+	if err != nil {
+		return err
+	}
+
+	if err := f.Set(key, value); err != nil {
+		return err
+	}
+	return f.Save()
+}
+
+func (o *configOptions) validate() error {
+	c, err := GetConfig(o.ConfigFile)
+	if err != nil {
+		return err
+	}
+
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	fmt.Println("configuration is valid")
+	return nil
+}
+
+func (o *configOptions) migrate() error {
+	file, err := o.target()
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(file); err != nil {
+		return err
+	}
+	f, err := config.OpenFile(file)
+	if err != nil {
+		return err
+	}
+
+	version, err := f.Version()
+	if err != nil {
+		return err
+	}
+	if version >= config.CurrentVersion {
+		fmt.Printf("%v is at version %d\n", file, version)
+		return nil
+	}
+
+	fmt.Printf("migrating %v from version %d to %d\n", file, version, config.CurrentVersion)
+	return f.Save()
+}
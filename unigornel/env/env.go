@@ -1,42 +1,73 @@
 package env
 
 import (
-	"fmt"
-	"io/ioutil"
 	"os"
-	"os/user"
-	"path"
+	"path/filepath"
+	"strings"
 
 	"github.com/unigornel/unigornel/unigornel/config"
 	"github.com/urfave/cli"
 )
 
 const (
+	GoRootEnv     = "UNIGORNEL_GOROOT"
 	MiniOSRootEnv = "UNIGORNEL_MINIOS"
+	MirrorEnv     = "UNIGORNEL_LIBS_MIRROR"
 )
 
 const (
-	configFullFlagName = "config"
+	ConfigFlagName    = "config"
+	ToolchainFlagName = "toolchain"
+	goFlagName        = "go"
+	shellFlagName     = "shell"
+	unsetFlagName     = "unset"
 )
 
-func configFlag() cli.Flag {
+// ConfigFlag is the flag to select the configuration file.
+func ConfigFlag() cli.Flag {
 	return cli.StringFlag{
-		Name:   configFullFlagName + ", c",
+		Name:   ConfigFlagName + ", c",
 		EnvVar: "UNIGORNEL_CONFIG",
 		Usage:  "path to the configuration file (yaml)",
 	}
 }
 
+// ToolchainFlag is the flag to select a named toolchain from the
+// configuration file.
+func ToolchainFlag() cli.Flag {
+	return cli.StringFlag{
+		Name:  ToolchainFlagName,
+		Usage: "name of the toolchain in the configuration file",
+	}
+}
+
 func Env() cli.Command {
 	return cli.Command{
 		Name:  "env",
 		Usage: "setup your shell",
 		Flags: []cli.Flag{
-			configFlag(),
+			ConfigFlag(),
+			ToolchainFlag(),
+			cli.BoolFlag{
+				Name:  goFlagName,
+				Usage: "also print the cgo environment used to compile unikernels",
+			},
+			cli.StringFlag{
+				Name:  shellFlagName,
+				Usage: "output format: bash, zsh, fish or json (default: from $SHELL)",
+			},
+			cli.BoolFlag{
+				Name:  unsetFlagName,
+				Usage: "print the commands to restore the environment from before `unigornel env`",
+			},
 		},
 		Action: func(ctx *cli.Context) error {
 			options := EnvOptions{
-				ConfigFile: ctx.String(configFullFlagName),
+				ConfigFile: ConfigFile(ctx),
+				Toolchain:  ToolchainName(ctx),
+				Go:         ctx.Bool(goFlagName),
+				Shell:      ctx.String(shellFlagName),
+				Unset:      ctx.Bool(unsetFlagName),
 			}
 
 			if err := env(options); err != nil {
@@ -47,79 +78,273 @@ func Env() cli.Command {
 	}
 }
 
-func RequireMiniOSRoot() (s string, err error) {
-	s = os.Getenv(MiniOSRootEnv)
-	if s == "" {
-		err = cli.NewExitError("error: environment variable UNIGORNEL_MINIOS not set", 1)
-	}
-	return
+// ConfigFile returns the configuration file given to the command, to one of
+// its parent commands, or globally.
+func ConfigFile(ctx *cli.Context) string {
+	return lookupString(ctx, ConfigFlagName)
 }
 
-func GetConfig(configPath string) (config.Config, error) {
-	empty := config.Config{}
+// ToolchainName returns the toolchain given to the command, to one of its
+// parent commands, or globally.
+func ToolchainName(ctx *cli.Context) string {
+	return lookupString(ctx, ToolchainFlagName)
+}
 
-	s := configPath
-	if s == "" {
-		u, err := user.Current()
-		if err != nil {
-			return empty, err
-		}
-		s = path.Join(u.HomeDir, ".unigornel.yaml")
+// globalFlags holds the values of the global flags. A command that defines
+// a flag with the same name hides the global flag from its subcommands.
+var globalFlags = make(map[string]string)
+
+// SaveGlobalFlags records the global configuration and toolchain flags. It
+// is the Before hook of the application.
+func SaveGlobalFlags(ctx *cli.Context) error {
+	globalFlags[ConfigFlagName] = ctx.String(ConfigFlagName)
+	globalFlags[ToolchainFlagName] = ctx.String(ToolchainFlagName)
+	return nil
+}
+
+func lookupString(ctx *cli.Context, name string) string {
+	if s := ctx.String(name); s != "" {
+		return s
+	}
+	if s := ctx.GlobalString(name); s != "" {
+		return s
 	}
+	return globalFlags[name]
+}
 
-	data, err := ioutil.ReadFile(s)
+// RequireToolchain returns the configuration of the selected toolchain. The
+// environment overrides the configuration files, so a shell that was set up
+// with `unigornel env` keeps working.
+func RequireToolchain(ctx *cli.Context) (config.Config, error) {
+	c, err := RequireGoRoot(ctx)
 	if err != nil {
-		return empty, err
+		return c, err
 	}
+	if err := config.ValidateGoRoot(c.GoRoot); err != nil {
+		return c, cli.NewExitError("error: invalid goroot: "+err.Error(), 1)
+	}
+	return c, requireMiniOS(c)
+}
 
-	c, err := config.ParseConfig(data)
+// RequireGoRoot returns the configuration of the selected toolchain, like
+// RequireToolchain, but only demands a GOROOT. It is enough to run the go
+// tool and other commands in the environment of the toolchain.
+func RequireGoRoot(ctx *cli.Context) (config.Config, error) {
+	c, err := GetToolchain(ConfigFile(ctx), ToolchainName(ctx))
 	if err != nil {
-		return empty, err
+		return c, cli.NewExitError("error: "+err.Error(), 1)
+	}
+
+	if c.GoRoot == "" {
+		return c, cli.NewExitError("error: no goroot configured (set goroot in the configuration or "+GoRootEnv+")", 1)
 	}
 	return c, nil
 }
 
+// RequireMiniOSRoot returns the Mini-OS tree of the selected toolchain. It
+// does not need the Go fork.
+func RequireMiniOSRoot(ctx *cli.Context) (string, error) {
+	c, err := GetToolchain(ConfigFile(ctx), ToolchainName(ctx))
+	if err != nil {
+		return "", cli.NewExitError("error: "+err.Error(), 1)
+	}
+	return c.MiniOS, requireMiniOS(c)
+}
+
+func requireMiniOS(c config.Config) error {
+	if c.MiniOS == "" {
+		return cli.NewExitError("error: no mini-os configured (set minios in the configuration or UNIGORNEL_MINIOS)", 1)
+	}
+	if err := config.ValidateMiniOS(c.MiniOS); err != nil {
+		return cli.NewExitError("error: invalid mini-os: "+err.Error(), 1)
+	}
+	return nil
+}
+
+// ConfigPath returns configPath, or the configuration file of the user if
+// configPath is empty.
+func ConfigPath(configPath string) (string, error) {
+	if configPath != "" {
+		return configPath, nil
+	}
+	return config.UserConfigPath()
+}
+
+// GetConfig merges all configuration layers. The configPath is the
+// explicit configuration file and may be empty.
+func GetConfig(configPath string) (config.Config, error) {
+	layers, err := config.LoadLayers(configPath)
+	if err != nil {
+		return config.Config{}, err
+	}
+	return layers.Merged(), nil
+}
+
+// GetToolchain merges all configuration layers and applies the named
+// toolchain.
+func GetToolchain(configPath, name string) (config.Config, error) {
+	layers, err := config.LoadLayers(configPath)
+	if err != nil {
+		return config.Config{}, err
+	}
+	return layers.Toolchain(name)
+}
+
 type EnvOptions struct {
 	ConfigFile string
+	Toolchain  string
+	Go         bool
+	Shell      string
+	Unset      bool
 }
 
 func env(options EnvOptions) error {
-	config, err := GetConfig(options.ConfigFile)
+	var sh shell
+	if options.Shell != ShellJSON {
+		var err error
+		if sh, err = newShell(options.Shell); err != nil {
+			return err
+		}
+	}
+
+	if options.Unset {
+		names := envVarNames(options.Go)
+		if sh == nil {
+			return writeJSONUnset(names)
+		}
+		writeUnset(sh, names)
+		return nil
+	}
+
+	config, err := GetToolchain(options.ConfigFile, options.Toolchain)
 	if err != nil {
 		return err
 	}
-	for _, v := range configToEnvVars(config) {
-		fmt.Println(export(v))
+	if err := config.ValidateSelected(); err != nil {
+		return err
+	}
+
+	vars := configToEnvVars(config)
+	if options.Go {
+		vars = append(vars, unikernelVars(config)...)
+	}
+	if sh == nil {
+		return writeJSON(os.Stdout, vars)
 	}
+	writeSet(os.Stdout, sh, vars)
 	return nil
 }
 
 type envVar struct {
 	Name  string
 	Value string
+
+	// Prepend adds the value in front of the current value of a list
+	// variable such as PATH.
+	Prepend bool
+}
+
+// Environ returns the environment of the current process with the variables
+// of the toolchain applied. Empty values are left out.
+func Environ(c config.Config) []string {
+	return environ(configToEnvVars(c))
+}
+
+// GoEnviron returns Environ(c) with the cgo environment that is used to
+// compile Go code for a unikernel.
+func GoEnviron(c config.Config) []string {
+	return environ(append(configToEnvVars(c), unikernelVars(c)...))
+}
+
+// GoBinary returns the go binary of the toolchain, or the go binary in the
+// PATH if no GOROOT is configured.
+func GoBinary(c config.Config) string {
+	if c.GoRoot == "" {
+		return "go"
+	}
+	return filepath.Join(c.GoRoot, "bin", "go")
 }
 
-func export(v envVar) string {
-	return "export " + v.Name + "=\"" + v.Value + "\""
+func environ(vars []envVar) []string {
+	environ := os.Environ()
+	for _, v := range vars {
+		if v.Value == "" {
+			continue
+		}
+
+		value := v.Value
+		if current := os.Getenv(v.Name); v.Prepend && current != "" {
+			value += string(os.PathListSeparator) + current
+		}
+		environ = append(environ, v.Name+"="+value)
+	}
+	return environ
 }
 
 func configToEnvVars(c config.Config) []envVar {
-	return []envVar{
+	vars := []envVar{
 		{
 			Name:  "GOROOT",
 			Value: c.GoRoot,
 		},
 		{
-			Name:  MiniOSRootEnv,
-			Value: c.MiniOS,
-		},
-		{
-			Name:  "PATH",
-			Value: c.GoRoot + "/bin:$PATH",
+			Name:  GoRootEnv,
+			Value: c.GoRoot,
 		},
 		{
-			Name:  "UNIGORNEL_LIBRARIES",
-			Value: c.Libraries,
+			Name:  MiniOSRootEnv,
+			Value: c.MiniOS,
 		},
 	}
+	if c.GoRoot != "" {
+		vars = append(vars, envVar{
+			Name:    "PATH",
+			Value:   c.GoRoot + "/bin",
+			Prepend: true,
+		})
+	}
+	vars = append(vars, envVar{
+		Name:  "UNIGORNEL_LIBRARIES",
+		Value: c.Libraries,
+	})
+	if c.Mirror != "" {
+		vars = append(vars, envVar{
+			Name:  MirrorEnv,
+			Value: c.Mirror,
+		})
+	}
+	return vars
+}
+
+// envVarNames returns the names of all variables that `unigornel env` may
+// set.
+func envVarNames(goVars bool) []string {
+	all := config.Config{GoRoot: "-", Mirror: "-"}
+	vars := configToEnvVars(all)
+	if goVars {
+		vars = append(vars, unikernelVars(all)...)
+	}
+
+	var names []string
+	for _, v := range vars {
+		names = append(names, v.Name)
+	}
+	return names
+}
+
+// unikernelVars are the variables to compile Go code for a unikernel with
+// cgo against the Mini-OS headers.
+func unikernelVars(c config.Config) []envVar {
+	include := strings.Join([]string{
+		"-isystem", filepath.Join(c.MiniOS, "include"),
+		"-isystem", filepath.Join(c.MiniOS, "include", "x86"),
+		"-isystem", filepath.Join(c.MiniOS, "include", "x86", "x86_64"),
+	}, " ")
+
+	return []envVar{
+		{Name: "CGO_ENABLED", Value: "1"},
+		{Name: "CGO_CFLAGS", Value: include},
+		{Name: "GOOS", Value: "unigornel"},
+		{Name: "GOARCH", Value: "amd64"},
+	}
 }
@@ -0,0 +1,81 @@
+package env
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/unigornel/unigornel/unigornel/config"
+)
+
+// TestEnvRoundTrip checks that the environment layer of the configuration
+// reads back the toolchain that `unigornel env` exports.
+func TestEnvRoundTrip(t *testing.T) {
+	tests := []config.Config{
+		{
+			GoRoot:    "/opt/unigornel/go",
+			MiniOS:    "/opt/unigornel/minios",
+			Libraries: "/opt/unigornel/libraries.yaml",
+		},
+		{
+			GoRoot:    "/opt/unigornel/go",
+			MiniOS:    "/opt/unigornel/minios",
+			Libraries: "/opt/unigornel/libraries.yaml",
+			Mirror:    "/srv/mirror",
+		},
+	}
+
+	for i, c := range tests {
+		vars := configToEnvVars(c)
+		saved := make(map[string]string)
+		for _, v := range vars {
+			saved[v.Name] = os.Getenv(v.Name)
+			os.Setenv(v.Name, v.Value)
+		}
+
+		layers, err := config.LoadLayers("")
+		if assert.Nil(t, err, "for test %d", i) && assert.NotEmpty(t, layers, "for test %d", i) {
+			l := layers[len(layers)-1]
+			assert.Equal(t, "env", l.Origin, "for test %d", i)
+			assert.Equal(t, c, l.Config, "for test %d", i)
+		}
+
+		for name, value := range saved {
+			os.Setenv(name, value)
+		}
+	}
+}
+
+func TestLookPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unigornel-lookpath")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	bin := filepath.Join(dir, "bin")
+	assert.Nil(t, os.Mkdir(bin, 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(bin, "tool"), []byte("#!/bin/sh\n"), 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(bin, "data"), []byte{}, 0644))
+
+	tests := []struct {
+		Name     string
+		Environ  []string
+		Expected string
+		Error    bool
+	}{
+		{"tool", []string{"PATH=/nonexistent", "PATH=" + bin}, filepath.Join(bin, "tool"), false},
+		{"tool", []string{"PATH=" + bin + ":/nonexistent"}, filepath.Join(bin, "tool"), false},
+		{"tool", []string{"PATH=/nonexistent"}, "", true},
+		{"data", []string{"PATH=" + bin}, "", true},
+		{"./tool", nil, "./tool", false},
+	}
+
+	for i, test := range tests {
+		p, err := lookPath(test.Name, test.Environ)
+		assert.Equal(t, test.Expected, p, "for test %d", i)
+		assert.Equal(t, test.Error, err != nil, "for test %d", i)
+	}
+}
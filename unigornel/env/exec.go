@@ -0,0 +1,126 @@
+package env
+
+import (
+	"fmt"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/unigornel/unigornel/unigornel/exec"
+	"github.com/urfave/cli"
+)
+
+// Exec is the `exec` command.
+func Exec() cli.Command {
+	return cli.Command{
+		Name:            "exec",
+		Usage:           "run a command in the unigornel environment",
+		ArgsUsage:       "[--] COMMAND [ARGS...]",
+		SkipFlagParsing: true,
+		Description: `Runs the command with GOROOT, PATH and the other variables of
+   'unigornel env' set from the configuration. The toolchain is selected
+   with the global --toolchain flag.`,
+		Action: func(ctx *cli.Context) error {
+			args := []string(ctx.Args())
+			if len(args) > 0 && args[0] == "--" {
+				args = args[1:]
+			}
+			if len(args) == 0 {
+				cli.ShowSubcommandHelp(ctx)
+				return cli.NewExitError("error: missing command", 1)
+			}
+
+			c, err := RequireGoRoot(ctx)
+			if err != nil {
+				return err
+			}
+
+			// Look up the command in the PATH of the toolchain.
+			environ := Environ(c)
+			name, err := lookPath(args[0], environ)
+			if err != nil {
+				return cli.NewExitError("error: "+err.Error(), 1)
+			}
+			return run(environ, name, args[1:]...)
+		},
+	}
+}
+
+// Go is the `go` command.
+func Go() cli.Command {
+	return cli.Command{
+		Name:            "go",
+		Usage:           "run the go tool with the unikernel cgo environment",
+		ArgsUsage:       "[--] GOCOMMAND [ARGS...]",
+		SkipFlagParsing: true,
+		Description: `Runs the go tool of the toolchain with the environment that is used to
+   compile unikernels (CGO_ENABLED, CGO_CFLAGS with the Mini-OS headers,
+   GOOS=unigornel and GOARCH=amd64). Use it for go vet, go list, go doc
+   and the like. See 'unigornel env --go' to setup an editor.`,
+		Action: func(ctx *cli.Context) error {
+			args := []string(ctx.Args())
+			if len(args) > 0 && args[0] == "--" {
+				args = args[1:]
+			}
+
+			c, err := RequireGoRoot(ctx)
+			if err != nil {
+				return err
+			}
+			return run(GoEnviron(c), GoBinary(c), args...)
+		},
+	}
+}
+
+// lookPath finds the command in the PATH of the environment, rather than
+// in the PATH of the current process.
+func lookPath(name string, environ []string) (string, error) {
+	if strings.Contains(name, "/") {
+		return name, nil
+	}
+
+	var path string
+	for _, e := range environ {
+		if strings.HasPrefix(e, "PATH=") {
+			path = strings.TrimPrefix(e, "PATH=")
+		}
+	}
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			dir = "."
+		}
+		p := filepath.Join(dir, name)
+		if info, err := os.Stat(p); err == nil && info.Mode().IsRegular() && info.Mode()&0111 != 0 {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("%v: executable file not found in PATH", name)
+}
+
+// run runs the command in the terminal and exits with its exit code.
+func run(environ []string, name string, args ...string) error {
+	cmd := exec.InTerminal(name, args...)
+	cmd.Env = environ
+	if err := cmd.Run(); err != nil {
+		return cli.NewExitError(exitMessage(err), exitCode(err))
+	}
+	return nil
+}
+
+func exitMessage(err error) string {
+	if _, ok := err.(*osexec.ExitError); ok {
+		return ""
+	}
+	return "error: " + err.Error()
+}
+
+func exitCode(err error) int {
+	if e, ok := err.(*osexec.ExitError); ok {
+		if status, ok := e.Sys().(syscall.WaitStatus); ok && status.Exited() {
+			return status.ExitStatus()
+		}
+	}
+	return 1
+}
@@ -0,0 +1,213 @@
+package env
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The shells supported by `unigornel env --shell`.
+const (
+	ShellBash = "bash"
+	ShellZsh  = "zsh"
+	ShellFish = "fish"
+	ShellJSON = "json"
+)
+
+// savedPrefix is prepended to the names of variables that `unigornel env`
+// overrides, to keep their previous value for `unigornel env --unset`.
+const savedPrefix = "UNIGORNEL_SAVED_"
+
+// savedVars are the variables whose previous value is restored on unset.
+var savedVars = []string{"GOROOT", "PATH"}
+
+// shell formats the commands to change the environment of a shell.
+type shell interface {
+	set(name, value string) string
+	unset(name string) string
+}
+
+// newShell returns the shell with the given name. An empty name selects the
+// shell from $SHELL, falling back to bash.
+func newShell(name string) (shell, error) {
+	if name == "" {
+		name = filepath.Base(os.Getenv("SHELL"))
+		if name != ShellFish && name != ShellZsh {
+			name = ShellBash
+		}
+	}
+
+	switch name {
+	case ShellBash, ShellZsh:
+		return posixShell{}, nil
+	case ShellFish:
+		return fishShell{}, nil
+	default:
+		return nil, fmt.Errorf("unknown shell '%v' (expected %v, %v or %v)", name, ShellBash, ShellZsh, ShellFish)
+	}
+}
+
+type posixShell struct{}
+
+func (posixShell) set(name, value string) string {
+	return "export " + name + "=" + posixQuote(value)
+}
+
+func (posixShell) unset(name string) string {
+	return "unset " + name
+}
+
+// posixQuote quotes s in single quotes, which bash and zsh do not expand.
+func posixQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+type fishShell struct{}
+
+func (fishShell) set(name, value string) string {
+	if name == "PATH" {
+		// PATH is a list in fish.
+		var quoted []string
+		for _, p := range filepath.SplitList(value) {
+			quoted = append(quoted, fishQuote(p))
+		}
+		return "set -gx PATH " + strings.Join(quoted, " ") + ";"
+	}
+	return "set -gx " + name + " " + fishQuote(value) + ";"
+}
+
+func (fishShell) unset(name string) string {
+	return "set -e " + name + ";"
+}
+
+// fishQuote quotes s in single quotes. Only backslashes and single quotes
+// are special inside them.
+func fishQuote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, "'", `\'`, -1)
+	return "'" + s + "'"
+}
+
+// resolve returns the final values of the variables. Values that are
+// prepended to a list are joined with the value of the variable before
+// `unigornel env` was first applied, so the output can be applied twice.
+func resolve(vars []envVar) []envVar {
+	resolved := make([]envVar, len(vars))
+	for i, v := range vars {
+		if v.Prepend {
+			if current := previousValue(v.Name); current != "" {
+				v.Value += string(os.PathListSeparator) + current
+			}
+			v.Prepend = false
+		}
+		resolved[i] = v
+	}
+	return resolved
+}
+
+// previousValue returns the value of the variable before `unigornel env` was
+// applied.
+func previousValue(name string) string {
+	if v, ok := os.LookupEnv(savedPrefix + name); ok {
+		return v
+	}
+	return os.Getenv(name)
+}
+
+func isSaved(name string) bool {
+	for _, s := range savedVars {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// restoredValue returns the value of the variable after `unigornel env
+// --unset`, and whether it is set at all.
+func restoredValue(name string) (string, bool) {
+	if !isSaved(name) {
+		return "", false
+	}
+	saved, ok := os.LookupEnv(savedPrefix + name)
+	if !ok {
+		// The environment was not set up by `unigornel env`.
+		return os.LookupEnv(name)
+	}
+	return saved, saved != ""
+}
+
+// writeSet writes the commands to apply the variables. Variables with an
+// empty value are unset, so a value of another toolchain does not linger.
+func writeSet(w io.Writer, sh shell, vars []envVar) {
+	for _, name := range savedVars {
+		if _, ok := os.LookupEnv(savedPrefix + name); !ok {
+			fmt.Fprintln(w, sh.set(savedPrefix+name, os.Getenv(name)))
+		}
+	}
+	for _, v := range resolve(vars) {
+		if v.Value == "" {
+			fmt.Fprintln(w, sh.unset(v.Name))
+		} else {
+			fmt.Fprintln(w, sh.set(v.Name, v.Value))
+		}
+	}
+}
+
+// writeUnset prints the commands to undo the variables. Saved variables are
+// restored to their previous value.
+func writeUnset(sh shell, names []string) {
+	for _, name := range names {
+		if value, ok := restoredValue(name); ok {
+			fmt.Println(sh.set(name, value))
+		} else {
+			fmt.Println(sh.unset(name))
+		}
+	}
+	for _, name := range savedVars {
+		if _, ok := os.LookupEnv(savedPrefix + name); ok {
+			fmt.Println(sh.unset(savedPrefix + name))
+		}
+	}
+}
+
+// writeJSON writes the variables as a JSON object. Variables with an empty
+// value are null, like unset variables in writeJSONUnset.
+func writeJSON(w io.Writer, vars []envVar) error {
+	values := make(map[string]*string)
+	for _, v := range resolve(vars) {
+		if v.Value == "" {
+			values[v.Name] = nil
+			continue
+		}
+		value := v.Value
+		values[v.Name] = &value
+	}
+	return printJSON(w, values)
+}
+
+// writeJSONUnset prints the values of the variables after unset as a JSON
+// object. Variables that are not set are null.
+func writeJSONUnset(names []string) error {
+	values := make(map[string]*string)
+	for _, name := range names {
+		if value, ok := restoredValue(name); ok {
+			values[name] = &value
+		} else {
+			values[name] = nil
+		}
+	}
+	return printJSON(os.Stdout, values)
+}
+
+func printJSON(w io.Writer, values map[string]*string) error {
+	data, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, string(data))
+	return nil
+}
@@ -0,0 +1,58 @@
+package env
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShellQuoting(t *testing.T) {
+	cases := []struct {
+		Shell    shell
+		Name     string
+		Value    string
+		Expected string
+	}{
+		{posixShell{}, "GOROOT", "/opt/go", `export GOROOT='/opt/go'`},
+		{posixShell{}, "GOROOT", "/it's $HOME", `export GOROOT='/it'\''s $HOME'`},
+		{fishShell{}, "GOROOT", `/it's \ $HOME`, `set -gx GOROOT '/it\'s \\ $HOME';`},
+		{fishShell{}, "PATH", "/opt/go/bin:/usr/bin", `set -gx PATH '/opt/go/bin' '/usr/bin';`},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.Expected, c.Shell.set(c.Name, c.Value))
+	}
+}
+
+func TestWriteSetEmptyValues(t *testing.T) {
+	for _, name := range savedVars {
+		defer os.Unsetenv(savedPrefix + name)
+		os.Setenv(savedPrefix+name, "")
+	}
+
+	vars := []envVar{
+		{Name: "GOROOT", Value: "/opt/go"},
+		{Name: "UNIGORNEL_LIBRARIES", Value: ""},
+	}
+
+	cases := []struct {
+		Shell    shell
+		Expected string
+	}{
+		{posixShell{}, "export GOROOT='/opt/go'\nunset UNIGORNEL_LIBRARIES\n"},
+		{fishShell{}, "set -gx GOROOT '/opt/go';\nset -e UNIGORNEL_LIBRARIES;\n"},
+		{nil, "{\n  \"GOROOT\": \"/opt/go\",\n  \"UNIGORNEL_LIBRARIES\": null\n}\n"},
+	}
+
+	for i, c := range cases {
+		var b bytes.Buffer
+		if c.Shell == nil {
+			assert.Nil(t, writeJSON(&b, vars), "for test %d", i)
+		} else {
+			writeSet(&b, c.Shell, vars)
+		}
+		assert.Equal(t, c.Expected, b.String(), "for test %d", i)
+	}
+}
@@ -31,3 +31,107 @@ func Fetch(args ...string) error {
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
+
+func RevParse(ref string) (string, error) {
+	out, err := exec.Command("git", "rev-parse", "--verify", ref+"^{commit}").CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%v", strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func Clone(url, dir string) error {
+	cmd := exec.Command("git", "clone", url, dir)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// FetchFrom fetches all branches and tags from an alternate remote, such as a
+// path to a bare repository. Branches are stored under refs/remotes/mirror.
+func FetchFrom(remote string) error {
+	return Fetch(remote, "+refs/heads/*:refs/remotes/mirror/*", "+refs/tags/*:refs/tags/*")
+}
+
+func CloneMirror(url, dir string) error {
+	cmd := exec.Command("git", "clone", "--mirror", url, dir)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// ShortRef abbreviates a commit hash for display.
+func ShortRef(ref string) string {
+	if len(ref) > 7 {
+		return ref[:7]
+	}
+	return ref
+}
+
+// Changes lists the commits in from..to, one line per commit in the
+// `--oneline` format.
+func Changes(from, to string) ([]string, error) {
+	out, err := exec.Command("git", "log", "--oneline", from+".."+to).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("%v", strings.TrimSpace(string(out)))
+	}
+
+	var changes []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line != "" {
+			changes = append(changes, line)
+		}
+	}
+	return changes, nil
+}
+
+// SubmoduleCommit returns the commit of a submodule as it is recorded in
+// HEAD of the superproject.
+func SubmoduleCommit(path string) (string, error) {
+	out, err := exec.Command("git", "ls-tree", "HEAD", path).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%v", strings.TrimSpace(string(out)))
+	}
+
+	fields := strings.Fields(string(out))
+	if len(fields) < 3 {
+		return "", fmt.Errorf("%v is not in HEAD", path)
+	} else if fields[1] != "commit" {
+		return "", fmt.Errorf("%v is not a submodule", path)
+	}
+	return fields[2], nil
+}
+
+func UpdateSubmodulesRemote(paths ...string) error {
+	args := append([]string{"submodule", "update", "--remote", "--"}, paths...)
+	cmd := exec.Command("git", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func Reset(paths ...string) error {
+	args := append([]string{"reset", "-q", "--"}, paths...)
+	out, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func Add(paths ...string) error {
+	args := append([]string{"add", "--"}, paths...)
+	out, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func Commit(message string) error {
+	cmd := exec.Command("git", "commit", "-F", "-")
+	cmd.Stdin = strings.NewReader(message)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
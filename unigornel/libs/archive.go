@@ -0,0 +1,328 @@
+package libs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// archiveStampFile is written into an extracted archive. It holds the
+// sha256 of the archive and the hash of the extracted tree, so that changes
+// to the files can be detected.
+const archiveStampFile = ".unigornel-sha256"
+
+func isRemoteURL(url string) bool {
+	return strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")
+}
+
+// updateArchive downloads, verifies and extracts an archive to dir. Nothing
+// is done if dir already holds the extracted archive.
+func updateArchive(dir string, p Package) error {
+	if verifyArchive(dir, p) == nil {
+		return nil
+	}
+
+	fh, err := ioutil.TempFile("", "unigornel-archive-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(fh.Name())
+	defer fh.Close()
+
+	sum, err := downloadArchive(fh, p.URL)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(sum, p.SHA256) {
+		return fmt.Errorf("sha256 mismatch for %v: expected %v, got %v", p.URL, p.SHA256, sum)
+	}
+
+	tmp := dir + ".unigornel-tmp"
+	os.RemoveAll(tmp)
+	if err := extractArchive(fh.Name(), p.URL, tmp); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	tree, err := treeHash(tmp)
+	if err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	stamp := sum + "\n" + tree + "\n"
+	if err := ioutil.WriteFile(filepath.Join(tmp, archiveStampFile), []byte(stamp), 0644); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	return os.Rename(tmp, dir)
+}
+
+// readArchiveStamp returns the sha256 of the archive and the hash of the
+// tree that was extracted from it.
+func readArchiveStamp(dir string) (string, string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, archiveStampFile))
+	if err != nil {
+		return "", "", err
+	}
+	lines := strings.Fields(string(b))
+	if len(lines) != 2 {
+		return "", "", fmt.Errorf("invalid %v (run `unigornel libs update`)", archiveStampFile)
+	}
+	return lines[0], lines[1], nil
+}
+
+// treeHash hashes the names, permissions and contents of the files in dir,
+// except for the stamp file.
+func treeHash(dir string) (string, error) {
+	h := sha256.New()
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		switch {
+		case rel == archiveStampFile || rel == ".":
+			return nil
+		case info.IsDir():
+			fmt.Fprintf(h, "dir %v\n", rel)
+			return nil
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "link %v %v\n", rel, target)
+			return nil
+		}
+
+		fh, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer fh.Close()
+		fileHash := sha256.New()
+		if _, err := io.Copy(fileHash, fh); err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "file %v %v %x\n", rel, info.Mode().Perm(), fileHash.Sum(nil))
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// downloadArchive copies the archive at url to w and returns its sha256.
+func downloadArchive(w io.Writer, url string) (string, error) {
+	var r io.ReadCloser
+	if isRemoteURL(url) {
+		resp, err := http.Get(url)
+		if err != nil {
+			return "", err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return "", fmt.Errorf("could not download %v: %v", url, resp.Status)
+		}
+		r = resp.Body
+	} else {
+		fh, err := os.Open(url)
+		if err != nil {
+			return "", err
+		}
+		r = fh
+	}
+	defer r.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(w, h), r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// extractArchive extracts the archive in file to dir. The format is derived
+// from the name of the archive. If all files are in a single top-level
+// directory, that directory is stripped.
+func extractArchive(file, name, dir string) error {
+	var entries []archiveEntry
+	var err error
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		entries, err = readTarGz(file)
+	case strings.HasSuffix(name, ".tar"):
+		entries, err = readTar(file)
+	case strings.HasSuffix(name, ".zip"):
+		entries, err = readZip(file)
+	default:
+		return fmt.Errorf("unknown archive format: %v", name)
+	}
+	if err != nil {
+		return err
+	}
+
+	prefix := commonPrefix(entries)
+	for _, e := range entries {
+		name := strings.TrimPrefix(e.Name, "./")
+		if name+"/" == prefix {
+			continue
+		}
+		name = strings.TrimPrefix(name, prefix)
+		if name == "" || name == "." {
+			continue
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if !strings.HasPrefix(target, filepath.Clean(dir)+string(filepath.Separator)) {
+			return fmt.Errorf("archive entry outside of the archive: %v", e.Name)
+		}
+
+		if e.Dir {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(target, e.Data, e.Mode|0200); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type archiveEntry struct {
+	Name string
+	Dir  bool
+	Mode os.FileMode
+	Data []byte
+}
+
+func readTarGz(file string) ([]archiveEntry, error) {
+	fh, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	gz, err := gzip.NewReader(fh)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	return readTarFrom(gz)
+}
+
+func readTar(file string) ([]archiveEntry, error) {
+	fh, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	return readTarFrom(fh)
+}
+
+func readTarFrom(r io.Reader) ([]archiveEntry, error) {
+	var entries []archiveEntry
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch h.Typeflag {
+		case tar.TypeDir:
+			entries = append(entries, archiveEntry{Name: h.Name, Dir: true})
+		case tar.TypeReg:
+			data, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, archiveEntry{
+				Name: h.Name,
+				Mode: os.FileMode(h.Mode).Perm(),
+				Data: data,
+			})
+		}
+	}
+}
+
+func readZip(file string) ([]archiveEntry, error) {
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	var entries []archiveEntry
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			entries = append(entries, archiveEntry{Name: f.Name, Dir: true})
+			continue
+		}
+
+		r, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, archiveEntry{
+			Name: f.Name,
+			Mode: f.Mode().Perm(),
+			Data: data,
+		})
+	}
+	return entries, nil
+}
+
+// commonPrefix returns the top-level directory, including the trailing
+// slash, that holds all entries, or an empty string if there is none.
+func commonPrefix(entries []archiveEntry) string {
+	var prefix string
+	for _, e := range entries {
+		name := strings.TrimPrefix(e.Name, "./")
+		i := strings.Index(name, "/")
+		if i < 0 {
+			if e.Dir && (prefix == "" || prefix == name+"/") {
+				prefix = name + "/"
+				continue
+			}
+			return ""
+		}
+		if prefix == "" {
+			prefix = name[:i+1]
+		} else if prefix != name[:i+1] {
+			return ""
+		}
+	}
+	return prefix
+}
@@ -0,0 +1,211 @@
+package libs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommonPrefix(t *testing.T) {
+	cases := []struct {
+		Names  []string
+		Prefix string
+	}{
+		{[]string{"lib-1.0/", "lib-1.0/a.go", "lib-1.0/sub/b.go"}, "lib-1.0/"},
+		{[]string{"./lib-1.0/a.go", "./lib-1.0/b.go"}, "lib-1.0/"},
+		{[]string{"lib-1.0", "lib-1.0/a.go"}, "lib-1.0/"},
+		{[]string{"a.go", "sub/b.go"}, ""},
+		{[]string{"one/a.go", "two/b.go"}, ""},
+		{nil, ""},
+	}
+
+	for i, c := range cases {
+		var entries []archiveEntry
+		for _, n := range c.Names {
+			dir := n[len(n)-1] == '/' || n == "lib-1.0"
+			entries = append(entries, archiveEntry{Name: n, Dir: dir})
+		}
+		assert.Equal(t, c.Prefix, commonPrefix(entries), "for test %d", i)
+	}
+}
+
+// testArchive is an archive in a test.
+type testArchive struct {
+	Name  string
+	Files map[string]string
+}
+
+// write writes the archive to dir and returns its path and sha256.
+func (a testArchive) write(t *testing.T, dir string) (string, string) {
+	var b bytes.Buffer
+	switch {
+	case strings.HasSuffix(a.Name, ".zip"):
+		zw := zip.NewWriter(&b)
+		for _, name := range sortedNames(a.Files) {
+			w, err := zw.Create(name)
+			require.Nil(t, err)
+			io.WriteString(w, a.Files[name])
+		}
+		require.Nil(t, zw.Close())
+	default:
+		gz := gzip.NewWriter(&b)
+		tw := tar.NewWriter(gz)
+		for _, name := range sortedNames(a.Files) {
+			data := a.Files[name]
+			require.Nil(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}))
+			io.WriteString(tw, data)
+		}
+		require.Nil(t, tw.Close())
+		require.Nil(t, gz.Close())
+	}
+
+	file := filepath.Join(dir, a.Name)
+	require.Nil(t, ioutil.WriteFile(file, b.Bytes(), 0644))
+	sum := sha256.Sum256(b.Bytes())
+	return file, hex.EncodeToString(sum[:])
+}
+
+func sortedNames(files map[string]string) []string {
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// readTree returns the contents of the files in dir, except for the stamp.
+func readTree(t *testing.T, dir string) map[string]string {
+	files := make(map[string]string)
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		require.Nil(t, err)
+		rel, _ := filepath.Rel(dir, path)
+		if info.IsDir() || rel == archiveStampFile {
+			return nil
+		}
+		data, err := ioutil.ReadFile(path)
+		require.Nil(t, err)
+		files[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	return files
+}
+
+func TestExtractArchive(t *testing.T) {
+	cases := []struct {
+		Archive  testArchive
+		Expected map[string]string
+		Error    string
+	}{
+		{
+			Archive: testArchive{"lib.tar.gz", map[string]string{
+				"lib-1.0/a.go":     "package a",
+				"lib-1.0/sub/b.go": "package sub",
+			}},
+			Expected: map[string]string{"a.go": "package a", "sub/b.go": "package sub"},
+		},
+		{
+			Archive: testArchive{"lib.zip", map[string]string{
+				"a.go":     "package a",
+				"sub/b.go": "package sub",
+			}},
+			Expected: map[string]string{"a.go": "package a", "sub/b.go": "package sub"},
+		},
+		{
+			Archive: testArchive{"lib.tgz", map[string]string{
+				"lib/a.go": "package a",
+				"../evil":  "evil",
+			}},
+			Error: "archive entry outside of the archive: ../evil",
+		},
+		{
+			Archive: testArchive{"lib.zip", map[string]string{
+				"a.go":           "package a",
+				"sub/../../evil": "evil",
+			}},
+			Error: "archive entry outside of the archive: sub/../../evil",
+		},
+		{
+			Archive: testArchive{"lib.rar", map[string]string{"a.go": "package a"}},
+			Error:   "unknown archive format: lib.rar",
+		},
+	}
+
+	for i, c := range cases {
+		dir, err := ioutil.TempDir("", "unigornel-archive")
+		require.Nil(t, err)
+
+		file, _ := c.Archive.write(t, dir)
+		out := filepath.Join(dir, "out")
+		err = extractArchive(file, c.Archive.Name, out)
+		if c.Error != "" {
+			if assert.NotNil(t, err, "for test %d", i) {
+				assert.Equal(t, c.Error, err.Error(), "for test %d", i)
+			}
+			_, err := os.Stat(filepath.Join(dir, "evil"))
+			assert.True(t, os.IsNotExist(err), "for test %d", i)
+		} else if assert.Nil(t, err, "for test %d", i) {
+			assert.Equal(t, c.Expected, readTree(t, out), "for test %d", i)
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestUpdateArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unigornel-archive")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	archive := testArchive{"lib.tar.gz", map[string]string{"lib/a.go": "package a"}}
+	file, sum := archive.write(t, dir)
+	lib := filepath.Join(dir, "src", "lib")
+	p := Package{Name: "lib", Type: SourceArchive, URL: file, SHA256: sum}
+
+	// A wrong checksum is not extracted.
+	wrong := p
+	wrong.SHA256 = strings.Repeat("0", 64)
+	if err := updateArchive(lib, wrong); assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "sha256 mismatch")
+	}
+	_, err = os.Stat(lib)
+	assert.True(t, os.IsNotExist(err))
+
+	// The archive is extracted and verified.
+	assert.Nil(t, updateArchive(lib, p))
+	assert.Equal(t, map[string]string{"a.go": "package a"}, readTree(t, lib))
+	assert.Nil(t, verifyArchive(lib, p))
+	if err := verifyArchive(lib, wrong); assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "pinned at")
+	}
+
+	// Changed, added and removed files fail the verification, and are
+	// restored by an update.
+	changes := []func(){
+		func() { ioutil.WriteFile(filepath.Join(lib, "a.go"), []byte("package b"), 0644) },
+		func() { ioutil.WriteFile(filepath.Join(lib, "b.go"), []byte("package a"), 0644) },
+		func() { os.Remove(filepath.Join(lib, "a.go")) },
+		func() { os.Chmod(filepath.Join(lib, "a.go"), 0755) },
+	}
+	for i, change := range changes {
+		change()
+		if err := verifyArchive(lib, p); assert.NotNil(t, err, "for change %d", i) {
+			assert.Equal(t, "files were changed after the archive was extracted", err.Error(), "for change %d", i)
+		}
+		assert.Nil(t, updateArchive(lib, p), "for change %d", i)
+		assert.Nil(t, verifyArchive(lib, p), "for change %d", i)
+		assert.Equal(t, map[string]string{"a.go": "package a"}, readTree(t, lib), "for change %d", i)
+	}
+}
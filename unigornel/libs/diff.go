@@ -0,0 +1,165 @@
+package libs
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	"github.com/unigornel/unigornel/unigornel/git"
+	"github.com/urfave/cli"
+)
+
+const (
+	toFlagName      = "to"
+	messageFlagName = "message"
+)
+
+func toFlag() cli.Flag {
+	return cli.StringFlag{
+		Name:  toFlagName,
+		Usage: "compare with this ref instead of the current checkout",
+	}
+}
+
+func messageFlag() cli.Flag {
+	return cli.StringFlag{
+		Name:  messageFlagName + ", m",
+		Usage: "write a commit message describing the changes to this file",
+	}
+}
+
+func diff() cli.Command {
+	return cli.Command{
+		Name:  "diff",
+		Usage: "list the commits between the pinned refs and the current checkouts",
+		Flags: []cli.Flag{
+			toFlag(),
+		},
+		Action: func(ctx *cli.Context) error {
+			o := diffLibOptions{
+				File: ctx.GlobalString(libraryFileFlagName),
+				To:   ctx.String(toFlagName),
+			}
+			if err := o.diffLibs(); err != nil {
+				return cli.NewExitError("error: "+err.Error(), 1)
+			}
+			return nil
+		},
+	}
+}
+
+// libraryChanges are the commits between the pinned ref of a library and
+// another ref.
+type libraryChanges struct {
+	Package Package
+	To      string
+	Commits []string
+}
+
+// changesOf lists the changes of the library in the current directory. A
+// library that was not pinned before has no changes to list.
+func changesOf(p Package, to string) (libraryChanges, error) {
+	changes := libraryChanges{
+		Package: p,
+		To:      to,
+	}
+	if p.Ref == "" {
+		return changes, nil
+	}
+
+	commits, err := git.Changes(p.Ref, to)
+	if err != nil {
+		return changes, err
+	}
+	changes.Commits = commits
+	return changes, nil
+}
+
+func writeChanges(w io.Writer, c libraryChanges) {
+	if c.Package.Ref == "" {
+		fmt.Fprintf(w, "Pinned %v at %v\n\n", c.Package.Name, git.ShortRef(c.To))
+		return
+	}
+	fmt.Fprintf(w, "Changes in %v (%v..%v):\n", c.Package.Name, git.ShortRef(c.Package.Ref), git.ShortRef(c.To))
+	for _, commit := range c.Commits {
+		fmt.Fprintln(w, commit)
+	}
+	fmt.Fprintln(w)
+}
+
+func writeCommitMessage(w io.Writer, changes []libraryChanges) {
+	fmt.Fprintln(w, "Update libraries")
+	fmt.Fprintln(w)
+	for _, c := range changes {
+		writeChanges(w, c)
+	}
+}
+
+type diffLibOptions struct {
+	File string
+	To   string
+}
+
+func (o *diffLibOptions) diffLibs() error {
+	gopath := os.Getenv("GOPATH")
+	if gopath == "" {
+		return fmt.Errorf("GOPATH is not set")
+	}
+
+	libs, err := readLibraries(o.File)
+	if err != nil {
+		return err
+	}
+
+	curdir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	var didErr bool
+	for _, p := range libs.Packages {
+		if p.SourceType() != SourceGit {
+			continue
+		}
+
+		path := path.Join(gopath, "src", p.Name)
+		if err := os.Chdir(path); err != nil {
+			continue
+		}
+
+		to := o.To
+		if to == "" {
+			to, err = git.ShowRef()
+		} else {
+			to, err = git.RevParse(to)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: could not diff %v: %v\n", p.Name, err)
+			didErr = true
+			continue
+		}
+
+		if to == p.Ref {
+			continue
+		}
+
+		changes, err := changesOf(p, to)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: could not diff %v: %v\n", p.Name, err)
+			didErr = true
+			continue
+		}
+		writeChanges(os.Stdout, changes)
+	}
+
+	if err := os.Chdir(curdir); err != nil {
+		return err
+	}
+
+	if didErr {
+		return fmt.Errorf("could not diff some packages")
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package libs
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteChanges(t *testing.T) {
+	cases := []struct {
+		Changes  libraryChanges
+		Expected string
+	}{
+		{
+			libraryChanges{
+				Package: Package{Name: "github.com/unigornel/go-tcpip", Ref: "0123456789abcdef"},
+				To:      "fedcba9876543210",
+				Commits: []string{"fedcba9 Fix checksum", "abcdef0 Add ARP cache"},
+			},
+			"Changes in github.com/unigornel/go-tcpip (0123456..fedcba9):\nfedcba9 Fix checksum\nabcdef0 Add ARP cache\n\n",
+		},
+		{
+			libraryChanges{
+				Package: Package{Name: "github.com/unigornel/go-tcpip", Ref: "0123456789abcdef"},
+				To:      "fedcba9876543210",
+			},
+			"Changes in github.com/unigornel/go-tcpip (0123456..fedcba9):\n\n",
+		},
+		{
+			libraryChanges{
+				Package: Package{Name: "github.com/unigornel/go-tcpip"},
+				To:      "fedcba9876543210",
+			},
+			"Pinned github.com/unigornel/go-tcpip at fedcba9\n\n",
+		},
+	}
+
+	for i, c := range cases {
+		var b bytes.Buffer
+		writeChanges(&b, c.Changes)
+		assert.Equal(t, c.Expected, b.String(), "for test %d", i)
+	}
+}
+
+func TestWriteCommitMessage(t *testing.T) {
+	cases := []struct {
+		Changes  []libraryChanges
+		Expected string
+	}{
+		{
+			nil,
+			"Update libraries\n\n",
+		},
+		{
+			[]libraryChanges{
+				{Package: Package{Name: "a", Ref: "1111111111"}, To: "2222222222", Commits: []string{"2222222 Change a"}},
+				{Package: Package{Name: "b"}, To: "3333333333"},
+			},
+			"Update libraries\n\nChanges in a (1111111..2222222):\n2222222 Change a\n\nPinned b at 3333333\n\n",
+		},
+	}
+
+	for i, c := range cases {
+		var b bytes.Buffer
+		writeCommitMessage(&b, c.Changes)
+		assert.Equal(t, c.Expected, b.String(), "for test %d", i)
+	}
+}
+
+func TestChangesOfUnpinned(t *testing.T) {
+	p := Package{Name: "a"}
+	c, err := changesOf(p, "2222222222")
+	assert.Nil(t, err)
+	assert.Equal(t, libraryChanges{Package: p, To: "2222222222"}, c)
+}
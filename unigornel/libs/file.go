@@ -0,0 +1,177 @@
+package libs
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+const packagesKey = "packages"
+
+// libraryFile is a libraries file that can be edited without losing the
+// ordering and the comments of the original document.
+type libraryFile struct {
+	Path string
+	doc  yaml.Node
+}
+
+func openLibraryFile(file string) (*libraryFile, error) {
+	f := &libraryFile{Path: file}
+
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		f.doc = yaml.Node{
+			Kind:    yaml.DocumentNode,
+			Content: []*yaml.Node{{Kind: yaml.MappingNode}},
+		}
+		return f, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(b, &f.doc); err != nil {
+		return nil, err
+	}
+	if f.doc.Kind == 0 {
+		f.doc = yaml.Node{
+			Kind:    yaml.DocumentNode,
+			Content: []*yaml.Node{{Kind: yaml.MappingNode}},
+		}
+	}
+	return f, nil
+}
+
+// Libraries decodes the current contents of the file.
+func (f *libraryFile) Libraries() (Libraries, error) {
+	var libs Libraries
+	err := f.doc.Decode(&libs)
+	return libs, err
+}
+
+// Set adds the package to the file, or updates the package with the same
+// name in place.
+func (f *libraryFile) Set(p Package) error {
+	packages, err := f.packages()
+	if err != nil {
+		return err
+	}
+
+	var n yaml.Node
+	if err := n.Encode(p); err != nil {
+		return err
+	}
+
+	if i := findPackage(packages, p.Name); i >= 0 {
+		updateMapping(packages.Content[i], &n)
+	} else {
+		packages.Content = append(packages.Content, &n)
+	}
+	return nil
+}
+
+// Remove drops the package with the given name from the file. It reports
+// whether the package was present.
+func (f *libraryFile) Remove(name string) (bool, error) {
+	packages, err := f.packages()
+	if err != nil {
+		return false, err
+	}
+
+	i := findPackage(packages, name)
+	if i < 0 {
+		return false, nil
+	}
+	packages.Content = append(packages.Content[:i], packages.Content[i+1:]...)
+	return true, nil
+}
+
+// Save writes the file back to disk.
+func (f *libraryFile) Save() error {
+	var b bytes.Buffer
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(&f.doc); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(f.Path, b.Bytes(), 0644)
+}
+
+func (f *libraryFile) packages() (*yaml.Node, error) {
+	if f.doc.Kind != yaml.DocumentNode || len(f.doc.Content) != 1 {
+		return nil, fmt.Errorf("%v: not a yaml document", f.Path)
+	}
+	root := f.doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%v: expected a mapping at the top level", f.Path)
+	}
+
+	if packages := mappingValue(root, packagesKey); packages != nil {
+		if packages.Kind == yaml.ScalarNode && packages.Tag == "!!null" {
+			packages.Kind = yaml.SequenceNode
+			packages.Tag = "!!seq"
+			packages.Value = ""
+		}
+		if packages.Kind != yaml.SequenceNode {
+			return nil, fmt.Errorf("%v: %v is not a list", f.Path, packagesKey)
+		}
+		return packages, nil
+	}
+
+	packages := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	root.Content = append(
+		root.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: packagesKey},
+		packages,
+	)
+	return packages, nil
+}
+
+func findPackage(packages *yaml.Node, name string) int {
+	for i, p := range packages.Content {
+		if v := mappingValue(p, "name"); v != nil && v.Value == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	if m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// updateMapping replaces the values in dst by those in src. Keys that are
+// missing from src are removed. Keys keep their position and comments.
+func updateMapping(dst, src *yaml.Node) {
+	var content []*yaml.Node
+	for i := 0; i+1 < len(dst.Content); i += 2 {
+		key, value := dst.Content[i], dst.Content[i+1]
+		v := mappingValue(src, key.Value)
+		if v == nil {
+			continue
+		}
+		v.HeadComment = value.HeadComment
+		v.LineComment = value.LineComment
+		v.FootComment = value.FootComment
+		content = append(content, key, v)
+	}
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		if mappingValue(dst, src.Content[i].Value) == nil {
+			content = append(content, src.Content[i], src.Content[i+1])
+		}
+	}
+	dst.Content = content
+}
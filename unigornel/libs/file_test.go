@@ -0,0 +1,71 @@
+package libs
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLibraryFileEdit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unigornel-libs-")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	file := path.Join(dir, "libraries.yaml")
+	require.Nil(t, ioutil.WriteFile(file, []byte(libraryFileInput), 0644))
+
+	f, err := openLibraryFile(file)
+	require.Nil(t, err)
+
+	require.Nil(t, f.Set(Package{Name: "github.com/unigornel/go-tcpip", Ref: "2222"}))
+	require.Nil(t, f.Set(Package{Name: "github.com/example/new", Ref: "3333"}))
+	found, err := f.Remove("github.com/example/old")
+	require.Nil(t, err)
+	assert.True(t, found)
+	found, err = f.Remove("github.com/example/missing")
+	require.Nil(t, err)
+	assert.False(t, found)
+	require.Nil(t, f.Save())
+
+	b, err := ioutil.ReadFile(file)
+	require.Nil(t, err)
+	assert.Equal(t, libraryFileOutput, string(b))
+}
+
+func TestLibraryFileMissing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unigornel-libs-")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	file := path.Join(dir, "libraries.yaml")
+	f, err := openLibraryFile(file)
+	require.Nil(t, err)
+	require.Nil(t, f.Set(Package{Name: "github.com/unigornel/go-tcpip", Ref: "1111"}))
+	require.Nil(t, f.Save())
+
+	libs, err := readLibraries(file)
+	require.Nil(t, err)
+	assert.Equal(t, []Package{{Name: "github.com/unigornel/go-tcpip", Ref: "1111"}}, libs.Packages)
+}
+
+var libraryFileInput = `# libraries used by the unikernels
+packages:
+# the network stack
+- name: github.com/unigornel/go-tcpip
+  ref: 1111 # pinned for the ping tests
+- name: github.com/example/old
+  ref: 4444
+`
+
+var libraryFileOutput = `# libraries used by the unikernels
+packages:
+  # the network stack
+  - name: github.com/unigornel/go-tcpip
+    ref: "2222" # pinned for the ping tests
+  - name: github.com/example/new
+    ref: "3333"
+`
@@ -0,0 +1,266 @@
+package libs
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/unigornel/unigornel/unigornel/config"
+	"github.com/unigornel/unigornel/unigornel/env"
+	"github.com/unigornel/unigornel/unigornel/git"
+	"github.com/urfave/cli"
+)
+
+const addFlagName = "add"
+
+func addFlag() cli.Flag {
+	return cli.BoolFlag{
+		Name:  addFlagName,
+		Usage: "pin unpinned repositories at their current commit",
+	}
+}
+
+func graph() cli.Command {
+	return cli.Command{
+		Name:      "graph",
+		Usage:     "show the repositories that provide the imports of a unikernel",
+		ArgsUsage: "[PACKAGE]",
+		Flags: []cli.Flag{
+			addFlag(),
+		},
+		Action: func(ctx *cli.Context) error {
+			if ctx.NArg() > 1 {
+				cli.ShowSubcommandHelp(ctx)
+				return cli.NewExitError("error: subcommand expects zero or one arguments", 1)
+			}
+			toolchain, err := env.GetToolchain(env.ConfigFile(ctx), env.ToolchainName(ctx))
+			if err != nil {
+				return cli.NewExitError("error: "+err.Error(), 1)
+			}
+			o := graphLibOptions{
+				File:      ctx.GlobalString(libraryFileFlagName),
+				Package:   ctx.Args().First(),
+				Add:       ctx.Bool(addFlagName),
+				Toolchain: toolchain,
+			}
+			if o.Package == "" {
+				o.Package = "."
+			}
+			if err := o.graphLibs(); err != nil {
+				return cli.NewExitError("error: "+err.Error(), 1)
+			}
+			return nil
+		},
+	}
+}
+
+// goPackage is a package in the import graph of a unikernel.
+type goPackage struct {
+	ImportPath string
+	Dir        string
+	Standard   bool
+}
+
+// repository groups the imported packages that are provided by the same
+// repository.
+type repository struct {
+	Root     string
+	Dir      string
+	Pinned   *Package
+	Packages []string
+}
+
+// listImports lists the package and all of its dependencies, as they are
+// resolved when building for GOOS=unigornel with the go binary of the
+// toolchain.
+func listImports(toolchain config.Config, pack string) ([]goPackage, error) {
+	goBinary := env.GoBinary(toolchain)
+	environ := env.GoEnviron(toolchain)
+
+	cmd := exec.Command(goBinary, "list", "-f", "{{.ImportPath}}{{range .Deps}} {{.}}{{end}}", pack)
+	cmd.Env = environ
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go list %v: %v", pack, err)
+	}
+
+	args := []string{"list", "-e", "-f", "{{.ImportPath}}\t{{.Standard}}\t{{.Dir}}"}
+	args = append(args, strings.Fields(string(out))...)
+	cmd = exec.Command(goBinary, args...)
+	cmd.Env = environ
+	cmd.Stderr = os.Stderr
+	out, err = cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go list: %v", err)
+	}
+
+	var packages []goPackage
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 {
+			continue
+		}
+		packages = append(packages, goPackage{
+			ImportPath: fields[0],
+			Standard:   fields[1] == "true",
+			Dir:        fields[2],
+		})
+	}
+	return packages, nil
+}
+
+// pinnedPackage returns the pinned library that provides the import path.
+func pinnedPackage(libs Libraries, importPath string) *Package {
+	for i, p := range libs.Packages {
+		if importPath == p.Name || strings.HasPrefix(importPath, p.Name+"/") {
+			return &libs.Packages[i]
+		}
+	}
+	return nil
+}
+
+// repositoryRoot finds the git repository that contains dir and returns its
+// import path and directory.
+func repositoryRoot(gopath, dir string) (string, string) {
+	src := filepath.Join(gopath, "src")
+	for d := dir; strings.HasPrefix(d, src+string(filepath.Separator)); d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			root, _ := filepath.Rel(src, d)
+			return filepath.ToSlash(root), d
+		}
+	}
+	return "", ""
+}
+
+type graphLibOptions struct {
+	File      string
+	Package   string
+	Add       bool
+	Toolchain config.Config
+}
+
+func (o *graphLibOptions) graphLibs() error {
+	gopath := os.Getenv("GOPATH")
+	if gopath == "" {
+		return fmt.Errorf("GOPATH is not set")
+	}
+
+	file, err := openLibraryFile(o.File)
+	if err != nil {
+		return err
+	}
+
+	libs, err := file.Libraries()
+	if err != nil {
+		return err
+	}
+
+	packages, err := listImports(o.Toolchain, o.Package)
+	if err != nil {
+		return err
+	} else if len(packages) == 0 {
+		return fmt.Errorf("no packages found for %v", o.Package)
+	}
+
+	// The first package is the unikernel itself. Its own repository is
+	// not a dependency.
+	self, _ := repositoryRoot(gopath, packages[0].Dir)
+
+	repos := make(map[string]*repository)
+	for _, p := range packages[1:] {
+		if p.Standard || p.ImportPath == "C" {
+			continue
+		}
+
+		var root, dir string
+		pinned := pinnedPackage(libs, p.ImportPath)
+		if pinned != nil {
+			root = pinned.Name
+		} else if root, dir = repositoryRoot(gopath, p.Dir); root == "" {
+			root = p.ImportPath
+		}
+		if root == self && self != "" {
+			continue
+		}
+
+		r, ok := repos[root]
+		if !ok {
+			r = &repository{Root: root, Dir: dir, Pinned: pinned}
+			repos[root] = r
+		}
+		r.Packages = append(r.Packages, p.ImportPath)
+	}
+
+	roots := make([]string, 0, len(repos))
+	for root := range repos {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+
+	var unpinned []*repository
+	for _, root := range roots {
+		r := repos[root]
+		if r.Pinned != nil {
+			fmt.Printf("%v\n", r.Pinned)
+		} else {
+			fmt.Printf("%v (NOT PINNED)\n", r.Root)
+			unpinned = append(unpinned, r)
+		}
+		for _, p := range r.Packages {
+			fmt.Printf("    %v\n", p)
+		}
+	}
+
+	if len(unpinned) == 0 {
+		return nil
+	} else if !o.Add {
+		return fmt.Errorf("%d repositories are not pinned in %v", len(unpinned), o.File)
+	}
+
+	curdir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	var didErr bool
+	for _, r := range unpinned {
+		if r.Dir == "" {
+			fmt.Fprintf(os.Stderr, "warning: could not pin %v: not in a git repository\n", r.Root)
+			didErr = true
+			continue
+		}
+
+		if err := os.Chdir(r.Dir); err != nil {
+			return err
+		}
+		ref, err := git.ShowRef()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: could not pin %v: %v\n", r.Root, err)
+			didErr = true
+			continue
+		}
+
+		fmt.Printf("adding %v (ref: %v)\n", r.Root, ref)
+		if err := file.Set(Package{Name: r.Root, Ref: ref}); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Chdir(curdir); err != nil {
+		return err
+	}
+
+	if err := file.Save(); err != nil {
+		return err
+	}
+
+	if didErr {
+		return fmt.Errorf("could not pin some repositories")
+	}
+
+	return nil
+}
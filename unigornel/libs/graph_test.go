@@ -0,0 +1,89 @@
+package libs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPinnedPackage(t *testing.T) {
+	libs := Libraries{Packages: []Package{
+		{Name: "github.com/unigornel/foo", Ref: "1"},
+		{Name: "github.com/unigornel/go-tcpip", Ref: "2"},
+	}}
+
+	cases := []struct {
+		ImportPath string
+		Pinned     string
+	}{
+		{"github.com/unigornel/foo", "github.com/unigornel/foo"},
+		{"github.com/unigornel/foo/bar", "github.com/unigornel/foo"},
+		{"github.com/unigornel/foo/bar/baz", "github.com/unigornel/foo"},
+		{"github.com/unigornel/foobar", ""},
+		{"github.com/unigornel/foobar/baz", ""},
+		{"github.com/unigornel/go-tcpip/ethernet", "github.com/unigornel/go-tcpip"},
+		{"github.com/unigornel/app/vendor/github.com/unigornel/foo", ""},
+		{"fmt", ""},
+		{"net/http", ""},
+	}
+
+	for i, c := range cases {
+		p := pinnedPackage(libs, c.ImportPath)
+		if c.Pinned == "" {
+			assert.Nil(t, p, "for test %d", i)
+		} else if assert.NotNil(t, p, "for test %d", i) {
+			assert.Equal(t, c.Pinned, p.Name, "for test %d", i)
+		}
+	}
+}
+
+func TestRepositoryRoot(t *testing.T) {
+	gopath, err := ioutil.TempDir("", "unigornel-gopath")
+	require.Nil(t, err)
+	defer os.RemoveAll(gopath)
+
+	src := filepath.Join(gopath, "src")
+	dirs := []string{
+		"github.com/unigornel/foo/.git",
+		"github.com/unigornel/foo/bar/baz",
+		"github.com/unigornel/foobar/baz",
+		"github.com/unigornel/app/.git",
+		"github.com/unigornel/app/vendor/github.com/x/y",
+	}
+	for _, d := range dirs {
+		require.Nil(t, os.MkdirAll(filepath.Join(src, filepath.FromSlash(d)), 0755))
+	}
+
+	cases := []struct {
+		Dir  string
+		Root string
+	}{
+		{"github.com/unigornel/foo", "github.com/unigornel/foo"},
+		{"github.com/unigornel/foo/bar/baz", "github.com/unigornel/foo"},
+		{"github.com/unigornel/foobar/baz", ""},
+		{"github.com/unigornel/app/vendor/github.com/x/y", "github.com/unigornel/app"},
+	}
+
+	for i, c := range cases {
+		root, dir := repositoryRoot(gopath, filepath.Join(src, filepath.FromSlash(c.Dir)))
+		assert.Equal(t, c.Root, root, "for test %d", i)
+		if c.Root == "" {
+			assert.Equal(t, "", dir, "for test %d", i)
+		} else {
+			assert.Equal(t, filepath.Join(src, filepath.FromSlash(c.Root)), dir, "for test %d", i)
+		}
+	}
+
+	// Packages outside of the GOPATH, such as those of the standard
+	// library, are in no repository.
+	root, dir := repositoryRoot(gopath, filepath.Join(os.TempDir(), "go", "src", "fmt"))
+	assert.Equal(t, "", root)
+	assert.Equal(t, "", dir)
+	root, dir = repositoryRoot(gopath, gopath+"-other/src/github.com/unigornel/foo")
+	assert.Equal(t, "", root)
+	assert.Equal(t, "", dir)
+}
@@ -6,8 +6,9 @@ import (
 	"os"
 	"path"
 
-	"gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
 
+	"github.com/unigornel/unigornel/unigornel/env"
 	"github.com/unigornel/unigornel/unigornel/git"
 	"github.com/urfave/cli"
 )
@@ -15,6 +16,7 @@ import (
 const (
 	libraryFileFlagName = "libs"
 	fetchFlagName       = "fetch"
+	mirrorFlagName      = "mirror"
 )
 
 func libraryFileFlag() cli.Flag {
@@ -26,6 +28,14 @@ func libraryFileFlag() cli.Flag {
 	}
 }
 
+func mirrorFlag() cli.Flag {
+	return cli.StringFlag{
+		Name:   mirrorFlagName,
+		EnvVar: "UNIGORNEL_LIBS_MIRROR",
+		Usage:  "directory of bare repositories to fetch the libraries from",
+	}
+}
+
 func fetchFlag() cli.Flag {
 	return cli.BoolFlag{
 		Name:  fetchFlagName,
@@ -39,7 +49,10 @@ func Libs() cli.Command {
 		Usage: "manage unigornel libraries",
 		Flags: []cli.Flag{
 			libraryFileFlag(),
+			mirrorFlag(),
+			env.ToolchainFlag(),
 		},
+		Before: useConfiguredLibraries,
 		Action: func(ctx *cli.Context) error {
 			o := showLibOptions{
 				File: ctx.String(libraryFileFlagName),
@@ -53,9 +66,13 @@ func Libs() cli.Command {
 			{
 				Name:  "save",
 				Usage: "save the libraries to a file",
+				Flags: []cli.Flag{
+					messageFlag(),
+				},
 				Action: func(ctx *cli.Context) error {
 					o := saveLibOptions{
-						File: ctx.GlobalString(libraryFileFlagName),
+						File:    ctx.GlobalString(libraryFileFlagName),
+						Message: ctx.String(messageFlagName),
 					}
 					if err := o.saveLibs(); err != nil {
 						return cli.NewExitError("error: "+err.Error(), 1)
@@ -63,6 +80,60 @@ func Libs() cli.Command {
 					return nil
 				},
 			},
+			{
+				Name:      "add",
+				Usage:     "add a library or change its ref",
+				ArgsUsage: "IMPORT-PATH [REF]",
+				Action: func(ctx *cli.Context) error {
+					if ctx.NArg() < 1 || ctx.NArg() > 2 {
+						cli.ShowSubcommandHelp(ctx)
+						return cli.NewExitError("error: subcommand expects one or two arguments", 1)
+					}
+					o := addLibOptions{
+						File:   ctx.GlobalString(libraryFileFlagName),
+						Mirror: configuredMirror(ctx),
+						Name:   ctx.Args()[0],
+						Ref:    ctx.Args().Get(1),
+					}
+					if err := o.addLib(); err != nil {
+						return cli.NewExitError("error: "+err.Error(), 1)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "remove",
+				Usage:     "remove libraries",
+				ArgsUsage: "IMPORT-PATH...",
+				Action: func(ctx *cli.Context) error {
+					if ctx.NArg() < 1 {
+						cli.ShowSubcommandHelp(ctx)
+						return cli.NewExitError("error: subcommand expects at least one argument", 1)
+					}
+					o := removeLibOptions{
+						File:  ctx.GlobalString(libraryFileFlagName),
+						Names: ctx.Args(),
+					}
+					if err := o.removeLibs(); err != nil {
+						return cli.NewExitError("error: "+err.Error(), 1)
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "fetch",
+				Usage: "fetch the libraries without checking them out",
+				Action: func(ctx *cli.Context) error {
+					o := fetchLibOptions{
+						File:   ctx.GlobalString(libraryFileFlagName),
+						Mirror: configuredMirror(ctx),
+					}
+					if err := o.fetchLibs(); err != nil {
+						return cli.NewExitError("error: "+err.Error(), 1)
+					}
+					return nil
+				},
+			},
 			{
 				Name:  "update",
 				Usage: "update the libraries from a file",
@@ -72,6 +143,7 @@ func Libs() cli.Command {
 				Action: func(ctx *cli.Context) error {
 					o := updateLibOptions{
 						File:        ctx.GlobalString(libraryFileFlagName),
+						Mirror:      configuredMirror(ctx),
 						ShouldFetch: ctx.Bool(fetchFlagName),
 					}
 					if err := o.updateLibs(); err != nil {
@@ -80,17 +152,75 @@ func Libs() cli.Command {
 					return nil
 				},
 			},
+			verify(),
+			diff(),
+			graph(),
+			mirror(),
 		},
 	}
 }
 
+// useConfiguredLibraries selects the libraries file of the configured
+// toolchain, unless a libraries file is given explicitly.
+func useConfiguredLibraries(ctx *cli.Context) error {
+	file := ctx.String(libraryFileFlagName)
+	if ctx.IsSet(libraryFileFlagName) && file != os.Getenv("UNIGORNEL_LIBRARIES") {
+		return nil
+	}
+
+	c, err := env.GetToolchain(env.ConfigFile(ctx), env.ToolchainName(ctx))
+	if err != nil {
+		return cli.NewExitError("error: "+err.Error(), 1)
+	}
+	if c.Libraries == "" {
+		return nil
+	}
+	return ctx.Set(libraryFileFlagName, c.Libraries)
+}
+
+// configuredMirror returns a function that returns the mirror given with
+// --mirror or UNIGORNEL_LIBS_MIRROR, or else the mirror of the configured
+// toolchain. The configuration is only read when the mirror is needed.
+func configuredMirror(ctx *cli.Context) func() (string, error) {
+	return func() (string, error) {
+		if m := ctx.GlobalString(mirrorFlagName); m != "" {
+			return m, nil
+		}
+		c, err := env.GetToolchain(env.ConfigFile(ctx), env.ToolchainName(ctx))
+		if err != nil {
+			return "", err
+		}
+		return c.Mirror, nil
+	}
+}
+
+// Package is a library pinned in the libraries file. The source type
+// determines which of the other fields are used.
 type Package struct {
 	Name string `yaml:"name"`
-	Ref  string `yaml:"ref"`
+	Type string `yaml:"type,omitempty"`
+
+	// Ref is the commit of a git source.
+	Ref string `yaml:"ref,omitempty"`
+
+	// URL and SHA256 locate and verify an archive source. The URL may
+	// also be a path.
+	URL    string `yaml:"url,omitempty"`
+	SHA256 string `yaml:"sha256,omitempty"`
+
+	// Path is the local directory of a path source.
+	Path string `yaml:"path,omitempty"`
 }
 
 func (lib Package) String() string {
-	return fmt.Sprintf("%v (ref: %v)", lib.Name, lib.Ref)
+	switch lib.SourceType() {
+	case SourceArchive:
+		return fmt.Sprintf("%v (archive: %v, sha256: %v)", lib.Name, lib.URL, lib.SHA256)
+	case SourcePath:
+		return fmt.Sprintf("%v (path: %v)", lib.Name, lib.Path)
+	default:
+		return fmt.Sprintf("%v (ref: %v)", lib.Name, lib.Ref)
+	}
 }
 
 type Libraries struct {
@@ -114,7 +244,8 @@ func (o *showLibOptions) showLibs() error {
 }
 
 type saveLibOptions struct {
-	File string
+	File    string
+	Message string
 }
 
 func (o *saveLibOptions) saveLibs() error {
@@ -123,7 +254,12 @@ func (o *saveLibOptions) saveLibs() error {
 		return fmt.Errorf("GOPATH is not set")
 	}
 
-	libs, err := readLibraries(o.File)
+	file, err := openLibraryFile(o.File)
+	if err != nil {
+		return err
+	}
+
+	libs, err := file.Libraries()
 	if err != nil {
 		return err
 	}
@@ -134,7 +270,12 @@ func (o *saveLibOptions) saveLibs() error {
 	}
 
 	var didErr bool
-	for i, p := range libs.Packages {
+	var changes []libraryChanges
+	for _, p := range libs.Packages {
+		if p.SourceType() != SourceGit {
+			continue
+		}
+
 		path := path.Join(gopath, "src", p.Name)
 		if err := os.Chdir(path); err != nil {
 			continue
@@ -149,7 +290,19 @@ func (o *saveLibOptions) saveLibs() error {
 
 		if p.Ref != ref {
 			fmt.Printf("updating %v: %v -> %v\n", p.Name, p.Ref, ref)
-			libs.Packages[i].Ref = ref
+			if o.Message != "" {
+				c, err := changesOf(p, ref)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "warning: could not list changes in %v: %v\n", p.Name, err)
+				} else {
+					changes = append(changes, c)
+				}
+			}
+
+			p.Ref = ref
+			if err := file.Set(p); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -157,28 +310,120 @@ func (o *saveLibOptions) saveLibs() error {
 		return err
 	}
 
-	new, err := yaml.Marshal(&libs)
-	if err != nil {
+	if err := file.Save(); err != nil {
 		return err
 	}
 
-	if err := ioutil.WriteFile(o.File, new, 0644); err != nil {
-		return err
+	if o.Message != "" && len(changes) > 0 {
+		fh, err := os.Create(o.Message)
+		if err != nil {
+			return err
+		}
+		writeCommitMessage(fh, changes)
+		if err := fh.Close(); err != nil {
+			return err
+		}
+		fmt.Printf("commit message written to %v\n", o.Message)
 	}
 
 	if didErr {
-		err = fmt.Errorf("could not save some packages")
+		return fmt.Errorf("could not save some packages")
 	}
 
 	return nil
 }
 
-type updateLibOptions struct {
-	File        string
-	ShouldFetch bool
+type addLibOptions struct {
+	File   string
+	Mirror func() (string, error)
+	Name   string
+	Ref    string
 }
 
-func (o *updateLibOptions) updateLibs() error {
+func (o *addLibOptions) addLib() error {
+	gopath := os.Getenv("GOPATH")
+	if gopath == "" {
+		return fmt.Errorf("GOPATH is not set")
+	}
+
+	file, err := openLibraryFile(o.File)
+	if err != nil {
+		return err
+	}
+
+	path := path.Join(gopath, "src", o.Name)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		mirror, err := o.Mirror()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("cloning %v\n", o.Name)
+		if err := git.Clone(remoteURL(mirror, o.Name), path); err != nil {
+			return fmt.Errorf("could not clone %v: %v", o.Name, err)
+		}
+	} else if err != nil {
+		return err
+	}
+
+	curdir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chdir(path); err != nil {
+		return err
+	}
+
+	var ref string
+	if o.Ref == "" {
+		ref, err = git.ShowRef()
+	} else {
+		ref, err = git.RevParse(o.Ref)
+	}
+	if err := os.Chdir(curdir); err != nil {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("could not resolve ref of %v: %v", o.Name, err)
+	}
+
+	fmt.Printf("adding %v (ref: %v)\n", o.Name, ref)
+	if err := file.Set(Package{Name: o.Name, Ref: ref}); err != nil {
+		return err
+	}
+	return file.Save()
+}
+
+type removeLibOptions struct {
+	File  string
+	Names []string
+}
+
+func (o *removeLibOptions) removeLibs() error {
+	file, err := openLibraryFile(o.File)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range o.Names {
+		found, err := file.Remove(name)
+		if err != nil {
+			return err
+		} else if !found {
+			return fmt.Errorf("no library with name %v", name)
+		}
+		fmt.Printf("removing %v\n", name)
+	}
+
+	return file.Save()
+}
+
+type fetchLibOptions struct {
+	File   string
+	Mirror func() (string, error)
+}
+
+func (o *fetchLibOptions) fetchLibs() error {
 	gopath := os.Getenv("GOPATH")
 	if gopath == "" {
 		return fmt.Errorf("GOPATH is not set")
@@ -189,6 +434,11 @@ func (o *updateLibOptions) updateLibs() error {
 		return err
 	}
 
+	mirror, err := o.Mirror()
+	if err != nil {
+		return err
+	}
+
 	curdir, err := os.Getwd()
 	if err != nil {
 		return err
@@ -196,18 +446,79 @@ func (o *updateLibOptions) updateLibs() error {
 
 	var didErr bool
 	for _, p := range libs.Packages {
+		if p.SourceType() != SourceGit {
+			continue
+		}
+
 		path := path.Join(gopath, "src", p.Name)
 		if err := os.Chdir(path); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: skipping %v: not in GOPATH (use `unigornel libs add`)\n", p.Name)
 			continue
 		}
 
-		if o.ShouldFetch {
-			fmt.Printf("fetching %v\n", p.Name)
-			git.Fetch()
+		fmt.Printf("fetching %v\n", p.Name)
+		if err := fetchLib(mirror, p); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: could not fetch %v: %v\n", p.Name, err)
+			didErr = true
 		}
+	}
+
+	if err := os.Chdir(curdir); err != nil {
+		return err
+	}
+
+	if didErr {
+		return fmt.Errorf("could not fetch some packages")
+	}
 
-		fmt.Printf("updating %v to %v\n", p.Name, p.Ref)
-		if err := git.Checkout(p.Ref); err != nil {
+	return nil
+}
+
+type updateLibOptions struct {
+	File        string
+	Mirror      func() (string, error)
+	ShouldFetch bool
+}
+
+func (o *updateLibOptions) updateLibs() error {
+	gopath := os.Getenv("GOPATH")
+	if gopath == "" {
+		return fmt.Errorf("GOPATH is not set")
+	}
+
+	libs, err := readLibraries(o.File)
+	if err != nil {
+		return err
+	}
+
+	curdir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	base, err := libraryFileDir(o.File)
+	if err != nil {
+		return err
+	}
+
+	var didErr bool
+	for _, p := range libs.Packages {
+		dir := path.Join(gopath, "src", p.Name)
+
+		var err error
+		switch p.SourceType() {
+		case SourceGit:
+			err = o.updateGit(dir, p)
+		case SourceArchive:
+			fmt.Printf("updating %v from %v\n", p.Name, p.URL)
+			err = updateArchive(dir, p.resolve(base))
+		case SourcePath:
+			fmt.Printf("updating %v to %v\n", p.Name, p.Path)
+			err = updatePath(dir, p.resolve(base))
+		default:
+			err = unknownSourceError(p)
+		}
+		if err != nil {
 			fmt.Fprintf(os.Stderr, "warning: could not update %v: %v\n", p.Name, err)
 			didErr = true
 		}
@@ -224,6 +535,29 @@ func (o *updateLibOptions) updateLibs() error {
 	return nil
 }
 
+// updateGit checks out the pinned ref of a git library. Libraries that are
+// not present in the GOPATH are skipped with a warning.
+func (o *updateLibOptions) updateGit(dir string, p Package) error {
+	if err := os.Chdir(dir); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: skipping %v: not in GOPATH (use `unigornel libs add`)\n", p.Name)
+		return nil
+	}
+
+	if o.ShouldFetch {
+		mirror, err := o.Mirror()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("fetching %v\n", p.Name)
+		if err := fetchLib(mirror, p); err != nil {
+			return fmt.Errorf("could not fetch: %v", err)
+		}
+	}
+
+	fmt.Printf("updating %v to %v\n", p.Name, p.Ref)
+	return git.Checkout(p.Ref)
+}
+
 func readLibraries(file string) (Libraries, error) {
 	var libs Libraries
 	b, err := ioutil.ReadFile(file)
@@ -235,5 +569,11 @@ func readLibraries(file string) (Libraries, error) {
 		return libs, err
 	}
 
+	for _, p := range libs.Packages {
+		if err := p.validate(); err != nil {
+			return libs, fmt.Errorf("%v: %v", file, err)
+		}
+	}
+
 	return libs, nil
 }
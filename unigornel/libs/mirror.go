@@ -0,0 +1,126 @@
+package libs
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/unigornel/unigornel/unigornel/git"
+	"github.com/urfave/cli"
+)
+
+func mirror() cli.Command {
+	return cli.Command{
+		Name:  "mirror",
+		Usage: "manage the offline library mirror",
+		Subcommands: []cli.Command{
+			{
+				Name:  "sync",
+				Usage: "clone or update the mirror of every library",
+				Action: func(ctx *cli.Context) error {
+					mirror, err := configuredMirror(ctx)()
+					if err != nil {
+						return cli.NewExitError("error: "+err.Error(), 1)
+					}
+					o := syncMirrorOptions{
+						File:   ctx.GlobalString(libraryFileFlagName),
+						Mirror: mirror,
+					}
+					if o.Mirror == "" {
+						return cli.NewExitError("error: no mirror directory set (use --mirror, UNIGORNEL_LIBS_MIRROR or mirror in the configuration)", 1)
+					}
+					if err := o.syncMirror(); err != nil {
+						return cli.NewExitError("error: "+err.Error(), 1)
+					}
+					return nil
+				},
+			},
+		},
+	}
+}
+
+// mirrorPath returns the path of the bare repository of a library in the
+// mirror.
+func mirrorPath(mirror, name string) string {
+	return path.Join(mirror, name+".git")
+}
+
+// originURL returns the URL of the upstream repository of a library.
+func originURL(name string) string {
+	return "https://" + name
+}
+
+// remoteURL returns the URL to clone a library from. This is the mirror if
+// one is set, or the origin otherwise.
+func remoteURL(mirror, name string) string {
+	if mirror != "" {
+		return mirrorPath(mirror, name)
+	}
+	return originURL(name)
+}
+
+// fetchLib fetches the library in the current directory from the mirror if
+// one is set, or from its configured remote otherwise.
+func fetchLib(mirror string, p Package) error {
+	if mirror == "" {
+		return git.Fetch()
+	}
+	return git.FetchFrom(mirrorPath(mirror, p.Name))
+}
+
+type syncMirrorOptions struct {
+	File   string
+	Mirror string
+}
+
+func (o *syncMirrorOptions) syncMirror() error {
+	libs, err := readLibraries(o.File)
+	if err != nil {
+		return err
+	}
+
+	curdir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	var didErr bool
+	for _, p := range libs.Packages {
+		if p.SourceType() != SourceGit {
+			continue
+		}
+
+		dir := mirrorPath(o.Mirror, p.Name)
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			fmt.Printf("cloning %v into %v\n", p.Name, dir)
+			err = git.CloneMirror(originURL(p.Name), dir)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "warning: could not mirror %v: %v\n", p.Name, err)
+				didErr = true
+			}
+			continue
+		}
+
+		if err := os.Chdir(dir); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: could not mirror %v: %v\n", p.Name, err)
+			didErr = true
+			continue
+		}
+
+		fmt.Printf("updating mirror of %v\n", p.Name)
+		if err := git.Fetch("--prune"); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: could not mirror %v: %v\n", p.Name, err)
+			didErr = true
+		}
+	}
+
+	if err := os.Chdir(curdir); err != nil {
+		return err
+	}
+
+	if didErr {
+		return fmt.Errorf("could not mirror some packages")
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package libs
+
+import (
+	"fmt"
+)
+
+// Pin copies the packages that provide the given import paths from one
+// libraries file to another, so that a new project builds against the same
+// revisions. Local paths are made absolute. Without import paths, the
+// libraries file is created without packages and from is not read.
+func Pin(from, to string, importPaths []string) error {
+	file, err := openLibraryFile(to)
+	if err != nil {
+		return err
+	}
+	if _, err := file.packages(); err != nil {
+		return err
+	}
+
+	if len(importPaths) > 0 {
+		if from == "" {
+			return fmt.Errorf("no libraries file to pin %v from", importPaths)
+		}
+
+		libs, err := readLibraries(from)
+		if err != nil {
+			return err
+		}
+		base, err := libraryFileDir(from)
+		if err != nil {
+			return err
+		}
+
+		for _, importPath := range importPaths {
+			p := pinnedPackage(libs, importPath)
+			if p == nil {
+				return fmt.Errorf("%v is not pinned in %v (use `unigornel libs add`)", importPath, from)
+			}
+			if err := file.Set(p.resolve(base)); err != nil {
+				return err
+			}
+		}
+	}
+	return file.Save()
+}
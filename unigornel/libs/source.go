@@ -0,0 +1,110 @@
+package libs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	SourceGit     = "git"
+	SourceArchive = "archive"
+	SourcePath    = "path"
+)
+
+// SourceType returns the type of the source of the package. Packages
+// without a type are git sources.
+func (lib Package) SourceType() string {
+	if lib.Type == "" {
+		return SourceGit
+	}
+	return lib.Type
+}
+
+func (lib Package) validate() error {
+	if lib.Name == "" {
+		return fmt.Errorf("package without a name")
+	}
+
+	switch lib.SourceType() {
+	case SourceGit:
+		if lib.Ref == "" {
+			return fmt.Errorf("%v: git source without a ref", lib.Name)
+		}
+	case SourceArchive:
+		if lib.URL == "" || lib.SHA256 == "" {
+			return fmt.Errorf("%v: archive source needs both a url and a sha256", lib.Name)
+		}
+	case SourcePath:
+		if lib.Path == "" {
+			return fmt.Errorf("%v: path source without a path", lib.Name)
+		}
+	default:
+		return unknownSourceError(lib)
+	}
+	return nil
+}
+
+// resolve makes the local paths of the package absolute. Relative paths are
+// relative to the directory of the libraries file.
+func (lib Package) resolve(base string) Package {
+	if lib.Path != "" && !filepath.IsAbs(lib.Path) {
+		lib.Path = filepath.Join(base, lib.Path)
+	}
+	if lib.URL != "" && !isRemoteURL(lib.URL) && !filepath.IsAbs(lib.URL) {
+		lib.URL = filepath.Join(base, lib.URL)
+	}
+	return lib
+}
+
+func unknownSourceError(lib Package) error {
+	return fmt.Errorf("%v: unknown source type '%v'", lib.Name, lib.Type)
+}
+
+func libraryFileDir(file string) (string, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Dir(abs), nil
+}
+
+// updatePath links the package in the GOPATH to its local directory.
+func updatePath(dir string, p Package) error {
+	info, err := os.Stat(p.Path)
+	if err != nil {
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("%v is not a directory", p.Path)
+	}
+
+	if ok, err := isLinkedTo(dir, p.Path); err != nil {
+		return err
+	} else if ok {
+		return nil
+	}
+
+	if _, err := os.Lstat(dir); err == nil {
+		return fmt.Errorf("%v already exists and is not a link to %v", dir, p.Path)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return err
+	}
+	return os.Symlink(p.Path, dir)
+}
+
+func isLinkedTo(dir, target string) (bool, error) {
+	resolved, err := filepath.EvalSymlinks(dir)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	wanted, err := filepath.EvalSymlinks(target)
+	if err != nil {
+		return false, err
+	}
+	return resolved == wanted, nil
+}
@@ -0,0 +1,81 @@
+package libs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		Package Package
+		Error   string
+	}{
+		{Package{Name: "a", Ref: "1234"}, ""},
+		{Package{Name: "a"}, "a: git source without a ref"},
+		{Package{Ref: "1234"}, "package without a name"},
+		{Package{Name: "a", Type: SourceArchive, URL: "a.tar.gz", SHA256: "abcd"}, ""},
+		{Package{Name: "a", Type: SourceArchive, URL: "a.tar.gz"}, "a: archive source needs both a url and a sha256"},
+		{Package{Name: "a", Type: SourceArchive, SHA256: "abcd"}, "a: archive source needs both a url and a sha256"},
+		{Package{Name: "a", Type: SourcePath, Path: "../a"}, ""},
+		{Package{Name: "a", Type: SourcePath}, "a: path source without a path"},
+		{Package{Name: "a", Type: "svn"}, "a: unknown source type 'svn'"},
+	}
+
+	for i, c := range cases {
+		err := c.Package.validate()
+		if c.Error == "" {
+			assert.Nil(t, err, "for test %d", i)
+		} else if assert.NotNil(t, err, "for test %d", i) {
+			assert.Equal(t, c.Error, err.Error(), "for test %d", i)
+		}
+	}
+}
+
+func TestUpdatePath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unigornel-path")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	target := filepath.Join(dir, "work", "lib")
+	other := filepath.Join(dir, "work", "other")
+	require.Nil(t, os.MkdirAll(target, 0755))
+	require.Nil(t, os.MkdirAll(other, 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "file"), nil, 0644))
+
+	lib := filepath.Join(dir, "src", "github.com", "a", "lib")
+	p := Package{Name: "github.com/a/lib", Type: SourcePath, Path: target}
+
+	// The library is linked, and linking it again does nothing.
+	assert.NotNil(t, verifyPath(lib, p))
+	assert.Nil(t, updatePath(lib, p))
+	assert.Nil(t, updatePath(lib, p))
+	assert.Nil(t, verifyPath(lib, p))
+	resolved, err := filepath.EvalSymlinks(lib)
+	assert.Nil(t, err)
+	wanted, err := filepath.EvalSymlinks(target)
+	assert.Nil(t, err)
+	assert.Equal(t, wanted, resolved)
+
+	// A link to another directory is not replaced.
+	moved := p
+	moved.Path = other
+	assert.NotNil(t, verifyPath(lib, moved))
+	if err := updatePath(lib, moved); assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "already exists and is not a link to")
+	}
+
+	// The path must be a directory.
+	missing := p
+	missing.Path = filepath.Join(dir, "missing")
+	assert.NotNil(t, updatePath(lib, missing))
+	notDir := p
+	notDir.Path = filepath.Join(dir, "file")
+	if err := updatePath(lib, notDir); assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "is not a directory")
+	}
+}
@@ -0,0 +1,135 @@
+package libs
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/unigornel/unigornel/unigornel/git"
+	"github.com/urfave/cli"
+)
+
+func verify() cli.Command {
+	return cli.Command{
+		Name:  "verify",
+		Usage: "verify that the libraries in the GOPATH match the libraries file",
+		Action: func(ctx *cli.Context) error {
+			o := verifyLibOptions{
+				File: ctx.GlobalString(libraryFileFlagName),
+			}
+			if err := o.verifyLibs(); err != nil {
+				return cli.NewExitError("error: "+err.Error(), 1)
+			}
+			return nil
+		},
+	}
+}
+
+type verifyLibOptions struct {
+	File string
+}
+
+func (o *verifyLibOptions) verifyLibs() error {
+	gopath := os.Getenv("GOPATH")
+	if gopath == "" {
+		return fmt.Errorf("GOPATH is not set")
+	}
+
+	libs, err := readLibraries(o.File)
+	if err != nil {
+		return err
+	}
+
+	base, err := libraryFileDir(o.File)
+	if err != nil {
+		return err
+	}
+
+	curdir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	var didErr bool
+	for _, p := range libs.Packages {
+		dir := path.Join(gopath, "src", p.Name)
+
+		var err error
+		switch p.SourceType() {
+		case SourceGit:
+			err = verifyGit(dir, p)
+		case SourceArchive:
+			err = verifyArchive(dir, p)
+		case SourcePath:
+			err = verifyPath(dir, p.resolve(base))
+		default:
+			err = unknownSourceError(p)
+		}
+
+		if err != nil {
+			fmt.Printf("FAIL %v: %v\n", p.Name, err)
+			didErr = true
+		} else {
+			fmt.Printf("ok   %v\n", p.Name)
+		}
+	}
+
+	if err := os.Chdir(curdir); err != nil {
+		return err
+	}
+
+	if didErr {
+		return fmt.Errorf("some packages do not match %v", o.File)
+	}
+
+	return nil
+}
+
+func verifyGit(dir string, p Package) error {
+	if err := os.Chdir(dir); err != nil {
+		return fmt.Errorf("not present in GOPATH")
+	}
+
+	ref, err := git.ShowRef()
+	if err != nil {
+		return err
+	}
+	if ref != p.Ref {
+		return fmt.Errorf("checked out at %v, pinned at %v", ref, p.Ref)
+	}
+	return nil
+}
+
+// verifyArchive checks that dir was extracted from the pinned archive and
+// that its files were not changed since.
+func verifyArchive(dir string, p Package) error {
+	sum, tree, err := readArchiveStamp(dir)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("not extracted from an archive")
+	} else if err != nil {
+		return err
+	}
+	if !strings.EqualFold(sum, p.SHA256) {
+		return fmt.Errorf("extracted archive has sha256 %v, pinned at %v", sum, p.SHA256)
+	}
+
+	current, err := treeHash(dir)
+	if err != nil {
+		return err
+	}
+	if current != tree {
+		return fmt.Errorf("files were changed after the archive was extracted")
+	}
+	return nil
+}
+
+func verifyPath(dir string, p Package) error {
+	ok, err := isLinkedTo(dir, p.Path)
+	if err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("not linked to %v", p.Path)
+	}
+	return nil
+}
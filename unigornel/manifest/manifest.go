@@ -0,0 +1,109 @@
+// Package manifest reads and writes the manifest of a unikernel project.
+package manifest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/unigornel/unigornel/settings"
+	"gopkg.in/yaml.v2"
+)
+
+// FileName is the name of the manifest in the root of a project.
+const FileName = "unikernel.yaml"
+
+// Manifest describes how to build a unikernel project.
+type Manifest struct {
+	// Name is the name of the unikernel. It is the default output file
+	// of `unigornel build`.
+	Name string `yaml:"name"`
+
+	// LDFlags are passed to go build before the -ldflags given on the
+	// command line.
+	LDFlags string `yaml:"ldflags,omitempty"`
+
+	// Settings declares the settings that can be given with `unigornel
+	// build --set` and read with the settings package.
+	Settings map[string]settings.Setting `yaml:"settings,omitempty"`
+}
+
+// Read reads a manifest file. Unknown keys are an error.
+func Read(file string) (Manifest, error) {
+	var m Manifest
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return m, err
+	}
+
+	if err := yaml.UnmarshalStrict(data, &m); err != nil {
+		return m, fmt.Errorf("%v: %v", file, err)
+	}
+	if err := m.Validate(); err != nil {
+		return m, fmt.Errorf("%v: %v", file, err)
+	}
+	return m, nil
+}
+
+// Validate checks the settings declared in the manifest.
+func (m Manifest) Validate() error {
+	for _, key := range m.SettingNames() {
+		s := m.Settings[key]
+		if err := settings.ValidateKey(key); err != nil {
+			return err
+		}
+		if err := s.Validate(); err != nil {
+			return fmt.Errorf("settings.%v: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// CheckArgs checks the KEY=VALUE arguments of the kernel command line
+// against the settings declared in the manifest. Other arguments and
+// undeclared settings are not checked.
+func (m Manifest) CheckArgs(args []string) error {
+	for _, a := range args {
+		parts := strings.SplitN(a, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if s, ok := m.Settings[parts[0]]; ok {
+			if err := s.Type.Check(parts[1]); err != nil {
+				return fmt.Errorf("%v: %v", parts[0], err)
+			}
+		}
+	}
+	return nil
+}
+
+// ReadDir reads the manifest in dir. It returns false if there is none.
+func ReadDir(dir string) (Manifest, bool, error) {
+	m, err := Read(filepath.Join(dir, FileName))
+	if os.IsNotExist(err) {
+		return m, false, nil
+	}
+	return m, err == nil, err
+}
+
+// Write writes a manifest file.
+func Write(file string, m Manifest) error {
+	data, err := yaml.Marshal(&m)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0644)
+}
+
+// SettingNames returns the sorted names of the declared settings.
+func (m Manifest) SettingNames() []string {
+	names := make([]string, 0, len(m.Settings))
+	for name := range m.Settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
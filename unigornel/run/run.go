@@ -0,0 +1,178 @@
+// Package run starts unikernels with xl.
+package run
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/unigornel/unigornel/unigornel/exec"
+	"github.com/unigornel/unigornel/unigornel/manifest"
+	"github.com/unigornel/unigornel/unigornel/xl"
+	"github.com/urfave/cli"
+)
+
+const (
+	memoryFlagName = "memory"
+	nameFlagName   = "name"
+	vifFlagName    = "vif"
+	dryRunFlagName = "dry-run"
+)
+
+// Run is the `run` command.
+func Run() cli.Command {
+	return cli.Command{
+		Name:      "run",
+		Usage:     "run a unikernel with xl and attach to its console",
+		ArgsUsage: "[KERNEL] [-- ARGS...]",
+		Description: `Creates a Xen domain for the unikernel and attaches to its console. The
+   KERNEL defaults to the name in the ` + manifest.FileName + ` of the working directory.
+
+   The ARGS are the kernel command line. KEY=VALUE arguments override the
+   settings of the unikernel, and are checked against the settings declared
+   in the manifest.`,
+		Flags: []cli.Flag{
+			cli.IntFlag{
+				Name:  memoryFlagName + ", m",
+				Value: 32,
+				Usage: "memory of the domain in MiB",
+			},
+			cli.StringFlag{
+				Name:  nameFlagName,
+				Usage: "name of the domain (default: the name of the kernel)",
+			},
+			cli.StringSliceFlag{
+				Name:  vifFlagName,
+				Usage: "add a network interface, e.g. bridge=xenbr0 (can be repeated)",
+			},
+			cli.BoolFlag{
+				Name:  dryRunFlagName + ", n",
+				Usage: "print the xl configuration instead of running",
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			o := runOptions{
+				Memory: ctx.Int(memoryFlagName),
+				Name:   ctx.String(nameFlagName),
+				VIFs:   ctx.StringSlice(vifFlagName),
+				DryRun: ctx.Bool(dryRunFlagName),
+			}
+			o.Kernel, o.Args = splitArgs(ctx.Args(), os.Args)
+
+			if err := o.run(); err != nil {
+				return cli.NewExitError("error: "+err.Error(), 1)
+			}
+			return nil
+		},
+	}
+}
+
+// splitArgs splits the arguments into the kernel and the kernel arguments.
+// The flag parser drops the "--" that separates them, so the kernel
+// arguments are counted in the raw command line.
+func splitArgs(args, raw []string) (string, []string) {
+	for i, a := range args {
+		if a == "--" {
+			args = append(args[:i:i], args[i+1:]...)
+			break
+		}
+	}
+
+	n := len(args)
+	for i, a := range raw {
+		if a == "--" {
+			n = len(args) - len(raw[i+1:])
+			break
+		}
+	}
+	if n > 1 {
+		n = 1
+	} else if n < 0 {
+		n = 0
+	}
+
+	var kernel string
+	if n == 1 {
+		kernel = args[0]
+	}
+	return kernel, args[n:]
+}
+
+type runOptions struct {
+	Kernel string
+	Args   []string
+	Memory int
+	Name   string
+	VIFs   []string
+	DryRun bool
+}
+
+func (o *runOptions) run() error {
+	m, ok, err := manifest.ReadDir(".")
+	if err != nil {
+		return err
+	}
+	if o.Kernel == "" {
+		if !ok {
+			return fmt.Errorf("no kernel given and no %v in the working directory", manifest.FileName)
+		}
+		o.Kernel = m.Name
+	}
+	if err := m.CheckArgs(o.Args); err != nil {
+		return err
+	}
+
+	binary, err := filepath.Abs(o.Kernel)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(binary); err != nil {
+		return err
+	}
+
+	extra, err := xl.JoinArgs(o.Args)
+	if err != nil {
+		return err
+	}
+
+	kernel := xl.Kernel{
+		Binary: binary,
+		Memory: o.Memory,
+		Name:   o.Name,
+		Extra:  extra,
+	}
+	if kernel.Name == "" {
+		kernel.Name = filepath.Base(binary)
+	}
+	for _, spec := range o.VIFs {
+		v, err := xl.ParseVIF(spec)
+		if err != nil {
+			return fmt.Errorf("--%v %v: %v", vifFlagName, spec, err)
+		}
+		kernel.VIFs = append(kernel.VIFs, v)
+	}
+	if err := kernel.Validate(); err != nil {
+		return err
+	}
+
+	if o.DryRun {
+		return kernel.WriteConfiguration(os.Stdout)
+	}
+
+	fh, err := ioutil.TempFile("", "unigornel-run-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(fh.Name())
+	if err := kernel.WriteConfiguration(fh); err != nil {
+		fh.Close()
+		return err
+	}
+	if err := fh.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("[+] running %v as domain %v\n", o.Kernel, kernel.Name)
+	return exec.InTerminal("xl", "create", "-c", "-f", fh.Name()).Run()
+}
@@ -0,0 +1,29 @@
+package run
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitArgs(t *testing.T) {
+	cases := []struct {
+		Args   []string
+		Raw    []string
+		Kernel string
+		Kargs  []string
+	}{
+		{[]string{"k"}, []string{"unigornel", "run", "k"}, "k", []string{}},
+		{[]string{"k", "a=1"}, []string{"unigornel", "run", "k", "--", "a=1"}, "k", []string{"a=1"}},
+		{[]string{"k", "--", "a=1"}, []string{"unigornel", "run", "k", "--", "a=1"}, "k", []string{"a=1"}},
+		{[]string{"a=1", "b"}, []string{"unigornel", "run", "-m", "64", "--", "a=1", "b"}, "", []string{"a=1", "b"}},
+		{[]string{}, []string{"unigornel", "run"}, "", []string{}},
+		{[]string{"k", "a"}, []string{"unigornel", "run", "k", "a"}, "k", []string{"a"}},
+	}
+
+	for i, c := range cases {
+		kernel, args := splitArgs(c.Args, c.Raw)
+		assert.Equal(t, c.Kernel, kernel, "for test %d", i)
+		assert.Equal(t, c.Kargs, args, "for test %d", i)
+	}
+}
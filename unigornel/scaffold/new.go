@@ -0,0 +1,346 @@
+// Package scaffold creates new unikernel projects from templates.
+package scaffold
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/unigornel/unigornel/settings"
+	"github.com/unigornel/unigornel/unigornel/config"
+	"github.com/unigornel/unigornel/unigornel/env"
+	"github.com/unigornel/unigornel/unigornel/libs"
+	"github.com/unigornel/unigornel/unigornel/manifest"
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	templateFlagName = "template"
+	listFlagName     = "list"
+
+	defaultTemplate = "hello"
+
+	// templateManifest is the optional file in a template directory that
+	// describes the template. It is not copied to the project.
+	templateManifest = "template.yaml"
+
+	// templateSuffix marks the files in a template directory that are
+	// executed as text/template. Other files are copied as-is.
+	templateSuffix = ".tmpl"
+)
+
+// New is the `new` command.
+func New() cli.Command {
+	return cli.Command{
+		Name:      "new",
+		Usage:     "create a unikernel project from a template",
+		ArgsUsage: "DIR",
+		Description: `Creates DIR with the source of the template, a ` + manifest.FileName + ` manifest,
+   a libraries.yaml that pins the libraries of the template to the revisions
+   in the configured libraries file, and a ` + config.ProjectConfigName + ` that selects
+   that libraries file.
+
+   Besides the built-in templates, every subdirectory of the directory set
+   with 'unigornel config set templates DIR' is a template. Files ending in
+   ` + templateSuffix + ` are executed as Go templates with {{.Name}} set to the name
+   of the project. An optional ` + templateManifest + ` holds the description and
+   the import paths of the libraries to pin, and the settings to declare in
+   the manifest:
+
+     description: my template
+     libraries:
+     - github.com/unigornel/go-tcpip
+     settings:
+       ip_address:
+         type: ipv4
+         default: 10.0.100.2`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  templateFlagName + ", t",
+				Value: defaultTemplate,
+				Usage: "name of the template",
+			},
+			cli.BoolFlag{
+				Name:  listFlagName,
+				Usage: "list the templates",
+			},
+			env.ToolchainFlag(),
+		},
+		Action: func(ctx *cli.Context) error {
+			c, err := env.GetToolchain(env.ConfigFile(ctx), env.ToolchainName(ctx))
+			if err != nil {
+				return cli.NewExitError("error: "+err.Error(), 1)
+			}
+
+			if ctx.Bool(listFlagName) {
+				if err := listTemplates(c.Templates); err != nil {
+					return cli.NewExitError("error: "+err.Error(), 1)
+				}
+				return nil
+			}
+
+			if ctx.NArg() != 1 {
+				cli.ShowSubcommandHelp(ctx)
+				return cli.NewExitError("error: subcommand expects one argument", 1)
+			}
+
+			o := newOptions{
+				Dir:       ctx.Args()[0],
+				Template:  ctx.String(templateFlagName),
+				Templates: c.Templates,
+				Libraries: c.Libraries,
+			}
+			if err := o.newProject(); err != nil {
+				return cli.NewExitError("error: "+err.Error(), 1)
+			}
+			return nil
+		},
+	}
+}
+
+// Template is a project template.
+type Template struct {
+	Name        string            `yaml:"-"`
+	Description string            `yaml:"description"`
+	Libraries   []string          `yaml:"libraries"`
+	Files       map[string]string `yaml:"-"`
+
+	// Settings are declared in the manifest of the project.
+	Settings map[string]settings.Setting `yaml:"settings"`
+
+	// Raw are files that are copied without executing them.
+	Raw map[string][]byte `yaml:"-"`
+}
+
+type templateData struct {
+	Name string
+}
+
+// readTemplate reads a template directory.
+func readTemplate(dir string) (Template, error) {
+	t := Template{
+		Name:  filepath.Base(dir),
+		Files: make(map[string]string),
+		Raw:   make(map[string][]byte),
+	}
+
+	if data, err := ioutil.ReadFile(filepath.Join(dir, templateManifest)); err == nil {
+		if err := yaml.UnmarshalStrict(data, &t); err != nil {
+			return t, fmt.Errorf("%v: %v", templateManifest, err)
+		}
+		if err := (manifest.Manifest{Settings: t.Settings}).Validate(); err != nil {
+			return t, fmt.Errorf("%v: %v", templateManifest, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return t, err
+	}
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if rel == templateManifest {
+			return nil
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		rel = filepath.ToSlash(rel)
+		if strings.HasSuffix(rel, templateSuffix) {
+			t.Files[strings.TrimSuffix(rel, templateSuffix)] = string(data)
+		} else {
+			t.Raw[rel] = data
+		}
+		return nil
+	})
+	return t, err
+}
+
+// findTemplate returns the template with the given name. The templates
+// directory takes precedence over the built-in templates.
+func findTemplate(templates, name string) (Template, error) {
+	if templates != "" {
+		dir := filepath.Join(templates, name)
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return readTemplate(dir)
+		}
+	}
+
+	for _, t := range builtinTemplates {
+		if t.Name == name {
+			return t, nil
+		}
+	}
+	return Template{}, fmt.Errorf("unknown template '%v' (see `unigornel new --list`)", name)
+}
+
+func allTemplates(templates string) ([]Template, error) {
+	byName := make(map[string]Template)
+	for _, t := range builtinTemplates {
+		byName[t.Name] = t
+	}
+
+	if templates != "" {
+		entries, err := ioutil.ReadDir(templates)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if !e.IsDir() {
+				continue
+			}
+			t, err := readTemplate(filepath.Join(templates, e.Name()))
+			if err != nil {
+				return nil, fmt.Errorf("template %v: %v", e.Name(), err)
+			}
+			byName[t.Name] = t
+		}
+	}
+
+	var names []string
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var all []Template
+	for _, name := range names {
+		all = append(all, byName[name])
+	}
+	return all, nil
+}
+
+func listTemplates(templates string) error {
+	all, err := allTemplates(templates)
+	if err != nil {
+		return err
+	}
+	for _, t := range all {
+		fmt.Printf("%-12v %v\n", t.Name, t.Description)
+	}
+	return nil
+}
+
+type newOptions struct {
+	Dir       string
+	Template  string
+	Templates string
+	Libraries string
+}
+
+func (o *newOptions) newProject() error {
+	t, err := findTemplate(o.Templates, o.Template)
+	if err != nil {
+		return err
+	}
+
+	if entries, err := ioutil.ReadDir(o.Dir); err == nil && len(entries) > 0 {
+		return fmt.Errorf("%v exists and is not empty", o.Dir)
+	}
+
+	dir, err := filepath.Abs(o.Dir)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stat(dir)
+	created := os.IsNotExist(err)
+
+	fmt.Printf("[+] creating %v from template %v\n", o.Dir, t.Name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if err := o.generate(dir, t); err != nil {
+		// Do not leave a half-created project behind. A directory that
+		// existed was empty, so only its contents are ours.
+		fmt.Println("[-] removing", o.Dir)
+		if created {
+			os.RemoveAll(dir)
+		} else if entries, rerr := ioutil.ReadDir(dir); rerr == nil {
+			for _, e := range entries {
+				os.RemoveAll(filepath.Join(dir, e.Name()))
+			}
+		}
+		return err
+	}
+
+	fmt.Printf("[+] run `cd %v && unigornel libs update && unigornel build` to build the unikernel\n", o.Dir)
+	return nil
+}
+
+// generate writes the files of the project to dir.
+func (o *newOptions) generate(dir string, t Template) error {
+	data := templateData{Name: filepath.Base(dir)}
+	if err := writeFiles(dir, t, data); err != nil {
+		return err
+	}
+
+	fmt.Println("[+] writing", manifest.FileName)
+	m := manifest.Manifest{
+		Name:     data.Name,
+		Settings: t.Settings,
+	}
+	if err := manifest.Write(filepath.Join(dir, manifest.FileName), m); err != nil {
+		return err
+	}
+
+	fmt.Println("[+] pinning libraries")
+	if err := libs.Pin(o.Libraries, filepath.Join(dir, "libraries.yaml"), t.Libraries); err != nil {
+		return err
+	}
+
+	fmt.Println("[+] writing", config.ProjectConfigName)
+	project := config.Config{Libraries: "libraries.yaml"}
+	return config.WriteConfig(filepath.Join(dir, config.ProjectConfigName), project)
+}
+
+func writeFiles(dir string, t Template, data templateData) error {
+	files := make(map[string][]byte)
+	for name, content := range t.Raw {
+		files[name] = content
+	}
+	for name, content := range t.Files {
+		tmpl, err := template.New(name).Parse(content)
+		if err != nil {
+			return fmt.Errorf("template %v: %v", t.Name, err)
+		}
+
+		var b bytes.Buffer
+		if err := tmpl.Execute(&b, data); err != nil {
+			return fmt.Errorf("template %v: %v", t.Name, err)
+		}
+		files[name] = b.Bytes()
+	}
+
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+		fmt.Println("[+] writing", name)
+		if err := ioutil.WriteFile(file, files[name], 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
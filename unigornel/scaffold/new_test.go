@@ -0,0 +1,126 @@
+package scaffold
+
+import (
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuiltinTemplatesParse(t *testing.T) {
+	for _, tmpl := range builtinTemplates {
+		dir, err := ioutil.TempDir("", "unigornel-new")
+		require.Nil(t, err)
+		defer os.RemoveAll(dir)
+
+		require.Nil(t, writeFiles(dir, tmpl, templateData{Name: "project"}), "for %v", tmpl.Name)
+
+		for name := range tmpl.Files {
+			_, err := parser.ParseFile(token.NewFileSet(), filepath.Join(dir, name), nil, 0)
+			assert.Nil(t, err, "for %v/%v", tmpl.Name, name)
+		}
+	}
+}
+
+func TestReadTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unigornel-template")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"template.yaml":    "description: custom\nlibraries:\n- example.com/lib\n",
+		"main.go.tmpl":     "package main // {{.Name}}\n",
+		"data/raw.txt":     "{{.Name}}\n",
+		"data/nested.tmpl": "{{.Name}}\n",
+	}
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		require.Nil(t, os.MkdirAll(filepath.Dir(file), 0755))
+		require.Nil(t, ioutil.WriteFile(file, []byte(content), 0644))
+	}
+
+	tmpl, err := readTemplate(dir)
+	require.Nil(t, err)
+	assert.Equal(t, "custom", tmpl.Description)
+	assert.Equal(t, []string{"example.com/lib"}, tmpl.Libraries)
+
+	out, err := ioutil.TempDir("", "unigornel-new")
+	require.Nil(t, err)
+	defer os.RemoveAll(out)
+	require.Nil(t, writeFiles(out, tmpl, templateData{Name: "project"}))
+
+	expected := map[string]string{
+		"main.go":      "package main // project\n",
+		"data/raw.txt": "{{.Name}}\n",
+		"data/nested":  "project\n",
+	}
+	for name, content := range expected {
+		data, err := ioutil.ReadFile(filepath.Join(out, name))
+		require.Nil(t, err, "for %v", name)
+		assert.Equal(t, content, string(data), "for %v", name)
+	}
+	_, err = os.Stat(filepath.Join(out, "template.yaml"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestNewProject(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unigornel-new")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	project := filepath.Join(dir, "hello")
+	o := newOptions{Dir: project, Template: "hello"}
+	require.Nil(t, o.newProject())
+
+	expected := map[string]string{
+		"unikernel.yaml":  "name: hello\n",
+		"libraries.yaml":  "packages: []\n",
+		".unigornel.yaml": "version: 1\nlibraries: libraries.yaml\n",
+	}
+	for name, content := range expected {
+		data, err := ioutil.ReadFile(filepath.Join(project, name))
+		if assert.Nil(t, err, "for %v", name) {
+			assert.Equal(t, content, string(data), "for %v", name)
+		}
+	}
+
+	main, err := ioutil.ReadFile(filepath.Join(project, "main.go"))
+	require.Nil(t, err)
+	assert.Contains(t, string(main), "Hello from hello!")
+
+	entries, err := ioutil.ReadDir(project)
+	require.Nil(t, err)
+	assert.Len(t, entries, 4)
+
+	// A directory that is not empty is left alone.
+	assert.NotNil(t, o.newProject())
+	_, err = os.Stat(filepath.Join(project, "main.go"))
+	assert.Nil(t, err)
+}
+
+func TestNewProjectCleanup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unigornel-new")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// The network template pins libraries, which fails without a
+	// libraries file.
+	created := filepath.Join(dir, "created")
+	o := newOptions{Dir: created, Template: "network"}
+	assert.NotNil(t, o.newProject())
+	_, err = os.Stat(created)
+	assert.True(t, os.IsNotExist(err))
+
+	existing := filepath.Join(dir, "existing")
+	require.Nil(t, os.Mkdir(existing, 0755))
+	o = newOptions{Dir: existing, Template: "network"}
+	assert.NotNil(t, o.newProject())
+	entries, err := ioutil.ReadDir(existing)
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,92 @@
+package scaffold
+
+import "github.com/unigornel/unigornel/settings"
+
+// builtinTemplates are the templates that ship with unigornel. The files
+// are text/template sources that are executed with templateData. They use
+// a plain main function, for which `unigornel build` exports Main.
+var builtinTemplates = []Template{
+	{
+		Name:        "hello",
+		Description: "print a message and exit",
+		Files: map[string]string{
+			"main.go": `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println("Hello from {{.Name}}!")
+}
+`,
+		},
+	},
+	{
+		Name:        "console",
+		Description: "read lines from the console and echo them",
+		Files: map[string]string{
+			"main.go": `package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+)
+
+func main() {
+	fmt.Println("{{.Name}} is ready")
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		fmt.Println(scanner.Text())
+	}
+}
+`,
+		},
+	},
+	{
+		Name:        "network",
+		Description: "configure IPv4 and reply to ping",
+		Libraries:   []string{"github.com/unigornel/go-tcpip"},
+		Files: map[string]string{
+			"main.go": `package main
+
+import (
+	"fmt"
+
+	"github.com/unigornel/go-tcpip/ethernet"
+	"github.com/unigornel/go-tcpip/icmp"
+	"github.com/unigornel/go-tcpip/ipv4"
+	"github.com/unigornel/unigornel/settings"
+)
+
+func main() {
+	address := ipv4.Address(settings.IPv4("ip_address"))
+	netmask := ipv4.Address(settings.IPv4("ip_netmask"))
+
+	var gateway *ipv4.Address
+	if settings.IsSet("ip_gateway") {
+		g := ipv4.Address(settings.IPv4("ip_gateway"))
+		gateway = &g
+	}
+
+	nic := ethernet.NewNIC()
+	eth := ethernet.NewLayer(nic)
+	arp := ipv4.NewARP(nic.GetMAC(), address, eth)
+	router := ipv4.NewRouter(arp, address, netmask, gateway)
+	ip := ipv4.NewLayer(address, router, eth)
+	icmp.NewLayer(ip)
+
+	nic.Start()
+
+	fmt.Printf("[+] {{.Name}} is listening on %v\n", settings.String("ip_address"))
+	select {}
+}
+`,
+		},
+		Settings: map[string]settings.Setting{
+			"ip_address": {Type: settings.TypeIPv4, Default: "10.0.100.2"},
+			"ip_netmask": {Type: settings.TypeIPv4, Default: "255.255.255.0"},
+			"ip_gateway": {Type: settings.TypeIPv4},
+		},
+	},
+}
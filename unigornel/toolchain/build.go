@@ -0,0 +1,88 @@
+package toolchain
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/unigornel/unigornel/unigornel/env"
+	"github.com/unigornel/unigornel/unigornel/exec"
+	"github.com/urfave/cli"
+)
+
+const (
+	noCleanFlagName = "no-clean"
+)
+
+func noCleanFlag() cli.Flag {
+	return cli.BoolFlag{
+		Name:  noCleanFlagName,
+		Usage: "do not clean the previous build (passed to make.bash)",
+	}
+}
+
+func buildCommand() cli.Command {
+	return cli.Command{
+		Name:  "build",
+		Usage: "build the Go fork for GOOS=unigornel",
+		Flags: []cli.Flag{
+			noCleanFlag(),
+		},
+		Action: func(ctx *cli.Context) error {
+			root, err := absRoot(ctx)
+			if err != nil {
+				return cli.NewExitError("error: "+err.Error(), 1)
+			}
+
+			options := BuildOptions{
+				GoRoot:  filepath.Join(root, GoSubmodule),
+				NoClean: ctx.Bool(noCleanFlagName),
+			}
+
+			if name := env.ToolchainName(ctx); name != "" {
+				c, err := env.GetConfig(env.ConfigFile(ctx))
+				if err == nil {
+					_, err = c.Toolchain(name)
+				}
+				if err != nil {
+					return cli.NewExitError("error: "+err.Error(), 1)
+				}
+
+				// The named toolchain would inherit the top-level goroot,
+				// which is not the Go fork of this toolchain.
+				t := c.Toolchains[name]
+				if t.GoRoot == "" {
+					return cli.NewExitError("error: toolchain "+name+" has no goroot", 1)
+				}
+				options.GoRoot = t.GoRoot
+			}
+
+			if err := buildGo(options); err != nil {
+				return cli.NewExitError("error: "+err.Error(), 1)
+			}
+			return nil
+		},
+	}
+}
+
+type BuildOptions struct {
+	GoRoot  string
+	NoClean bool
+}
+
+func buildGo(options BuildOptions) error {
+	if os.Getenv("GOROOT_BOOTSTRAP") == "" {
+		fmt.Println("[*] warning: GOROOT_BOOTSTRAP is not set")
+	}
+
+	fmt.Println("[+] building go in", options.GoRoot)
+	args := []string{}
+	if options.NoClean {
+		args = append(args, "--no-clean")
+	}
+
+	cmd := exec.InTerminal("./make.bash", args...)
+	cmd.Dir = filepath.Join(options.GoRoot, "src")
+	cmd.Env = append(os.Environ(), "GOOS=unigornel", "GOARCH=amd64")
+	return cmd.Run()
+}
@@ -0,0 +1,140 @@
+package toolchain
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/unigornel/unigornel/unigornel/git"
+	"github.com/urfave/cli"
+)
+
+const (
+	remoteFlagName = "remote"
+	dryRunFlagName = "dry-run"
+)
+
+func remoteFlag() cli.Flag {
+	return cli.BoolFlag{
+		Name:  remoteFlagName,
+		Usage: "first update the submodules to their remote branches",
+	}
+}
+
+func dryRunFlag() cli.Flag {
+	return cli.BoolFlag{
+		Name:  dryRunFlagName + ", n",
+		Usage: "print the commit message without committing",
+	}
+}
+
+func bumpCommand() cli.Command {
+	return cli.Command{
+		Name:  "bump",
+		Usage: "commit the checked out submodule revisions with a changelog",
+		Flags: []cli.Flag{
+			remoteFlag(),
+			dryRunFlag(),
+		},
+		Action: func(ctx *cli.Context) error {
+			root, err := absRoot(ctx)
+			if err != nil {
+				return cli.NewExitError("error: "+err.Error(), 1)
+			}
+
+			options := bumpOptions{
+				Root:   root,
+				Remote: ctx.Bool(remoteFlagName),
+				DryRun: ctx.Bool(dryRunFlagName),
+			}
+			if err := options.bump(); err != nil {
+				return cli.NewExitError("error: "+err.Error(), 1)
+			}
+			return nil
+		},
+	}
+}
+
+type bumpOptions struct {
+	Root   string
+	Remote bool
+	DryRun bool
+}
+
+func (o *bumpOptions) bump() error {
+	curdir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	defer os.Chdir(curdir)
+
+	if err := os.Chdir(o.Root); err != nil {
+		return err
+	}
+
+	// A dry run does not write to the repository: the message describes
+	// the submodules as they are checked out.
+	if o.Remote && o.DryRun {
+		fmt.Println("[*] dry run: not updating submodules to their remote branches")
+	} else if o.Remote {
+		fmt.Println("[+] updating submodules to their remote branches")
+		if err := git.UpdateSubmodulesRemote(submodules...); err != nil {
+			return err
+		}
+	}
+
+	if !o.DryRun {
+		if err := git.Reset(submodules...); err != nil {
+			return err
+		}
+	}
+
+	var changed []submoduleState
+	for _, path := range submodules {
+		state, err := readSubmodule(path)
+		if err != nil {
+			return err
+		}
+		if state.Changed() {
+			changed = append(changed, state)
+		}
+	}
+
+	if len(changed) == 0 {
+		return fmt.Errorf("no changes in submodules")
+	}
+
+	message := bytes.NewBuffer(nil)
+	if err := writeCommitMessage(message, changed); err != nil {
+		return err
+	}
+
+	if o.DryRun {
+		fmt.Print(message.String())
+		return nil
+	}
+
+	if err := git.Add(submodules...); err != nil {
+		return err
+	}
+	return git.Commit(message.String())
+}
+
+func writeCommitMessage(w io.Writer, changed []submoduleState) error {
+	fmt.Fprintln(w, "Update submodules")
+	fmt.Fprintln(w)
+	for _, state := range changed {
+		changes, err := state.changes()
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "Changes in %v:\n", state.Path)
+		for _, c := range changes {
+			fmt.Fprintln(w, c)
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
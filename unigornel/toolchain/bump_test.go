@@ -0,0 +1,110 @@
+package toolchain
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var gitIdentity = map[string]string{
+	"GIT_AUTHOR_NAME":     "test",
+	"GIT_AUTHOR_EMAIL":    "test@example.com",
+	"GIT_COMMITTER_NAME":  "test",
+	"GIT_COMMITTER_EMAIL": "test@example.com",
+}
+
+func runGit(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	require.Nil(t, err, "git %v: %s", args, out)
+	return strings.TrimSpace(string(out))
+}
+
+// newSuperproject creates a repository with the go and minios submodules.
+func newSuperproject(t *testing.T, dir string) string {
+	for _, name := range submodules {
+		upstream := filepath.Join(dir, "upstream", name)
+		require.Nil(t, os.MkdirAll(upstream, 0755))
+		runGit(t, upstream, "init", "-q")
+		runGit(t, upstream, "commit", "-q", "--allow-empty", "-m", "Initial "+name)
+	}
+
+	super := filepath.Join(dir, "unigornel")
+	require.Nil(t, os.MkdirAll(super, 0755))
+	runGit(t, super, "init", "-q")
+	for _, name := range submodules {
+		upstream := filepath.Join(dir, "upstream", name)
+		runGit(t, super, "-c", "protocol.file.allow=always", "submodule", "add", "-q", upstream, name)
+	}
+	runGit(t, super, "commit", "-q", "-m", "Add submodules")
+	return super
+}
+
+func TestBump(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unigornel-bump")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	for k, v := range gitIdentity {
+		defer os.Setenv(k, os.Getenv(k))
+		os.Setenv(k, v)
+	}
+	super := newSuperproject(t, dir)
+	head := runGit(t, super, "rev-parse", "HEAD")
+
+	// Without changes there is nothing to commit.
+	o := bumpOptions{Root: super}
+	if err := o.bump(); assert.NotNil(t, err) {
+		assert.Equal(t, "no changes in submodules", err.Error())
+	}
+
+	runGit(t, filepath.Join(super, GoSubmodule), "commit", "-q", "--allow-empty", "-m", "Fix the scheduler")
+	runGit(t, super, "add", GoSubmodule)
+
+	// A dry run leaves the index and HEAD alone.
+	o = bumpOptions{Root: super, DryRun: true}
+	assert.Nil(t, o.bump())
+	assert.Equal(t, GoSubmodule, runGit(t, super, "diff", "--cached", "--name-only"))
+	assert.Equal(t, head, runGit(t, super, "rev-parse", "HEAD"))
+
+	o = bumpOptions{Root: super}
+	assert.Nil(t, o.bump())
+	assert.Equal(t, "", runGit(t, super, "diff", "--cached", "--name-only"))
+	message := runGit(t, super, "log", "-1", "--format=%B")
+	assert.True(t, strings.HasPrefix(message, "Update submodules\n\nChanges in go:\n"), message)
+	assert.Contains(t, message, "Fix the scheduler")
+	assert.NotContains(t, message, "Changes in minios")
+}
+
+func TestBuildGo(t *testing.T) {
+	goroot, err := ioutil.TempDir("", "unigornel-goroot")
+	require.Nil(t, err)
+	defer os.RemoveAll(goroot)
+
+	log := filepath.Join(goroot, "log")
+	script := "#!/bin/sh\necho \"$GOOS $GOARCH $*\" > " + log + "\n"
+	require.Nil(t, os.MkdirAll(filepath.Join(goroot, "src"), 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(goroot, "src", "make.bash"), []byte(script), 0755))
+
+	cases := []struct {
+		Options  BuildOptions
+		Expected string
+	}{
+		{BuildOptions{GoRoot: goroot}, "unigornel amd64 \n"},
+		{BuildOptions{GoRoot: goroot, NoClean: true}, "unigornel amd64 --no-clean\n"},
+	}
+
+	for i, c := range cases {
+		assert.Nil(t, buildGo(c.Options), "for test %d", i)
+		out, err := ioutil.ReadFile(log)
+		assert.Nil(t, err, "for test %d", i)
+		assert.Equal(t, c.Expected, string(out), "for test %d", i)
+	}
+}
@@ -0,0 +1,86 @@
+package toolchain
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/unigornel/unigornel/unigornel/config"
+	"github.com/unigornel/unigornel/unigornel/env"
+	"github.com/urfave/cli"
+)
+
+func installCommand() cli.Command {
+	return cli.Command{
+		Name:  "install",
+		Usage: "write the configuration file for this toolchain",
+		Flags: []cli.Flag{
+			env.ConfigFlag(),
+		},
+		Action: func(ctx *cli.Context) error {
+			root, err := absRoot(ctx)
+			if err != nil {
+				return cli.NewExitError("error: "+err.Error(), 1)
+			}
+
+			file, err := env.ConfigPath(env.ConfigFile(ctx))
+			if err != nil {
+				return cli.NewExitError("error: "+err.Error(), 1)
+			}
+
+			name := env.ToolchainName(ctx)
+			if err := install(root, file, name); err != nil {
+				return cli.NewExitError("error: "+err.Error(), 1)
+			}
+			return nil
+		},
+	}
+}
+
+// install writes the toolchain in root to the configuration file. Without a
+// name, the goroot, minios and libraries of the file are replaced; with a
+// name, the toolchain is added as a named toolchain. The other settings in
+// the file are kept.
+func install(root, file, name string) error {
+	t := config.Toolchain{
+		GoRoot:    filepath.Join(root, GoSubmodule),
+		MiniOS:    filepath.Join(root, MiniOSSubmodule),
+		Libraries: filepath.Join(root, "libraries.yaml"),
+	}
+
+	f, err := config.OpenFile(file)
+	if err != nil {
+		return err
+	}
+	c, err := f.Config()
+	if err != nil {
+		return err
+	}
+
+	prefix := ""
+	if name != "" {
+		prefix = "toolchains." + name + "."
+		if c.Default == "" && c.GoRoot == "" {
+			if err := f.Set("default", name); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("[+] adding toolchain %v\n", name)
+	}
+
+	for _, kv := range []config.KeyValue{
+		{Key: "goroot", Value: t.GoRoot},
+		{Key: "minios", Value: t.MiniOS},
+		{Key: "libraries", Value: t.Libraries},
+	} {
+		if err := f.Set(prefix+kv.Key, kv.Value); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("[+] writing", file)
+	if err := f.Save(); err != nil {
+		return err
+	}
+	fmt.Println("[+] use `unigornel exec -- <command>` or `eval $(unigornel env)` to use the toolchain")
+	return nil
+}
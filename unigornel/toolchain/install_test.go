@@ -0,0 +1,98 @@
+package toolchain
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/unigornel/unigornel/unigornel/config"
+)
+
+func TestInstall(t *testing.T) {
+	type test struct {
+		Name     string
+		Existing *config.Config
+		Expected config.Config
+	}
+
+	installed := config.Toolchain{
+		GoRoot:    filepath.Join("/root", GoSubmodule),
+		MiniOS:    filepath.Join("/root", MiniOSSubmodule),
+		Libraries: filepath.Join("/root", "libraries.yaml"),
+	}
+	existing := config.Config{
+		GoRoot:     "/old/go",
+		MiniOS:     "/old/mini-os",
+		Libraries:  "/old/libraries.yaml",
+		Mirror:     "/mirror",
+		Default:    "stable",
+		Toolchains: map[string]config.Toolchain{"stable": {GoRoot: "/stable/go"}},
+	}
+
+	tests := []test{
+		{
+			Expected: config.Config{
+				Version:   config.CurrentVersion,
+				GoRoot:    installed.GoRoot,
+				MiniOS:    installed.MiniOS,
+				Libraries: installed.Libraries,
+			},
+		},
+		{
+			Existing: &existing,
+			Expected: config.Config{
+				Version:    config.CurrentVersion,
+				GoRoot:     installed.GoRoot,
+				MiniOS:     installed.MiniOS,
+				Libraries:  installed.Libraries,
+				Mirror:     "/mirror",
+				Default:    "stable",
+				Toolchains: map[string]config.Toolchain{"stable": {GoRoot: "/stable/go"}},
+			},
+		},
+		{
+			Name: "dev",
+			Expected: config.Config{
+				Version:    config.CurrentVersion,
+				Default:    "dev",
+				Toolchains: map[string]config.Toolchain{"dev": installed},
+			},
+		},
+		{
+			Name:     "dev",
+			Existing: &existing,
+			Expected: config.Config{
+				Version:   config.CurrentVersion,
+				GoRoot:    "/old/go",
+				MiniOS:    "/old/mini-os",
+				Libraries: "/old/libraries.yaml",
+				Mirror:    "/mirror",
+				Default:   "stable",
+				Toolchains: map[string]config.Toolchain{
+					"stable": {GoRoot: "/stable/go"},
+					"dev":    installed,
+				},
+			},
+		},
+	}
+
+	for i, test := range tests {
+		dir, err := ioutil.TempDir("", "unigornel-install")
+		if !assert.Nil(t, err, "for test %d", i) {
+			continue
+		}
+		file := filepath.Join(dir, "config.yaml")
+
+		if test.Existing != nil {
+			assert.Nil(t, config.WriteConfig(file, *test.Existing), "for test %d", i)
+		}
+		if assert.Nil(t, install("/root", file, test.Name), "for test %d", i) {
+			c, err := config.ReadConfig(file)
+			assert.Nil(t, err, "for test %d", i)
+			assert.Equal(t, test.Expected, c, "for test %d", i)
+		}
+		os.RemoveAll(dir)
+	}
+}
@@ -0,0 +1,72 @@
+package toolchain
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/unigornel/unigornel/unigornel/git"
+	"github.com/urfave/cli"
+)
+
+func statusCommand() cli.Command {
+	return cli.Command{
+		Name:  "status",
+		Usage: "show the submodule revisions and the state of the Go build",
+		Action: func(ctx *cli.Context) error {
+			root, err := absRoot(ctx)
+			if err != nil {
+				return cli.NewExitError("error: "+err.Error(), 1)
+			}
+
+			if err := status(root); err != nil {
+				return cli.NewExitError("error: "+err.Error(), 1)
+			}
+			return nil
+		},
+	}
+}
+
+func status(root string) error {
+	curdir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	defer os.Chdir(curdir)
+
+	if err := os.Chdir(root); err != nil {
+		return err
+	}
+
+	for _, path := range submodules {
+		state, err := readSubmodule(path)
+		if err != nil {
+			return err
+		}
+
+		if !state.Changed() {
+			fmt.Printf("%-8s %v (up to date)\n", path, git.ShortRef(state.Recorded))
+			continue
+		}
+
+		changes, err := state.changes()
+		if err != nil {
+			return err
+		}
+		fmt.Printf(
+			"%-8s %v -> %v (%d new commits)\n",
+			path, git.ShortRef(state.Recorded), git.ShortRef(state.Current), len(changes),
+		)
+	}
+
+	goBinary := filepath.Join(root, GoSubmodule, "bin", "go")
+	out, err := exec.Command(goBinary, "version").Output()
+	if err != nil {
+		fmt.Printf("%-8s not built (run `unigornel toolchain build`)\n", "build")
+	} else {
+		fmt.Printf("%-8s %v\n", "build", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
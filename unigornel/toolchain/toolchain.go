@@ -0,0 +1,108 @@
+package toolchain
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/unigornel/unigornel/unigornel/env"
+	"github.com/unigornel/unigornel/unigornel/git"
+	"github.com/urfave/cli"
+)
+
+const (
+	rootFlagName = "root"
+)
+
+// The submodules that make up the toolchain.
+const (
+	GoSubmodule     = "go"
+	MiniOSSubmodule = "minios"
+)
+
+var submodules = []string{GoSubmodule, MiniOSSubmodule}
+
+func rootFlag() cli.Flag {
+	return cli.StringFlag{
+		Name:  rootFlagName,
+		Usage: "path to the unigornel repository",
+		Value: ".",
+	}
+}
+
+// Toolchain is the `toolchain` command.
+func Toolchain() cli.Command {
+	return cli.Command{
+		Name:  "toolchain",
+		Usage: "build and update the Go fork and Mini-OS",
+		Flags: []cli.Flag{
+			rootFlag(),
+			env.ToolchainFlag(),
+		},
+		Subcommands: []cli.Command{
+			buildCommand(),
+			bumpCommand(),
+			statusCommand(),
+			installCommand(),
+		},
+	}
+}
+
+func absRoot(ctx *cli.Context) (string, error) {
+	return filepath.Abs(ctx.GlobalString(rootFlagName))
+}
+
+// submoduleState is the recorded and the checked out commit of a
+// submodule.
+type submoduleState struct {
+	Path     string
+	Recorded string
+	Current  string
+}
+
+func (s submoduleState) Changed() bool {
+	return s.Recorded != s.Current
+}
+
+// readSubmodule reads the state of a submodule of the repository in the
+// current directory.
+func readSubmodule(path string) (submoduleState, error) {
+	state := submoduleState{Path: path}
+
+	recorded, err := git.SubmoduleCommit(path)
+	if err != nil {
+		return state, err
+	}
+	state.Recorded = recorded
+
+	curdir, err := os.Getwd()
+	if err != nil {
+		return state, err
+	}
+	defer os.Chdir(curdir)
+
+	if err := os.Chdir(path); err != nil {
+		return state, err
+	}
+	current, err := git.ShowRef()
+	if err != nil {
+		return state, fmt.Errorf("%v: %v", path, err)
+	}
+	state.Current = current
+	return state, nil
+}
+
+// changes lists the commits between the recorded and the checked out commit
+// of the submodule.
+func (s submoduleState) changes() ([]string, error) {
+	curdir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	defer os.Chdir(curdir)
+
+	if err := os.Chdir(s.Path); err != nil {
+		return nil, err
+	}
+	return git.Changes(s.Recorded, s.Current)
+}
@@ -6,6 +6,9 @@ import (
 	"github.com/unigornel/unigornel/unigornel/build"
 	"github.com/unigornel/unigornel/unigornel/env"
 	"github.com/unigornel/unigornel/unigornel/libs"
+	"github.com/unigornel/unigornel/unigornel/run"
+	"github.com/unigornel/unigornel/unigornel/scaffold"
+	"github.com/unigornel/unigornel/unigornel/toolchain"
 	"github.com/urfave/cli"
 )
 
@@ -14,12 +17,23 @@ func app() *cli.App {
 	app.Name = "unigornel"
 	app.Usage = "build unikernels for Go"
 	app.HideVersion = true
+	app.Flags = []cli.Flag{
+		env.ConfigFlag(),
+		env.ToolchainFlag(),
+	}
+	app.Before = env.SaveGlobalFlags
 	app.Commands = []cli.Command{
 		env.Env(),
+		env.Config(),
+		env.Exec(),
+		env.Go(),
 		build.Build(),
 		build.CompileGo(),
 		build.CompileOS(),
+		run.Run(),
 		libs.Libs(),
+		scaffold.New(),
+		toolchain.Toolchain(),
 	}
 	app.Writer = os.Stdout
 	app.ErrWriter = os.Stderr
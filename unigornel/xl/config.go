@@ -0,0 +1,470 @@
+package xl
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Action is what happens to a domain when it powers off, reboots or crashes.
+type Action string
+
+const (
+	ActionDestroy         Action = "destroy"
+	ActionRestart         Action = "restart"
+	ActionRenameRestart   Action = "rename-restart"
+	ActionPreserve        Action = "preserve"
+	ActionCoredumpDestroy Action = "coredump-destroy"
+	ActionCoredumpRestart Action = "coredump-restart"
+	ActionSoftReset       Action = "soft-reset"
+)
+
+// Validate checks that the action is known to xl. The empty action is the
+// default of xl.
+func (a Action) Validate() error {
+	switch a {
+	case "", ActionDestroy, ActionRestart, ActionRenameRestart, ActionPreserve,
+		ActionCoredumpDestroy, ActionCoredumpRestart, ActionSoftReset:
+		return nil
+	}
+	return fmt.Errorf("unknown action '%v'", string(a))
+}
+
+// Disk is a virtual block device of a domain.
+type Disk struct {
+	// Target is the file or device that backs the disk.
+	Target string
+
+	// Format is raw, qcow, qcow2, vhd or qed. It defaults to raw.
+	Format string
+
+	// VDev is the name of the disk in the domain, e.g. xvda.
+	VDev string
+
+	// Access is r, ro, w or rw. It defaults to rw.
+	Access string
+}
+
+var (
+	cpusRegexp = regexp.MustCompile(`^(all|\^?(node:)?\d+(-\d+)?(,\^?(node:)?\d+(-\d+)?)*)$`)
+	macRegexp  = regexp.MustCompile(`^([0-9a-fA-F]{2}:){5}[0-9a-fA-F]{2}$`)
+)
+
+// Validate checks the configuration.
+func (k Kernel) Validate() error {
+	switch {
+	case k.Name == "":
+		return fmt.Errorf("name: missing")
+	case k.Binary == "":
+		return fmt.Errorf("kernel: missing")
+	case k.Memory <= 0:
+		return fmt.Errorf("memory: must be positive")
+	case k.MaxMemory != 0 && k.MaxMemory < k.Memory:
+		return fmt.Errorf("maxmem: must be at least memory")
+	case k.VCPUs < 0:
+		return fmt.Errorf("vcpus: must not be negative")
+	case k.CPUs != "" && !cpusRegexp.MatchString(k.CPUs):
+		return fmt.Errorf("cpus: invalid CPU list '%v'", k.CPUs)
+	}
+
+	actions := []struct {
+		Key    string
+		Action Action
+	}{
+		{"on_poweroff", k.OnPoweroff},
+		{"on_reboot", k.OnReboot},
+		{"on_crash", k.OnCrash},
+	}
+	for _, a := range actions {
+		if err := a.Action.Validate(); err != nil {
+			return fmt.Errorf("%v: %v", a.Key, err)
+		}
+	}
+
+	for i, v := range k.VIFs {
+		if err := v.Validate(); err != nil {
+			return fmt.Errorf("vif %d: %v", i, err)
+		}
+	}
+	for i, d := range k.Disks {
+		if err := d.Validate(); err != nil {
+			return fmt.Errorf("disk %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// Validate checks the network interface. Values cannot contain commas,
+// because they separate the keys of a vif spec.
+func (v VIF) Validate() error {
+	for _, kv := range v.keyValues() {
+		if strings.Contains(kv[1], ",") {
+			return fmt.Errorf("%v: must not contain a comma", kv[0])
+		}
+		if strings.TrimSpace(kv[1]) != kv[1] {
+			return fmt.Errorf("%v: must not start or end with spaces", kv[0])
+		}
+	}
+
+	if v.MAC != "" && !macRegexp.MatchString(v.MAC) {
+		return fmt.Errorf("mac: invalid MAC address '%v'", v.MAC)
+	}
+	if v.IP != "" && net.ParseIP(v.IP) == nil {
+		return fmt.Errorf("ip: invalid IP address '%v'", v.IP)
+	}
+	if v.DevID < 0 || v.BackendID < 0 {
+		return fmt.Errorf("devid and backend must not be negative")
+	}
+	return nil
+}
+
+func (v VIF) keyValues() [][2]string {
+	var kvs [][2]string
+	add := func(k, v string) {
+		if v != "" {
+			kvs = append(kvs, [2]string{k, v})
+		}
+	}
+
+	add("mac", v.MAC)
+	add("ip", v.IP)
+	add("bridge", v.Bridge)
+	add("model", v.Model)
+	add("script", v.Script)
+	if v.BackendName != "" {
+		add("backend", v.BackendName)
+	} else if v.BackendID != 0 {
+		add("backend", strconv.Itoa(v.BackendID))
+	}
+	if v.DevID != 0 {
+		add("devid", strconv.Itoa(v.DevID))
+	}
+	return kvs
+}
+
+// String returns the vif spec of the network interface, e.g.
+// "mac=00:16:3e:00:00:01, bridge=xenbr0".
+func (v VIF) String() string {
+	var parts []string
+	for _, kv := range v.keyValues() {
+		parts = append(parts, kv[0]+"="+kv[1])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ParseVIF parses a vif spec.
+func ParseVIF(spec string) (VIF, error) {
+	var v VIF
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return v, fmt.Errorf("invalid vif option '%v' (expected KEY=VALUE)", part)
+		}
+
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		var err error
+		switch key {
+		case "mac":
+			v.MAC = value
+		case "ip":
+			v.IP = value
+		case "bridge":
+			v.Bridge = value
+		case "model":
+			v.Model = value
+		case "script":
+			v.Script = value
+		case "backend":
+			if id, err := strconv.Atoi(value); err == nil {
+				v.BackendID = id
+			} else {
+				v.BackendName = value
+			}
+		case "devid":
+			v.DevID, err = strconv.Atoi(value)
+		default:
+			err = fmt.Errorf("unsupported vif option")
+		}
+		if err != nil {
+			return v, fmt.Errorf("%v: %v", key, err)
+		}
+	}
+	return v, v.Validate()
+}
+
+// Validate checks the disk.
+func (d Disk) Validate() error {
+	if d.Target == "" {
+		return fmt.Errorf("target: missing")
+	}
+	if d.VDev == "" {
+		return fmt.Errorf("vdev: missing")
+	}
+	switch d.Format {
+	case "", "raw", "qcow", "qcow2", "vhd", "qed":
+	default:
+		return fmt.Errorf("format: unknown format '%v'", d.Format)
+	}
+	switch d.Access {
+	case "", "r", "ro", "w", "rw":
+	default:
+		return fmt.Errorf("access: unknown access '%v'", d.Access)
+	}
+	for _, s := range []string{d.Format, d.VDev, d.Access} {
+		if strings.Contains(s, ",") {
+			return fmt.Errorf("'%v' must not contain a comma", s)
+		}
+	}
+	return nil
+}
+
+// String returns the disk spec of the disk. The target comes last, so it
+// may contain commas.
+func (d Disk) String() string {
+	var parts []string
+	if d.Format != "" {
+		parts = append(parts, "format="+d.Format)
+	}
+	parts = append(parts, "vdev="+d.VDev)
+	if d.Access != "" {
+		parts = append(parts, "access="+d.Access)
+	}
+	parts = append(parts, "target="+d.Target)
+	return strings.Join(parts, ", ")
+}
+
+// ParseDisk parses a disk spec. Both KEY=VALUE options and the positional
+// forms "TARGET, FORMAT, VDEV, ACCESS" and "TARGET, VDEV, ACCESS" are
+// accepted.
+func ParseDisk(spec string) (Disk, error) {
+	var d Disk
+	var positional []string
+
+	parts := strings.Split(spec, ",")
+	for i := 0; i < len(parts); i++ {
+		part := strings.TrimSpace(parts[i])
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			positional = append(positional, part)
+			continue
+		}
+
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		switch key {
+		case "target":
+			// The target is the rest of the spec.
+			rest := append([]string{value}, parts[i+1:]...)
+			d.Target = strings.TrimSpace(strings.Join(rest, ","))
+			i = len(parts)
+		case "format":
+			d.Format = value
+		case "vdev":
+			d.VDev = value
+		case "access":
+			d.Access = value
+		default:
+			return d, fmt.Errorf("%v: unsupported disk option", key)
+		}
+	}
+
+	switch len(positional) {
+	case 0:
+	case 3:
+		d.Target, d.VDev, d.Access = positional[0], positional[1], positional[2]
+	case 4:
+		d.Target, d.Format, d.VDev, d.Access = positional[0], positional[1], positional[2], positional[3]
+	default:
+		return d, fmt.Errorf("invalid disk spec '%v'", spec)
+	}
+	return d, d.Validate()
+}
+
+// WriteConfiguration writes the kernel as an xl configuration file.
+func (k Kernel) WriteConfiguration(w io.Writer) error {
+	if err := k.Validate(); err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "kernel = %v\n", quote(k.Binary))
+	if k.Ramdisk != "" {
+		fmt.Fprintf(&b, "ramdisk = %v\n", quote(k.Ramdisk))
+	}
+	fmt.Fprintf(&b, "memory = %d\n", k.Memory)
+	if k.MaxMemory != 0 {
+		fmt.Fprintf(&b, "maxmem = %d\n", k.MaxMemory)
+	}
+	if k.VCPUs != 0 {
+		fmt.Fprintf(&b, "vcpus = %d\n", k.VCPUs)
+	}
+	if k.CPUs != "" {
+		fmt.Fprintf(&b, "cpus = %v\n", quote(k.CPUs))
+	}
+	fmt.Fprintf(&b, "name = %v\n", quote(k.Name))
+	if k.OnPoweroff != "" {
+		fmt.Fprintf(&b, "on_poweroff = %v\n", quote(string(k.OnPoweroff)))
+	}
+	if k.OnReboot != "" {
+		fmt.Fprintf(&b, "on_reboot = %v\n", quote(string(k.OnReboot)))
+	}
+	if k.OnCrash != "" {
+		fmt.Fprintf(&b, "on_crash = %v\n", quote(string(k.OnCrash)))
+	}
+	if len(k.VIFs) > 0 {
+		var specs []string
+		for _, v := range k.VIFs {
+			specs = append(specs, v.String())
+		}
+		fmt.Fprintf(&b, "vif = %v\n", quoteList(specs))
+	}
+	if len(k.Disks) > 0 {
+		var specs []string
+		for _, d := range k.Disks {
+			specs = append(specs, d.String())
+		}
+		fmt.Fprintf(&b, "disk = %v\n", quoteList(specs))
+	}
+	if k.Extra != "" {
+		fmt.Fprintf(&b, "extra = %v\n", quote(k.Extra))
+	}
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// quote returns s as a string in the xl configuration format.
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\', '"':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if c < 0x20 || c == 0x7f {
+				fmt.Fprintf(&b, `\x%02x`, c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func quoteList(l []string) string {
+	quoted := make([]string, len(l))
+	for i, s := range l {
+		quoted[i] = quote(s)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// ReadConfiguration parses an xl configuration file into a kernel. Settings
+// that a Kernel cannot hold are an error.
+func ReadConfiguration(r io.Reader) (Kernel, error) {
+	var k Kernel
+
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		return k, err
+	}
+	settings, err := parseConfig(string(src))
+	if err != nil {
+		return k, err
+	}
+
+	seen := make(map[string]bool)
+	for _, s := range settings {
+		key := s.Key
+		if key == "cmdline" {
+			key = "extra"
+		}
+		if seen[key] {
+			return k, fmt.Errorf("line %d: %v is set twice", s.Line, s.Key)
+		}
+		seen[key] = true
+
+		if err := k.set(s); err != nil {
+			return k, fmt.Errorf("line %d: %v: %v", s.Line, s.Key, err)
+		}
+	}
+	return k, k.Validate()
+}
+
+func (k *Kernel) set(s configSetting) error {
+	var err error
+	switch s.Key {
+	case "kernel":
+		k.Binary, err = s.String()
+	case "ramdisk":
+		k.Ramdisk, err = s.String()
+	case "name":
+		k.Name, err = s.String()
+	case "memory":
+		k.Memory, err = s.Int()
+	case "maxmem":
+		k.MaxMemory, err = s.Int()
+	case "vcpus":
+		k.VCPUs, err = s.Int()
+	case "cpus":
+		k.CPUs, err = s.String()
+	case "on_poweroff", "on_reboot", "on_crash":
+		var a string
+		a, err = s.String()
+		switch s.Key {
+		case "on_poweroff":
+			k.OnPoweroff = Action(a)
+		case "on_reboot":
+			k.OnReboot = Action(a)
+		case "on_crash":
+			k.OnCrash = Action(a)
+		}
+	case "extra", "cmdline":
+		k.Extra, err = s.String()
+	case "vif":
+		var specs []string
+		if specs, err = s.List(); err != nil {
+			return err
+		}
+		for _, spec := range specs {
+			v, err := ParseVIF(spec)
+			if err != nil {
+				return err
+			}
+			k.VIFs = append(k.VIFs, v)
+		}
+	case "disk":
+		var specs []string
+		if specs, err = s.List(); err != nil {
+			return err
+		}
+		for _, spec := range specs {
+			d, err := ParseDisk(spec)
+			if err != nil {
+				return err
+			}
+			k.Disks = append(k.Disks, d)
+		}
+	default:
+		err = fmt.Errorf("unsupported setting")
+	}
+	return err
+}
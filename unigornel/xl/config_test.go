@@ -0,0 +1,193 @@
+package xl
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var guestKernel = Kernel{
+	Name:       "web server",
+	Binary:     "/srv/unikernels/web",
+	Ramdisk:    "/srv/unikernels/web.initrd",
+	Memory:     64,
+	MaxMemory:  128,
+	VCPUs:      2,
+	CPUs:       "0-3,^1",
+	OnPoweroff: ActionDestroy,
+	OnReboot:   ActionRestart,
+	OnCrash:    ActionCoredumpDestroy,
+	VIFs: []VIF{
+		{MAC: "00:16:3e:11:22:33", IP: "10.0.0.2", Bridge: "xenbr0", Model: "e1000", BackendName: "netback"},
+		{Bridge: "xenbr1", DevID: 1},
+	},
+	Disks: []Disk{
+		{Target: "phy:/dev/vg0/web", VDev: "xvda", Access: "w"},
+		{Target: "/srv/images/data.qcow2", Format: "qcow2", VDev: "xvdb", Access: "ro"},
+		{Target: "/srv/images/a,b.img", Format: "raw", VDev: "xvdc"},
+	},
+	Extra: "port=8080 greeting=\"hello\tworld\"",
+}
+
+func TestReadConfiguration(t *testing.T) {
+	fh, err := os.Open("testdata/guest.cfg")
+	require.Nil(t, err)
+	defer fh.Close()
+
+	k, err := ReadConfiguration(fh)
+	require.Nil(t, err)
+	assert.Equal(t, guestKernel, k)
+}
+
+func TestConfigurationRoundTrip(t *testing.T) {
+	kernels := []Kernel{
+		{Name: "hello", Binary: "/tmp/hello", Memory: 32},
+		{Name: "hello", Binary: "/tmp/hello", Memory: 32, OnCrash: ActionPreserve, Extra: "a=1 b=2"},
+		{Name: "quotes \" and ' and \\", Binary: "/tmp/a b", Memory: 32, Extra: "line\nbreak\x01\x7f"},
+		{Name: "ping", Binary: "/tmp/ping", Memory: 256, VIFs: []VIF{{Bridge: "unigornel0"}}},
+		{Name: "backend", Binary: "/tmp/k", Memory: 16, VIFs: []VIF{{Bridge: "xenbr0", BackendID: 3}}},
+		guestKernel,
+	}
+
+	for i, k := range kernels {
+		var b bytes.Buffer
+		require.Nil(t, k.WriteConfiguration(&b), "for test %d", i)
+
+		read, err := ReadConfiguration(&b)
+		require.Nil(t, err, "for test %d", i)
+		assert.Equal(t, k, read, "for test %d", i)
+	}
+}
+
+func TestWriteConfiguration(t *testing.T) {
+	k := Kernel{
+		Name:    "ping",
+		Binary:  "/tmp/ping",
+		Memory:  256,
+		OnCrash: ActionPreserve,
+		VIFs:    []VIF{{Bridge: "unigornel0"}},
+		Extra:   `ip_address=10.0.100.3 msg="hi"`,
+	}
+
+	var b bytes.Buffer
+	require.Nil(t, k.WriteConfiguration(&b))
+	expected := `kernel = "/tmp/ping"
+memory = 256
+name = "ping"
+on_crash = "preserve"
+vif = ["bridge=unigornel0"]
+extra = "ip_address=10.0.100.3 msg=\"hi\""
+`
+	assert.Equal(t, expected, b.String())
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		In  string
+		Out string
+	}{
+		{"", `""`},
+		{"hello", `"hello"`},
+		{`a "b" c`, `"a \"b\" c"`},
+		{`C:\path`, `"C:\\path"`},
+		{"a\nb\tc\rd", `"a\nb\tc\rd"`},
+		{"\x00\x1b\x7f", `"\x00\x1b\x7f"`},
+		{"héllo", `"héllo"`},
+	}
+
+	for i, test := range tests {
+		assert.Equal(t, test.Out, quote(test.In), "for test %d", i)
+
+		s, n, err := unquote(test.Out)
+		require.Nil(t, err, "for test %d", i)
+		assert.Equal(t, len(test.Out), n, "for test %d", i)
+		assert.Equal(t, test.In, s, "for test %d", i)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := Kernel{Name: "k", Binary: "/tmp/k", Memory: 32}
+	require.Nil(t, valid.Validate())
+
+	tests := []func(k *Kernel){
+		func(k *Kernel) { k.Name = "" },
+		func(k *Kernel) { k.Binary = "" },
+		func(k *Kernel) { k.Memory = 0 },
+		func(k *Kernel) { k.MaxMemory = 16 },
+		func(k *Kernel) { k.VCPUs = -1 },
+		func(k *Kernel) { k.CPUs = "0-" },
+		func(k *Kernel) { k.CPUs = "some" },
+		func(k *Kernel) { k.OnCrash = "explode" },
+		func(k *Kernel) { k.OnReboot = "rename_restart" },
+		func(k *Kernel) { k.VIFs = []VIF{{MAC: "00:16:3e"}} },
+		func(k *Kernel) { k.VIFs = []VIF{{IP: "10.0.0.256"}} },
+		func(k *Kernel) { k.VIFs = []VIF{{Bridge: "a,b"}} },
+		func(k *Kernel) { k.VIFs = []VIF{{Bridge: " br"}} },
+		func(k *Kernel) { k.Disks = []Disk{{VDev: "xvda"}} },
+		func(k *Kernel) { k.Disks = []Disk{{Target: "/img"}} },
+		func(k *Kernel) { k.Disks = []Disk{{Target: "/img", VDev: "xvda", Format: "iso"}} },
+		func(k *Kernel) { k.Disks = []Disk{{Target: "/img", VDev: "xvda", Access: "x"}} },
+	}
+
+	for i, f := range tests {
+		k := valid
+		f(&k)
+		assert.NotNil(t, k.Validate(), "for test %d", i)
+		assert.NotNil(t, k.WriteConfiguration(&bytes.Buffer{}), "for test %d", i)
+	}
+}
+
+func TestReadConfigurationInvalid(t *testing.T) {
+	base := "name = \"k\"\nkernel = \"/tmp/k\"\n"
+	tests := []string{
+		"memory = 32\nmemory = 32\n",
+		"memory = \"32\"\n",
+		"memory = 32\nvcpus = [1]\n",
+		"memory = 32\nvif = \"bridge=xenbr0\"\n",
+		"memory = 32\nvif = ['bridge']\n",
+		"memory = 32\nvif = ['vifname=eth0']\n",
+		"memory = 32\ndisk = ['/img,xvda']\n",
+		"memory = 32\ndisk = ['devtype=cdrom']\n",
+		"memory = 32\nbuilder = \"hvm\"\n",
+		"memory = 32\nextra = \"unterminated\n",
+		"memory = 32\nextra = \"bad \\q escape\"\n",
+		"memory = 32 vcpus = 1\n",
+		"memory = 32\nvif = ['a'\n",
+		"memory 32\n",
+		"memory = 32\n$\n",
+		"",
+	}
+
+	for i, test := range tests {
+		_, err := ReadConfiguration(strings.NewReader(base + test))
+		assert.NotNil(t, err, "for test %d", i)
+	}
+}
+
+func TestParseVIF(t *testing.T) {
+	tests := []struct {
+		Spec string
+		VIF  VIF
+	}{
+		{"", VIF{}},
+		{"bridge=xenbr0", VIF{Bridge: "xenbr0"}},
+		{" mac = 00:16:3e:00:00:01 , bridge=xenbr0", VIF{MAC: "00:16:3e:00:00:01", Bridge: "xenbr0"}},
+		{"backend=3", VIF{BackendID: 3}},
+		{"backend=netback", VIF{BackendName: "netback"}},
+		{"script=vif-route,ip=10.0.0.2", VIF{Script: "vif-route", IP: "10.0.0.2"}},
+	}
+
+	for i, test := range tests {
+		v, err := ParseVIF(test.Spec)
+		require.Nil(t, err, "for test %d", i)
+		assert.Equal(t, test.VIF, v, "for test %d", i)
+
+		v, err = ParseVIF(v.String())
+		require.Nil(t, err, "for test %d", i)
+		assert.Equal(t, test.VIF, v, "for test %d", i)
+	}
+}
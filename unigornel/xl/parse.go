@@ -0,0 +1,294 @@
+package xl
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// configSetting is a KEY = VALUE line of an xl configuration file. The value
+// is a string, a number or a list of strings.
+type configSetting struct {
+	Key      string
+	Line     int
+	Value    string
+	IsNumber bool
+	IsList   bool
+	Items    []string
+}
+
+func (s configSetting) String() (string, error) {
+	if s.IsList || s.IsNumber {
+		return "", fmt.Errorf("expected a string")
+	}
+	return s.Value, nil
+}
+
+func (s configSetting) Int() (int, error) {
+	if !s.IsNumber {
+		return 0, fmt.Errorf("expected a number")
+	}
+	return strconv.Atoi(s.Value)
+}
+
+func (s configSetting) List() ([]string, error) {
+	if !s.IsList {
+		return nil, fmt.Errorf("expected a list")
+	}
+	return s.Items, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNewline
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenPunct
+)
+
+type token struct {
+	Kind tokenKind
+	Text string
+	Line int
+}
+
+// tokenize splits an xl configuration file into tokens. Comments start
+// with # and run until the end of the line.
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '\n':
+			tokens = append(tokens, token{tokenNewline, "\n", line})
+			line++
+			i++
+		case isIdentStart(c):
+			j := i
+			for j < len(src) && (isIdentStart(src[j]) || isDigit(src[j])) {
+				j++
+			}
+			tokens = append(tokens, token{tokenIdent, src[i:j], line})
+			i = j
+		case isDigit(c):
+			j := i
+			for j < len(src) && isDigit(src[j]) {
+				j++
+			}
+			tokens = append(tokens, token{tokenNumber, src[i:j], line})
+			i = j
+		case c == '"' || c == '\'':
+			s, n, err := unquote(src[i:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+			tokens = append(tokens, token{tokenString, s, line})
+			i += n
+		case strings.IndexByte("=[],;", c) >= 0:
+			tokens = append(tokens, token{tokenPunct, string(c), line})
+			i++
+		default:
+			return nil, fmt.Errorf("line %d: unexpected character '%c'", line, c)
+		}
+	}
+	return append(tokens, token{tokenEOF, "", line}), nil
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// unquote reads the quoted string at the start of s. It returns the string
+// and the number of bytes that were read.
+func unquote(s string) (string, int, error) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote:
+			return b.String(), i + 1, nil
+		case c == '\n':
+			return "", 0, fmt.Errorf("unterminated string")
+		case c != '\\':
+			b.WriteByte(c)
+			continue
+		}
+
+		i++
+		if i == len(s) {
+			break
+		}
+		switch e := s[i]; e {
+		case '\\', '\'', '"':
+			b.WriteByte(e)
+		case 'a':
+			b.WriteByte('\a')
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'v':
+			b.WriteByte('\v')
+		case 'x':
+			if i+2 >= len(s) {
+				return "", 0, fmt.Errorf("invalid escape sequence")
+			}
+			v, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid escape sequence '\\x%v'", s[i+1:i+3])
+			}
+			b.WriteByte(byte(v))
+			i += 2
+		default:
+			j := i
+			for j < len(s) && j < i+3 && '0' <= s[j] && s[j] <= '7' {
+				j++
+			}
+			if j == i {
+				return "", 0, fmt.Errorf("invalid escape sequence '\\%c'", e)
+			}
+			v, err := strconv.ParseUint(s[i:j], 8, 8)
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid escape sequence '\\%v'", s[i:j])
+			}
+			b.WriteByte(byte(v))
+			i = j - 1
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+// parseConfig parses the settings of an xl configuration file. Settings
+// end at a newline or a semicolon. Lists may span several lines.
+func parseConfig(src string) ([]configSetting, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &configParser{tokens: tokens}
+	var settings []configSetting
+	for {
+		p.skip(tokenNewline, ";")
+		if p.peek().Kind == tokenEOF {
+			return settings, nil
+		}
+
+		s, err := p.setting()
+		if err != nil {
+			return nil, err
+		}
+		settings = append(settings, s)
+
+		if t := p.next(); t.Kind != tokenNewline && t.Kind != tokenEOF && t.Text != ";" {
+			return nil, p.unexpected(t)
+		}
+	}
+}
+
+type configParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *configParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *configParser) next() token {
+	t := p.tokens[p.pos]
+	if t.Kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// skip skips newlines and the punctuation.
+func (p *configParser) skip(kind tokenKind, punct string) {
+	for {
+		t := p.peek()
+		if t.Kind != kind && !(t.Kind == tokenPunct && t.Text == punct) {
+			return
+		}
+		p.next()
+	}
+}
+
+func (p *configParser) unexpected(t token) error {
+	switch t.Kind {
+	case tokenEOF:
+		return fmt.Errorf("line %d: unexpected end of file", t.Line)
+	case tokenNewline:
+		return fmt.Errorf("line %d: unexpected end of line", t.Line)
+	}
+	return fmt.Errorf("line %d: unexpected '%v'", t.Line, t.Text)
+}
+
+func (p *configParser) setting() (configSetting, error) {
+	var s configSetting
+
+	key := p.next()
+	if key.Kind != tokenIdent {
+		return s, p.unexpected(key)
+	}
+	s.Key = key.Text
+	s.Line = key.Line
+
+	if t := p.next(); t.Kind != tokenPunct || t.Text != "=" {
+		return s, p.unexpected(t)
+	}
+
+	switch t := p.next(); {
+	case t.Kind == tokenString:
+		s.Value = t.Text
+	case t.Kind == tokenNumber:
+		s.Value = t.Text
+		s.IsNumber = true
+	case t.Kind == tokenPunct && t.Text == "[":
+		s.IsList = true
+		for {
+			p.skip(tokenNewline, "")
+			item := p.next()
+			if item.Kind == tokenPunct && item.Text == "]" {
+				break
+			}
+			if item.Kind != tokenString && item.Kind != tokenNumber {
+				return s, p.unexpected(item)
+			}
+			s.Items = append(s.Items, item.Text)
+
+			p.skip(tokenNewline, "")
+			sep := p.next()
+			if sep.Kind == tokenPunct && sep.Text == "]" {
+				break
+			}
+			if sep.Kind != tokenPunct || sep.Text != "," {
+				return s, p.unexpected(sep)
+			}
+		}
+	default:
+		return s, p.unexpected(t)
+	}
+	return s, nil
+}
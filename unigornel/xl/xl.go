@@ -0,0 +1,69 @@
+// Package xl models the configuration of a Xen domain and reads and writes
+// it in the xl configuration file format.
+package xl
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Kernel is the configuration of a domain. See config.go for how it is
+// written to and read from xl configuration files.
+type Kernel struct {
+	Name    string
+	Binary  string
+	Ramdisk string
+
+	// Memory and MaxMemory are in MiB. A MaxMemory of zero is Memory.
+	Memory    int
+	MaxMemory int
+
+	// VCPUs is the number of virtual CPUs. Zero is the default of xl.
+	VCPUs int
+
+	// CPUs are the physical CPUs that the VCPUs may run on, e.g. "0-3,^1"
+	// or "all".
+	CPUs string
+
+	OnPoweroff Action
+	OnReboot   Action
+	OnCrash    Action
+
+	VIFs  []VIF
+	Disks []Disk
+
+	// Extra is the command line of the kernel.
+	Extra string
+}
+
+// VIF is a virtual network interface of a domain.
+type VIF struct {
+	DevID  int
+	MAC    string
+	IP     string
+	Bridge string
+	Model  string
+	Script string
+
+	// BackendID and BackendName identify the domain that runs the backend
+	// of the interface.
+	BackendID   int
+	BackendName string
+}
+
+// JoinArgs joins the arguments of a kernel into its command line. The
+// unikernel splits the command line at whitespace without interpreting
+// quotes, so an argument that is empty or contains whitespace cannot be
+// passed and is an error.
+func JoinArgs(args []string) (string, error) {
+	for _, arg := range args {
+		if arg == "" {
+			return "", fmt.Errorf("empty kernel argument")
+		}
+		if strings.IndexFunc(arg, unicode.IsSpace) >= 0 {
+			return "", fmt.Errorf("kernel argument %q contains whitespace", arg)
+		}
+	}
+	return strings.Join(args, " "), nil
+}
@@ -0,0 +1,34 @@
+package xl
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJoinArgs(t *testing.T) {
+	cases := []struct {
+		Args        []string
+		Extra       string
+		ErrorRegexp *regexp.Regexp
+	}{
+		{nil, "", nil},
+		{[]string{"a=1", "b=2"}, "a=1 b=2", nil},
+		{[]string{`msg="hi"`, "it's"}, `msg="hi" it's`, nil},
+		{[]string{"msg=hello world"}, "", regexp.MustCompile(`"msg=hello world" contains whitespace`)},
+		{[]string{"a=1", "b=\t"}, "", regexp.MustCompile("contains whitespace")},
+		{[]string{"a=1\n"}, "", regexp.MustCompile("contains whitespace")},
+		{[]string{"a=1", ""}, "", regexp.MustCompile("empty kernel argument")},
+	}
+
+	for i, c := range cases {
+		extra, err := JoinArgs(c.Args)
+		if c.ErrorRegexp == nil {
+			assert.Nil(t, err, "for test %d", i)
+			assert.Equal(t, c.Extra, extra, "for test %d", i)
+		} else if assert.NotNil(t, err, "for test %d", i) {
+			assert.True(t, c.ErrorRegexp.MatchString(err.Error()), "for test %d: %v", i, err)
+		}
+	}
+}